@@ -12,4 +12,7 @@
 //	semaphores
 //	events
 //	conditional variables
+//	shared hash map
+//	named object registry
+//	append-only log
 package ipc
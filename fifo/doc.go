@@ -4,4 +4,5 @@
 // It gives access to OS-native FIFO objects via:
 //	CreateNamedPipe on windows
 //	Mkfifo on unix
+// On linux and freebsd it also provides ShmFifo, a fifo based on a ring buffer in shared memory.
 package fifo
@@ -2,7 +2,13 @@
 
 package fifo
 
-import "os"
+import (
+	"os"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
+
+	"github.com/pkg/errors"
+)
 
 func newFifo(name string, flag int, perm os.FileMode) (Fifo, error) {
 	return NewNamedPipe(name, flag, perm)
@@ -11,3 +17,7 @@ func newFifo(name string, flag int, perm os.FileMode) (Fifo, error) {
 func destroyFifo(name string) error {
 	return DestroyNamedPipe(name)
 }
+
+func setFifoPermissions(name string, perm ipcperm.Permissions) error {
+	return errors.New("named pipes permissions cannot be changed")
+}
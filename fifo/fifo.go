@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 )
 
 const (
@@ -33,3 +34,22 @@ func New(name string, flag int, perm os.FileMode) (Fifo, error) {
 func Destroy(name string) error {
 	return destroyFifo(name)
 }
+
+// SetPermissions changes the mode and the ownership of the FIFO with the given name.
+// On windows named pipes do not support it, and an error is returned.
+//	name - object name.
+//	perm - new permissions.
+func SetPermissions(name string, perm ipcperm.Permissions) error {
+	return setFifoPermissions(name, perm)
+}
+
+// Chmod sets the exact mode of the FIFO with the given name.
+func Chmod(name string, mode os.FileMode) error {
+	return setFifoPermissions(name, ipcperm.Mode(mode))
+}
+
+// Chown changes the owner and the group of the FIFO with the given name.
+// If uid or gid is -1, the corresponding value is not changed.
+func Chown(name string, uid, gid int) error {
+	return setFifoPermissions(name, ipcperm.Owner(uid, gid))
+}
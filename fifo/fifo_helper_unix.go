@@ -4,7 +4,11 @@
 
 package fifo
 
-import "os"
+import (
+	"os"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
+)
 
 func newFifo(name string, flag int, perm os.FileMode) (Fifo, error) {
 	return NewUnixFifo(name, flag, perm)
@@ -13,3 +17,7 @@ func newFifo(name string, flag int, perm os.FileMode) (Fifo, error) {
 func destroyFifo(name string) error {
 	return DestroyUnixFIFO(name)
 }
+
+func setFifoPermissions(name string, perm ipcperm.Permissions) error {
+	return SetUnixFifoPermissions(name, perm)
+}
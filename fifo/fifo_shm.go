@@ -0,0 +1,356 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux freebsd
+
+package fifo
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/ipcperm"
+	"bitbucket.org/avd/go-ipc/mmf"
+	"bitbucket.org/avd/go-ipc/shm"
+	ipc_sync "bitbucket.org/avd/go-ipc/sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultShmFifoSize is the default size of ShmFifo's buffer.
+	DefaultShmFifoSize = 64 * 1024
+
+	shmFifoHdrSize = int(unsafe.Sizeof(shmFifoHdr{}))
+)
+
+var (
+	_ Fifo = (*ShmFifo)(nil)
+)
+
+// shmFifoHdr is the shared state of the fifo, which is followed by the ring buffer.
+// head and tail are total numbers of bytes read and written.
+// dataSeq and spaceSeq are futexes, which are changed, when new data or free space appear.
+// cap is set by the creator, and openers wait for it to become non-zero.
+type shmFifoHdr struct {
+	head          uint64
+	tail          uint64
+	cap           uint32
+	dataSeq       int32
+	spaceSeq      int32
+	readerWaiting int32
+	writerWaiting int32
+	writerClosed  int32
+	readerClosed  int32
+	unused        int32
+}
+
+// ShmFifo is a fifo, which transfers data via a ring buffer in shared memory.
+// Unlike UnixFifo, it does not make a syscall for every read or write,
+// a syscall is only needed to block, if there is no data or no free space.
+// It supports one reader and one writer at a time.
+// When the writer closes its side, the reader gets io.EOF after all the data has been read.
+// When the reader closes its side, the writer gets io.ErrClosedPipe.
+type ShmFifo struct {
+	name          string
+	region        *mmf.MemoryRegion
+	hdr           *shmFifoHdr
+	data          []byte
+	write         bool
+	closed        bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// NewShmFifo creates or opens a shared memory fifo with the default buffer size.
+//	name - object name.
+//	flag - flag is a combination of open flags from 'os' package.
+//		os.O_RDONLY or os.O_WRONLY define the side of the fifo.
+//	perm - object's permission bits.
+func NewShmFifo(name string, flag int, perm os.FileMode) (*ShmFifo, error) {
+	return NewShmFifoSize(name, flag, perm, DefaultShmFifoSize)
+}
+
+// NewShmFifoSize creates or opens a shared memory fifo.
+// If the fifo already exists, size of its buffer is not changed.
+//	name - object name.
+//	flag - flag is a combination of open flags from 'os' package.
+//		os.O_RDONLY or os.O_WRONLY define the side of the fifo.
+//	perm - object's permission bits.
+//	size - buffer size.
+func NewShmFifoSize(name string, flag int, perm os.FileMode, size int) (*ShmFifo, error) {
+	if flag&os.O_RDWR != 0 {
+		return nil, errors.New("O_RDWR flag cannot be used for FIFO")
+	}
+	if size <= 0 || size > int(^uint32(0)>>1) {
+		return nil, errors.New("invalid fifo size")
+	}
+	region, created, err := openShmFifoRegion(shmFifoName(name), flag, perm, shmFifoHdrSize+size)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create shared state")
+	}
+	raw := allocator.ByteSliceData(region.Data())
+	hdr := (*shmFifoHdr)(raw)
+	if created {
+		atomic.StoreUint32(&hdr.cap, uint32(size))
+	} else if !common.WaitReady(func() bool { return atomic.LoadUint32(&hdr.cap) != 0 }) || int(hdr.cap) > region.Size()-shmFifoHdrSize {
+		region.Close()
+		return nil, errors.New("invalid shared state")
+	}
+	result := &ShmFifo{
+		name:   name,
+		region: region,
+		hdr:    hdr,
+		data:   region.Data()[shmFifoHdrSize : shmFifoHdrSize+int(hdr.cap)],
+		write:  flag&os.O_WRONLY != 0,
+	}
+	// a new reader or writer reopens its side of the fifo.
+	if result.write {
+		atomic.StoreInt32(&hdr.writerClosed, 0)
+	} else {
+		atomic.StoreInt32(&hdr.readerClosed, 0)
+	}
+	return result, nil
+}
+
+// Read reads up to len(b) bytes from the fifo. It blocks, if the fifo is empty.
+// It returns io.EOF, if the fifo is empty and the writer has closed it.
+func (f *ShmFifo) Read(b []byte) (n int, err error) {
+	if f.closed {
+		return 0, errors.New("the fifo is closed")
+	}
+	if f.write {
+		return 0, errors.New("the fifo is opened for writing")
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	hdr := f.hdr
+	var tail, head uint64
+	for {
+		head, tail = atomic.LoadUint64(&hdr.head), atomic.LoadUint64(&hdr.tail)
+		if tail != head {
+			break
+		}
+		if atomic.LoadInt32(&hdr.writerClosed) != 0 {
+			return 0, io.EOF
+		}
+		if err = f.waitFor(&hdr.dataSeq, &hdr.readerWaiting, func() bool {
+			return atomic.LoadUint64(&hdr.tail) != head || atomic.LoadInt32(&hdr.writerClosed) != 0
+		}, f.readDeadline); err != nil {
+			return 0, err
+		}
+	}
+	avail := int(tail - head)
+	if avail > len(b) {
+		avail = len(b)
+	}
+	n = f.copyFrom(b[:avail], head)
+	atomic.StoreUint64(&hdr.head, head+uint64(n))
+	f.notify(&hdr.spaceSeq, &hdr.writerWaiting)
+	return n, nil
+}
+
+// Write writes b into the fifo. It blocks, until all the data is written.
+// It returns io.ErrClosedPipe, if the reader has closed the fifo.
+func (f *ShmFifo) Write(b []byte) (n int, err error) {
+	if f.closed {
+		return 0, errors.New("the fifo is closed")
+	}
+	if !f.write {
+		return 0, errors.New("the fifo is opened for reading")
+	}
+	hdr := f.hdr
+	capacity := uint64(hdr.cap)
+	for n < len(b) {
+		if atomic.LoadInt32(&hdr.readerClosed) != 0 {
+			return n, io.ErrClosedPipe
+		}
+		head, tail := atomic.LoadUint64(&hdr.head), atomic.LoadUint64(&hdr.tail)
+		free := int(capacity - (tail - head))
+		if free == 0 {
+			if err = f.waitFor(&hdr.spaceSeq, &hdr.writerWaiting, func() bool {
+				return atomic.LoadUint64(&hdr.head) != head || atomic.LoadInt32(&hdr.readerClosed) != 0
+			}, f.writeDeadline); err != nil {
+				return n, err
+			}
+			continue
+		}
+		if free > len(b)-n {
+			free = len(b) - n
+		}
+		written := f.copyTo(b[n:n+free], tail)
+		atomic.StoreUint64(&hdr.tail, tail+uint64(written))
+		n += written
+		f.notify(&hdr.dataSeq, &hdr.readerWaiting)
+	}
+	return n, nil
+}
+
+// SetDeadline sets read and write deadlines for the fifo.
+// A zero value for t means Read and Write will not time out.
+func (f *ShmFifo) SetDeadline(t time.Time) error {
+	f.readDeadline, f.writeDeadline = t, t
+	return nil
+}
+
+// SetReadDeadline sets the deadline for future Read calls.
+// A zero value for t means Read will not time out.
+func (f *ShmFifo) SetReadDeadline(t time.Time) error {
+	f.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future Write calls.
+// A zero value for t means Write will not time out.
+func (f *ShmFifo) SetWriteDeadline(t time.Time) error {
+	f.writeDeadline = t
+	return nil
+}
+
+// Close closes this side of the fifo, waking the other side.
+func (f *ShmFifo) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	if f.write {
+		atomic.StoreInt32(&f.hdr.writerClosed, 1)
+		f.wakeAll(&f.hdr.dataSeq)
+	} else {
+		atomic.StoreInt32(&f.hdr.readerClosed, 1)
+		f.wakeAll(&f.hdr.spaceSeq)
+	}
+	f.hdr = nil
+	f.data = nil
+	return f.region.Close()
+}
+
+// Destroy closes the fifo and removes it permanently.
+func (f *ShmFifo) Destroy() error {
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "close failed")
+	}
+	return DestroyShmFifo(f.name)
+}
+
+// DestroyShmFifo permanently removes the shared memory fifo.
+func DestroyShmFifo(name string) error {
+	if err := shm.DestroyMemoryObject(shmFifoName(name)); err != nil {
+		return errors.Wrap(err, "failed to destroy shm object")
+	}
+	return nil
+}
+
+// SetShmFifoPermissions changes the mode and the ownership of the shared memory fifo.
+func SetShmFifoPermissions(name string, perm ipcperm.Permissions) error {
+	return shm.SetPermissions(shmFifoName(name), perm)
+}
+
+func (f *ShmFifo) copyFrom(b []byte, pos uint64) int {
+	start := int(pos % uint64(len(f.data)))
+	n := copy(b, f.data[start:])
+	if n < len(b) {
+		n += copy(b[n:], f.data)
+	}
+	return n
+}
+
+func (f *ShmFifo) copyTo(b []byte, pos uint64) int {
+	start := int(pos % uint64(len(f.data)))
+	n := copy(f.data[start:], b)
+	if n < len(b) {
+		n += copy(f.data, b[n:])
+	}
+	return n
+}
+
+// notify changes the futex value and wakes the other side, if it's waiting.
+func (f *ShmFifo) notify(seq, waiting *int32) {
+	atomic.AddInt32(seq, 1)
+	if atomic.LoadInt32(waiting) != 0 {
+		ipc_sync.FutexWake(unsafe.Pointer(seq), 1, 0)
+	}
+}
+
+func (f *ShmFifo) wakeAll(seq *int32) {
+	atomic.AddInt32(seq, 1)
+	ipc_sync.FutexWake(unsafe.Pointer(seq), int32(^uint32(0)>>1), 0)
+}
+
+// waitFor blocks on the futex, until ready() returns true, or the deadline expires.
+// as we set 'waiting' flag before checking the state, the other side either sees the flag
+// and wakes us, or we see the changes it made before going to sleep.
+func (f *ShmFifo) waitFor(seq, waiting *int32, ready func() bool, deadline time.Time) error {
+	atomic.StoreInt32(waiting, 1)
+	defer atomic.StoreInt32(waiting, 0)
+	for {
+		value := atomic.LoadInt32(seq)
+		if ready() {
+			return nil
+		}
+		timeout := time.Duration(-1)
+		if !deadline.IsZero() {
+			if timeout = time.Until(deadline); timeout <= 0 {
+				return newTimeoutError()
+			}
+		}
+		err := ipc_sync.FutexWait(unsafe.Pointer(seq), value, timeout, 0)
+		if err != nil && !common.SyscallErrHasCode(err, unix.EWOULDBLOCK) {
+			if common.IsTimeoutErr(err) {
+				return newTimeoutError()
+			}
+			return errors.Wrap(err, "futex wait failed")
+		}
+	}
+}
+
+// openShmFifoRegion creates a shm object of the given size, or opens an existing one.
+// unlike helper.CreateWritableRegion, it maps the entire existing object,
+// so that the size of the buffer is defined by the creator.
+func openShmFifoRegion(name string, flag int, perm os.FileMode, size int) (*mmf.MemoryRegion, bool, error) {
+	var obj *shm.MemoryObject
+	creator := func(create bool) error {
+		var err error
+		creatorFlag := os.O_RDWR
+		if create {
+			creatorFlag |= os.O_CREATE | os.O_EXCL
+		}
+		obj, err = shm.NewMemoryObject(name, creatorFlag, perm)
+		return errors.Cause(err)
+	}
+	created, err := common.OpenOrCreate(creator, flag)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to open shm object")
+	}
+	defer obj.Close()
+	if created {
+		if err = obj.Truncate(int64(size)); err != nil {
+			obj.Destroy()
+			return nil, false, errors.Wrap(err, "failed to truncate shm object")
+		}
+	} else {
+		// wait for the creator to truncate the object.
+		if !common.WaitReady(func() bool { return obj.Size() > int64(shmFifoHdrSize) }) {
+			return nil, false, errors.New("shm object is too small")
+		}
+		size = int(obj.Size())
+	}
+	region, err := mmf.NewMemoryRegion(obj, mmf.MEM_READWRITE, 0, size)
+	if err != nil {
+		if created {
+			obj.Destroy()
+		}
+		return nil, false, errors.Wrap(err, "failed to create shm region")
+	}
+	return region, created, nil
+}
+
+func shmFifoName(name string) string {
+	return name + ".shmfifo"
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux freebsd
+
+package fifo
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/mmf"
+	"bitbucket.org/avd/go-ipc/shm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShmFifoCreate(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyShmFifo(testFifoName)) {
+		return
+	}
+	_, err := NewShmFifo(testFifoName, os.O_RDONLY, 0666)
+	a.Error(err)
+	_, err = NewShmFifo(testFifoName, os.O_CREATE|os.O_RDWR, 0666)
+	a.Error(err)
+	rd, err := NewShmFifoSize(testFifoName, os.O_CREATE|os.O_EXCL|os.O_RDONLY, 0666, 128)
+	if !a.NoError(err) {
+		return
+	}
+	_, err = NewShmFifo(testFifoName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	a.Error(err)
+	wr, err := NewShmFifo(testFifoName, os.O_WRONLY, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(128, len(wr.data))
+	a.NoError(wr.Close())
+	a.NoError(rd.Destroy())
+}
+
+func TestShmFifoOpenBeforeInit(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyShmFifo(testFifoName)) {
+		return
+	}
+	// emulate a creator, which has created the object, but has not initialized it yet.
+	obj, err := shm.NewMemoryObject(shmFifoName(testFifoName), os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer obj.Destroy()
+	opened := make(chan *ShmFifo)
+	go func() {
+		wr, err := NewShmFifo(testFifoName, os.O_WRONLY, 0666)
+		a.NoError(err)
+		opened <- wr
+	}()
+	time.Sleep(time.Millisecond * 50)
+	if !a.NoError(obj.Truncate(int64(shmFifoHdrSize + 64))) {
+		return
+	}
+	region, err := mmf.NewMemoryRegion(obj, mmf.MEM_READWRITE, 0, shmFifoHdrSize)
+	if !a.NoError(err) {
+		return
+	}
+	defer region.Close()
+	time.Sleep(time.Millisecond * 50)
+	atomic.StoreUint32(&(*shmFifoHdr)(allocator.ByteSliceData(region.Data())).cap, 64)
+	if wr := <-opened; wr != nil {
+		a.Equal(64, len(wr.data))
+		a.NoError(wr.Close())
+	}
+}
+
+func TestShmFifoReadWrite(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyShmFifo(testFifoName)) {
+		return
+	}
+	rd, err := NewShmFifoSize(testFifoName, os.O_CREATE|os.O_EXCL|os.O_RDONLY, 0666, 100)
+	if !a.NoError(err) {
+		return
+	}
+	defer rd.Destroy()
+	wr, err := NewShmFifo(testFifoName, os.O_WRONLY, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	_, err = wr.Read(make([]byte, 1))
+	a.Error(err)
+	_, err = rd.Write([]byte{1})
+	a.Error(err)
+	// testData is bigger, than the buffer, so the writer will block and the data will wrap around.
+	go func() {
+		for i := 0; i < 8; i++ {
+			n, err := wr.Write(testData)
+			a.NoError(err)
+			a.Equal(len(testData), n)
+		}
+		a.NoError(wr.Close())
+	}()
+	received, err := ioutil.ReadAll(rd)
+	a.NoError(err)
+	a.Equal(bytes.Repeat(testData, 8), received)
+}
+
+func TestShmFifoReaderClose(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyShmFifo(testFifoName)) {
+		return
+	}
+	rd, err := NewShmFifoSize(testFifoName, os.O_CREATE|os.O_EXCL|os.O_RDONLY, 0666, 16)
+	if !a.NoError(err) {
+		return
+	}
+	wr, err := NewShmFifo(testFifoName, os.O_WRONLY, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer wr.Destroy()
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		a.NoError(rd.Close())
+	}()
+	_, err = wr.Write(testData)
+	a.Equal(io.ErrClosedPipe, err)
+}
+
+func TestShmFifoDeadline(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyShmFifo(testFifoName)) {
+		return
+	}
+	rd, err := NewShmFifoSize(testFifoName, os.O_CREATE|os.O_EXCL|os.O_RDONLY, 0666, 16)
+	if !a.NoError(err) {
+		return
+	}
+	defer rd.Destroy()
+	wr, err := NewShmFifo(testFifoName, os.O_WRONLY, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer wr.Close()
+	a.NoError(rd.SetReadDeadline(time.Now().Add(time.Millisecond * 100)))
+	start := time.Now()
+	_, err = rd.Read(make([]byte, 8))
+	a.True(IsTimeoutError(err))
+	a.True(time.Since(start) >= time.Millisecond*100)
+	a.NoError(wr.SetWriteDeadline(time.Now().Add(time.Millisecond * 100)))
+	n, err := wr.Write(testData[:32])
+	a.True(IsTimeoutError(err))
+	a.Equal(16, n)
+	a.NoError(rd.SetDeadline(time.Time{}))
+	buff := make([]byte, 32)
+	n, err = rd.Read(buff)
+	a.NoError(err)
+	a.Equal(testData[:16], buff[:n])
+}
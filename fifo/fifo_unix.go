@@ -8,6 +8,7 @@ import (
 	"os"
 
 	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 
 	"github.com/pkg/errors"
 	"golang.org/x/sys/unix"
@@ -85,6 +86,23 @@ func DestroyUnixFIFO(name string) error {
 	return errors.Wrap(err, "remove failed")
 }
 
+// SetUnixFifoPermissions changes the mode and the ownership of the FIFO with the given name.
+func SetUnixFifoPermissions(name string, perm ipcperm.Permissions) error {
+	path := fifoPath(name)
+	if perm.ChangesMode() {
+		if err := os.Chmod(path, perm.Mode); err != nil {
+			return errors.Wrap(err, "chmod failed")
+		}
+	}
+	if perm.ChangesOwner() {
+		uid, gid := perm.IDs()
+		if err := os.Chown(path, uid, gid); err != nil {
+			return errors.Wrap(err, "chown failed")
+		}
+	}
+	return nil
+}
+
 func fifoPath(name string) string {
 	return "/tmp/" + name
 }
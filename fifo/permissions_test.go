@@ -0,0 +1,33 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build darwin freebsd linux
+
+package fifo
+
+import (
+	"os"
+	"testing"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFifoPermissions(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(Destroy(testFifoName)) {
+		return
+	}
+	fifo, err := New(testFifoName, os.O_CREATE|os.O_EXCL|os.O_RDONLY|O_NONBLOCK, 0600)
+	if !a.NoError(err) {
+		return
+	}
+	defer fifo.Destroy()
+	a.NoError(Chmod(testFifoName, 0666))
+	a.NoError(Chown(testFifoName, os.Getuid(), os.Getgid()))
+	a.NoError(SetPermissions(testFifoName, ipcperm.Permissions{Mode: 0622}))
+	fi, err := os.Stat(fifoPath(testFifoName))
+	if a.NoError(err) {
+		a.Equal(os.FileMode(0622), fi.Mode().Perm())
+	}
+}
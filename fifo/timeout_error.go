@@ -0,0 +1,21 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package fifo
+
+// timeoutError is returned, when a deadline for an operation expires.
+// It satisfies net.Error interface.
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+func newTimeoutError() error {
+	return &timeoutError{}
+}
+
+// IsTimeoutError returns true, if the error was caused by an expired deadline.
+func IsTimeoutError(err error) bool {
+	_, ok := err.(*timeoutError)
+	return ok
+}
@@ -0,0 +1,38 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// Package hashmap implements a fixed-capacity hash map placed in shared memory.
+//
+// SharedMap stores byte keys and values in an open-addressing table.
+// The table is split into stripes, each of which is protected by its own
+// interprocess RWMutex, so lookups in different stripes, and all lookups
+// in the same stripe, can run in parallel.
+//
+// Shared state layout.
+// All values are stored in the native byte order. The layout does not depend
+// on the go version or on the build, so different programs can share the map,
+// if they run on the same architecture.
+//	header (32 bytes):
+//		0	uint32	magic, 0x4d484947 ("GIHM")
+//		4	uint32	layout version, currently 1
+//		8	uint32	number of slots in a stripe
+//		12	uint32	number of stripes
+//		16	uint32	max key size
+//		20	uint32	max value size
+//		24	uint32	slot size
+//		28	uint32	reserved
+//	stripe counters:
+//		stripes * int32, the number of live entries in each stripe.
+//		the area is padded to 8 bytes.
+//	slots:
+//		stripes * slots per stripe entries of 'slot size' bytes:
+//		0	uint32	state: 0 - empty, 1 - used, 2 - deleted
+//		4	uint32	hash of the key
+//		8	uint32	key length
+//		12	uint32	value length
+//		16	key bytes, 'max key size' bytes
+//		..	value bytes, 'max value size' bytes
+//		the slot is padded to 8 bytes.
+// The hash of the key is 32-bit FNV-1a. The stripe of a key is hash % stripes,
+// the first probed slot in the stripe is (hash / stripes) % slots per stripe,
+// and the probing is linear within the stripe.
+package hashmap
@@ -0,0 +1,332 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package hashmap
+
+import (
+	"os"
+	"strconv"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/mmf"
+	"bitbucket.org/avd/go-ipc/shm"
+	ipc_sync "bitbucket.org/avd/go-ipc/sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultStripes is the maximum number of stripes a map is split into.
+	DefaultStripes = 8
+)
+
+var (
+	// ErrMapFull is returned by Put, if there is no room for a new key in its stripe.
+	ErrMapFull = errors.New("the map is full")
+)
+
+// SharedMap is a fixed-capacity hash map with byte keys and values placed in shared memory.
+// The capacity is split evenly between stripes, so Put can return ErrMapFull
+// before all the slots of the map are used.
+type SharedMap struct {
+	name    string
+	region  *mmf.MemoryRegion
+	table   *sharedTable
+	lockers []*ipc_sync.RWMutex
+}
+
+// CreateSharedMap creates or opens a shared map.
+//	name - map name. implementation will create a shm object with this name.
+//	flag - flag is a combination of os.O_CREATE and os.O_EXCL.
+//	perm - object's permission bits.
+//	capacity - minimal number of entries the map can hold.
+//	maxKeySize - maximum key size.
+//	maxValueSize - maximum value size.
+// If the map already exists, its parameters are taken from the shared state.
+func CreateSharedMap(name string, flag int, perm os.FileMode, capacity, maxKeySize, maxValueSize int) (*SharedMap, error) {
+	if capacity <= 0 || maxKeySize <= 0 || maxValueSize < 0 {
+		return nil, errors.New("invalid map size")
+	}
+	stripes := DefaultStripes
+	if capacity < stripes {
+		stripes = capacity
+	}
+	stripeSlots := (capacity + stripes - 1) / stripes
+	size := calcMapSize(stripes, stripeSlots, maxKeySize, maxValueSize)
+	var obj *shm.MemoryObject
+	creator := func(create bool) error {
+		var err error
+		creatorFlag := os.O_RDWR
+		if create {
+			creatorFlag |= os.O_CREATE | os.O_EXCL
+		}
+		obj, err = shm.NewMemoryObject(sharedMapStateName(name), creatorFlag, perm)
+		return errors.Cause(err)
+	}
+	created, err := common.OpenOrCreate(creator, flag|os.O_CREATE)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create shm object")
+	}
+	if !created {
+		defer obj.Close()
+		return openSharedMap(name, obj)
+	}
+	result := &SharedMap{name: name}
+	defer func() {
+		obj.Close()
+		sharedMapCleanup(result, created, err)
+	}()
+	if err = obj.Truncate(int64(size)); err != nil {
+		return nil, errors.Wrap(err, "failed to resize shm object")
+	}
+	if result.region, err = mmf.NewMemoryRegion(obj, mmf.MEM_READWRITE, 0, size); err != nil {
+		return nil, errors.Wrap(err, "failed to create shm region")
+	}
+	result.table = newSharedTable(result.region.Data(), stripes, stripeSlots, maxKeySize, maxValueSize)
+	if err = result.openLockers(created, perm); err != nil {
+		return nil, err
+	}
+	// the lockers are ready, so the map can be opened by others.
+	result.table.publish()
+	return result, nil
+}
+
+// OpenSharedMap opens an existing map. It returns an error, if it does not exist.
+func OpenSharedMap(name string) (*SharedMap, error) {
+	obj, err := shm.NewMemoryObject(sharedMapStateName(name), os.O_RDWR, 0666)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open shm object")
+	}
+	defer obj.Close()
+	return openSharedMap(name, obj)
+}
+
+// openSharedMap waits, until the map is published by its creator,
+// maps its header to find out the layout, and then maps the entire map.
+func openSharedMap(name string, obj *shm.MemoryObject) (*SharedMap, error) {
+	if !common.WaitReady(func() bool { return obj.Size() >= int64(mapHdrSize) }) {
+		return nil, errors.New("shared state is too small")
+	}
+	hdrRegion, err := mmf.NewMemoryRegion(obj, mmf.MEM_READ_ONLY, 0, mapHdrSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create shm region")
+	}
+	common.WaitReady(func() bool { return isPublished(hdrRegion.Data()) })
+	size, err := tableSize(hdrRegion.Data())
+	hdrRegion.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open shared state")
+	}
+	if obj.Size() < int64(size) {
+		return nil, errors.New("shared state is smaller, than the map needs")
+	}
+	result := &SharedMap{name: name}
+	defer func() {
+		sharedMapCleanup(result, false, err)
+	}()
+	if result.region, err = mmf.NewMemoryRegion(obj, mmf.MEM_READWRITE, 0, size); err != nil {
+		return nil, errors.Wrap(err, "failed to create shm region")
+	}
+	if result.table, err = openSharedTable(result.region.Data()); err != nil {
+		return nil, errors.Wrap(err, "failed to open shared state")
+	}
+	if err = result.openLockers(false, 0666); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DestroySharedMap permanently removes a map with the given name.
+func DestroySharedMap(name string) error {
+	obj, err := shm.NewMemoryObject(sharedMapStateName(name), os.O_RDONLY, 0666)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil
+		}
+		return errors.Wrap(err, "failed to open shm object")
+	}
+	stripes := DefaultStripes
+	if region, err := mmf.NewMemoryRegion(obj, mmf.MEM_READ_ONLY, 0, mapHdrSize); err == nil {
+		stripes = int((*mapHdr)(allocator.ByteSliceData(region.Data())).stripes)
+		region.Close()
+	}
+	obj.Close()
+	var result error
+	for i := 0; i < stripes; i++ {
+		if err := ipc_sync.DestroyRWMutex(sharedMapLockerName(name, i)); err != nil && result == nil {
+			result = errors.Wrap(err, "failed to destroy stripe locker")
+		}
+	}
+	if err := shm.DestroyMemoryObject(sharedMapStateName(name)); err != nil && result == nil {
+		result = errors.Wrap(err, "failed to destroy memory object")
+	}
+	return result
+}
+
+// Get returns a copy of the value stored for the key, and true, if the key exists.
+func (m *SharedMap) Get(key []byte) ([]byte, bool) {
+	if len(key) > int(m.table.hdr.maxKeySize) {
+		return nil, false
+	}
+	hash := hashKey(key)
+	stripe := m.table.stripeForHash(hash)
+	m.lockers[stripe].RLock()
+	found, _ := m.table.find(stripe, hash, key)
+	var result []byte
+	if found != nil {
+		result = append([]byte(nil), m.table.slotValue(found)...)
+	}
+	m.lockers[stripe].RUnlock()
+	return result, found != nil
+}
+
+// Put sets the value for the key. It returns ErrMapFull, if there is no room for a new key.
+func (m *SharedMap) Put(key, value []byte) error {
+	if len(key) > int(m.table.hdr.maxKeySize) {
+		return errors.New("the key is too big")
+	}
+	if len(value) > int(m.table.hdr.maxValueSize) {
+		return errors.New("the value is too big")
+	}
+	hash := hashKey(key)
+	stripe := m.table.stripeForHash(hash)
+	m.lockers[stripe].Lock()
+	ok := m.table.put(stripe, hash, key, value)
+	m.lockers[stripe].Unlock()
+	if !ok {
+		return ErrMapFull
+	}
+	return nil
+}
+
+// Delete removes the key from the map. It returns true, if the key existed.
+func (m *SharedMap) Delete(key []byte) bool {
+	if len(key) > int(m.table.hdr.maxKeySize) {
+		return false
+	}
+	hash := hashKey(key)
+	stripe := m.table.stripeForHash(hash)
+	m.lockers[stripe].Lock()
+	removed := m.table.remove(stripe, hash, key)
+	m.lockers[stripe].Unlock()
+	return removed
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+// The map is locked for reading one stripe at a time, so Range does not
+// necessarily correspond to any consistent snapshot of the map.
+// Key and value slices are copies and can be retained by f.
+func (m *SharedMap) Range(f func(key, value []byte) bool) {
+	type entry struct{ key, value []byte }
+	var entries []entry
+	for stripe := range m.lockers {
+		entries = entries[:0]
+		m.lockers[stripe].RLock()
+		for i := 0; i < int(m.table.hdr.stripeSlots); i++ {
+			if slot := m.table.slotAt(stripe, i); slot.state == slotUsed {
+				entries = append(entries, entry{
+					key:   append([]byte(nil), m.table.slotKey(slot)...),
+					value: append([]byte(nil), m.table.slotValue(slot)...),
+				})
+			}
+		}
+		m.lockers[stripe].RUnlock()
+		for _, e := range entries {
+			if !f(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// Len returns the number of entries in the map.
+func (m *SharedMap) Len() int {
+	return m.table.len()
+}
+
+// Cap returns the total number of slots in the map.
+func (m *SharedMap) Cap() int {
+	return int(m.table.hdr.stripes * m.table.hdr.stripeSlots)
+}
+
+// MaxKeySize returns the maximum key size.
+func (m *SharedMap) MaxKeySize() int {
+	return int(m.table.hdr.maxKeySize)
+}
+
+// MaxValueSize returns the maximum value size.
+func (m *SharedMap) MaxValueSize() int {
+	return int(m.table.hdr.maxValueSize)
+}
+
+// Close closes the map instance.
+func (m *SharedMap) Close() error {
+	var result error
+	for _, l := range m.lockers {
+		if err := l.Close(); err != nil && result == nil {
+			result = errors.Wrap(err, "failed to close stripe locker")
+		}
+	}
+	if err := m.region.Close(); err != nil && result == nil {
+		result = errors.Wrap(err, "failed to close memory region")
+	}
+	return result
+}
+
+// Destroy closes the map and removes it permanently.
+func (m *SharedMap) Destroy() error {
+	e1, e2 := m.Close(), DestroySharedMap(m.name)
+	if e1 != nil {
+		return errors.Wrap(e1, "failed to close the map")
+	}
+	if e2 != nil {
+		return errors.Wrap(e2, "failed to destroy the map")
+	}
+	return nil
+}
+
+func (m *SharedMap) openLockers(created bool, perm os.FileMode) error {
+	stripes := int(m.table.hdr.stripes)
+	for i := 0; i < stripes; i++ {
+		name := sharedMapLockerName(m.name, i)
+		// cleanup previous locker instances, see openFastMq for details.
+		if created {
+			if err := ipc_sync.DestroyRWMutex(name); err != nil {
+				return errors.Wrap(err, "failed to access a stripe locker")
+			}
+		}
+		l, err := ipc_sync.NewRWMutex(name, os.O_CREATE, perm)
+		if err != nil {
+			return errors.Wrap(err, "failed to create a stripe locker")
+		}
+		m.lockers = append(m.lockers, l)
+	}
+	return nil
+}
+
+func sharedMapCleanup(m *SharedMap, created bool, err error) {
+	if err == nil {
+		return
+	}
+	for i, l := range m.lockers {
+		l.Close()
+		if created {
+			ipc_sync.DestroyRWMutex(sharedMapLockerName(m.name, i))
+		}
+	}
+	if m.region != nil {
+		m.region.Close()
+	}
+	if created {
+		shm.DestroyMemoryObject(sharedMapStateName(m.name))
+	}
+}
+
+func sharedMapStateName(name string) string {
+	return name + ".hm"
+}
+
+func sharedMapLockerName(name string, stripe int) string {
+	return name + ".hm" + strconv.Itoa(stripe)
+}
@@ -0,0 +1,226 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package hashmap
+
+import (
+	"bytes"
+	"hash/fnv"
+	"sync/atomic"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"github.com/pkg/errors"
+)
+
+const (
+	mapMagic   = 0x4d484947
+	mapVersion = 1
+
+	mapHdrSize  = int(unsafe.Sizeof(mapHdr{}))
+	slotHdrSize = int(unsafe.Sizeof(slotHdr{}))
+
+	slotEmpty   = 0
+	slotUsed    = 1
+	slotDeleted = 2
+)
+
+type mapHdr struct {
+	magic        uint32
+	version      uint32
+	stripeSlots  uint32
+	stripes      uint32
+	maxKeySize   uint32
+	maxValueSize uint32
+	slotSize     uint32
+	reserved     uint32
+}
+
+type slotHdr struct {
+	state    uint32
+	hash     uint32
+	keyLen   uint32
+	valueLen uint32
+}
+
+// sharedTable is an open-addressing table over a raw memory block.
+// it does not perform any synchronization, the caller must lock the stripe.
+type sharedTable struct {
+	hdr    *mapHdr
+	counts []int32
+	slots  unsafe.Pointer
+}
+
+func align8(size int) int {
+	return (size + 7) &^ 7
+}
+
+func calcSlotSize(maxKeySize, maxValueSize int) int {
+	return align8(slotHdrSize + maxKeySize + maxValueSize)
+}
+
+func calcCountersSize(stripes int) int {
+	return align8(stripes * 4)
+}
+
+// calcMapSize returns the number of bytes needed to place the table into memory.
+func calcMapSize(stripes, stripeSlots, maxKeySize, maxValueSize int) int {
+	return mapHdrSize + calcCountersSize(stripes) + stripes*stripeSlots*calcSlotSize(maxKeySize, maxValueSize)
+}
+
+// newSharedTable initializes a new table. The table can't be opened by others, until it is published.
+func newSharedTable(data []byte, stripes, stripeSlots, maxKeySize, maxValueSize int) *sharedTable {
+	raw := allocator.ByteSliceData(data)
+	hdr := (*mapHdr)(raw)
+	*hdr = mapHdr{
+		version:      mapVersion,
+		stripeSlots:  uint32(stripeSlots),
+		stripes:      uint32(stripes),
+		maxKeySize:   uint32(maxKeySize),
+		maxValueSize: uint32(maxValueSize),
+		slotSize:     uint32(calcSlotSize(maxKeySize, maxValueSize)),
+	}
+	result := openTableData(raw)
+	for i := range result.counts {
+		result.counts[i] = 0
+	}
+	// the memory of a newly created object is zeroed, so all slots are empty.
+	return result
+}
+
+// publish writes the magic value, which makes the table visible to openers.
+func (t *sharedTable) publish() {
+	atomic.StoreUint32(&t.hdr.magic, mapMagic)
+}
+
+// isPublished returns true, if the header at data has been published by the creator.
+func isPublished(data []byte) bool {
+	return atomic.LoadUint32(&(*mapHdr)(allocator.ByteSliceData(data)).magic) != 0
+}
+
+// tableSize returns the size of the table described by the header at data, or an error, if the header is invalid.
+func tableSize(data []byte) (int, error) {
+	hdr := (*mapHdr)(allocator.ByteSliceData(data))
+	if hdr.magic != mapMagic {
+		return 0, errors.New("shared state is not a hash map")
+	}
+	if hdr.version != mapVersion {
+		return 0, errors.Errorf("unsupported hash map layout version %d", hdr.version)
+	}
+	if hdr.stripes == 0 || hdr.slotSize != uint32(calcSlotSize(int(hdr.maxKeySize), int(hdr.maxValueSize))) {
+		return 0, errors.New("invalid hash map header")
+	}
+	return calcMapSize(int(hdr.stripes), int(hdr.stripeSlots), int(hdr.maxKeySize), int(hdr.maxValueSize)), nil
+}
+
+// openSharedTable checks the header and opens an existing table.
+func openSharedTable(data []byte) (*sharedTable, error) {
+	if len(data) < mapHdrSize {
+		return nil, errors.New("shared state is too small")
+	}
+	size, err := tableSize(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < size {
+		return nil, errors.New("shared state is smaller, than the map needs")
+	}
+	return openTableData(allocator.ByteSliceData(data)), nil
+}
+
+func openTableData(raw unsafe.Pointer) *sharedTable {
+	hdr := (*mapHdr)(raw)
+	stripes := int(hdr.stripes)
+	countsRaw := allocator.AdvancePointer(raw, uintptr(mapHdrSize))
+	return &sharedTable{
+		hdr:    hdr,
+		counts: *(*[]int32)(allocator.RawSliceFromUnsafePointer(countsRaw, stripes, stripes)),
+		slots:  allocator.AdvancePointer(countsRaw, uintptr(calcCountersSize(stripes))),
+	}
+}
+
+func hashKey(key []byte) uint32 {
+	h := fnv.New32a()
+	h.Write(key)
+	return h.Sum32()
+}
+
+func (t *sharedTable) stripeForHash(hash uint32) int {
+	return int(hash % t.hdr.stripes)
+}
+
+func (t *sharedTable) slotAt(stripe, idx int) *slotHdr {
+	pos := uintptr(stripe*int(t.hdr.stripeSlots)+idx) * uintptr(t.hdr.slotSize)
+	return (*slotHdr)(allocator.AdvancePointer(t.slots, pos))
+}
+
+func (t *sharedTable) slotKey(slot *slotHdr) []byte {
+	raw := allocator.AdvancePointer(unsafe.Pointer(slot), uintptr(slotHdrSize))
+	return allocator.ByteSliceFromUnsafePointer(raw, int(slot.keyLen), int(t.hdr.maxKeySize))
+}
+
+func (t *sharedTable) slotValue(slot *slotHdr) []byte {
+	raw := allocator.AdvancePointer(unsafe.Pointer(slot), uintptr(slotHdrSize)+uintptr(t.hdr.maxKeySize))
+	return allocator.ByteSliceFromUnsafePointer(raw, int(slot.valueLen), int(t.hdr.maxValueSize))
+}
+
+// find looks for the key in the stripe.
+// it returns the slot with the key, if it exists, and the first slot,
+// which can be used to insert the key otherwise.
+func (t *sharedTable) find(stripe int, hash uint32, key []byte) (found, free *slotHdr) {
+	n := int(t.hdr.stripeSlots)
+	start := int((hash / t.hdr.stripes) % uint32(n))
+	for i := 0; i < n; i++ {
+		slot := t.slotAt(stripe, (start+i)%n)
+		switch slot.state {
+		case slotEmpty:
+			if free == nil {
+				free = slot
+			}
+			return nil, free
+		case slotDeleted:
+			if free == nil {
+				free = slot
+			}
+		case slotUsed:
+			if slot.hash == hash && bytes.Equal(t.slotKey(slot), key) {
+				return slot, nil
+			}
+		}
+	}
+	return nil, free
+}
+
+func (t *sharedTable) put(stripe int, hash uint32, key, value []byte) bool {
+	found, free := t.find(stripe, hash, key)
+	if found == nil {
+		if free == nil {
+			return false
+		}
+		found = free
+		found.hash = hash
+		found.keyLen = uint32(copy(t.slotKey(found)[:len(key)], key))
+		atomic.AddInt32(&t.counts[stripe], 1)
+	}
+	found.valueLen = uint32(copy(t.slotValue(found)[:len(value)], value))
+	found.state = slotUsed
+	return true
+}
+
+func (t *sharedTable) remove(stripe int, hash uint32, key []byte) bool {
+	found, _ := t.find(stripe, hash, key)
+	if found == nil {
+		return false
+	}
+	found.state = slotDeleted
+	found.keyLen, found.valueLen = 0, 0
+	atomic.AddInt32(&t.counts[stripe], -1)
+	return true
+}
+
+func (t *sharedTable) len() int {
+	var result int
+	for i := range t.counts {
+		result += int(atomic.LoadInt32(&t.counts[i]))
+	}
+	return result
+}
@@ -0,0 +1,275 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package hashmap
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testMapName = "go-ipc.hm-test"
+)
+
+func TestSharedMapCreate(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySharedMap(testMapName)) {
+		return
+	}
+	_, err := CreateSharedMap(testMapName, os.O_CREATE, 0666, 0, 8, 8)
+	a.Error(err)
+	m, err := CreateSharedMap(testMapName, os.O_CREATE|os.O_EXCL, 0666, 100, 8, 16)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(m.Destroy())
+	}()
+	a.True(m.Cap() >= 100)
+	a.Equal(8, m.MaxKeySize())
+	a.Equal(16, m.MaxValueSize())
+	_, err = CreateSharedMap(testMapName, os.O_CREATE|os.O_EXCL, 0666, 100, 8, 16)
+	a.Error(err)
+	m2, err := OpenSharedMap(testMapName)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(m.Cap(), m2.Cap())
+	a.Equal(16, m2.MaxValueSize())
+	a.NoError(m2.Close())
+}
+
+func TestSharedMapOpenLayout(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySharedMap(testMapName)) {
+		return
+	}
+	m, err := CreateSharedMap(testMapName, os.O_CREATE|os.O_EXCL, 0666, 16, 8, 8)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(m.Destroy())
+	}()
+	// the layout of an existing map does not depend on the parameters of the opener.
+	m2, err := CreateSharedMap(testMapName, os.O_CREATE, 0666, 1024, 64, 64)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(m.Cap(), m2.Cap())
+	a.Equal(8, m2.MaxKeySize())
+	a.Equal(8, m2.MaxValueSize())
+	a.NoError(m2.Close())
+}
+
+func TestSharedMapCreateConcurrent(t *testing.T) {
+	const jobs = 8
+	a := assert.New(t)
+	if !a.NoError(DestroySharedMap(testMapName)) {
+		return
+	}
+	var wg sync.WaitGroup
+	maps := make([]*SharedMap, jobs)
+	for job := 0; job < jobs; job++ {
+		wg.Add(1)
+		go func(job int) {
+			defer wg.Done()
+			m, err := CreateSharedMap(testMapName, os.O_CREATE, 0666, 64, 8, 8)
+			if a.NoError(err) {
+				a.NoError(m.Put([]byte(strconv.Itoa(job)), []byte("value")))
+				maps[job] = m
+			}
+		}(job)
+	}
+	wg.Wait()
+	for _, m := range maps {
+		if m != nil {
+			a.Equal(jobs, m.Len())
+			a.NoError(m.Close())
+		}
+	}
+	a.NoError(DestroySharedMap(testMapName))
+}
+
+func TestSharedMapPutGetDelete(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySharedMap(testMapName)) {
+		return
+	}
+	m, err := CreateSharedMap(testMapName, os.O_CREATE|os.O_EXCL, 0666, 64, 8, 8)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(m.Destroy())
+	}()
+	a.NoError(m.Put([]byte("key1"), []byte("value1")))
+	a.NoError(m.Put([]byte("key2"), []byte("value2")))
+	a.Error(m.Put([]byte("too long key"), []byte("value")))
+	a.Error(m.Put([]byte("key3"), []byte("too long value")))
+	a.Equal(2, m.Len())
+	value, ok := m.Get([]byte("key1"))
+	a.True(ok)
+	a.Equal([]byte("value1"), value)
+	a.NoError(m.Put([]byte("key1"), []byte("v")))
+	value, ok = m.Get([]byte("key1"))
+	a.True(ok)
+	a.Equal([]byte("v"), value)
+	a.Equal(2, m.Len())
+	a.True(m.Delete([]byte("key1")))
+	a.False(m.Delete([]byte("key1")))
+	_, ok = m.Get([]byte("key1"))
+	a.False(ok)
+	a.Equal(1, m.Len())
+	value, ok = m.Get([]byte("key2"))
+	a.True(ok)
+	a.Equal([]byte("value2"), value)
+	a.NoError(m.Put([]byte{}, []byte{}))
+	value, ok = m.Get([]byte{})
+	a.True(ok)
+	a.Len(value, 0)
+}
+
+func TestSharedMapFull(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySharedMap(testMapName)) {
+		return
+	}
+	m, err := CreateSharedMap(testMapName, os.O_CREATE|os.O_EXCL, 0666, 16, 8, 8)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(m.Destroy())
+	}()
+	var inserted []string
+	for i := 0; ; i++ {
+		key := strconv.Itoa(i)
+		if err := m.Put([]byte(key), []byte(key)); err != nil {
+			a.Equal(ErrMapFull, err)
+			break
+		}
+		inserted = append(inserted, key)
+	}
+	a.Equal(len(inserted), m.Len())
+	a.True(m.Len() <= m.Cap())
+	for _, key := range inserted {
+		a.True(m.Delete([]byte(key)))
+	}
+	a.Equal(0, m.Len())
+	// the map must be usable after removing all the keys, as deleted slots are reused.
+	for _, key := range inserted {
+		a.NoError(m.Put([]byte(key), []byte(key)))
+	}
+	for _, key := range inserted {
+		value, ok := m.Get([]byte(key))
+		a.True(ok)
+		a.Equal([]byte(key), value)
+	}
+}
+
+func TestSharedMapRange(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySharedMap(testMapName)) {
+		return
+	}
+	m, err := CreateSharedMap(testMapName, os.O_CREATE|os.O_EXCL, 0666, 128, 8, 8)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(m.Destroy())
+	}()
+	expected := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		key, value := strconv.Itoa(i), strconv.Itoa(i*2)
+		expected[key] = value
+		a.NoError(m.Put([]byte(key), []byte(value)))
+	}
+	actual := make(map[string]string)
+	m.Range(func(key, value []byte) bool {
+		actual[string(key)] = string(value)
+		return true
+	})
+	a.Equal(expected, actual)
+	var count int
+	m.Range(func(key, value []byte) bool {
+		count++
+		return count < 10
+	})
+	a.Equal(10, count)
+}
+
+func TestSharedMapShared(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySharedMap(testMapName)) {
+		return
+	}
+	m, err := CreateSharedMap(testMapName, os.O_CREATE|os.O_EXCL, 0666, 1024, 16, 16)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(m.Destroy())
+	}()
+	const (
+		jobs = 8
+		keys = 100
+	)
+	var wg sync.WaitGroup
+	for job := 0; job < jobs; job++ {
+		wg.Add(1)
+		go func(job int) {
+			defer wg.Done()
+			other, err := OpenSharedMap(testMapName)
+			if !a.NoError(err) {
+				return
+			}
+			defer other.Close()
+			for i := 0; i < keys; i++ {
+				key := []byte(fmt.Sprintf("%d.%d", job, i))
+				a.NoError(other.Put(key, key))
+				value, ok := other.Get(key)
+				a.True(ok)
+				a.Equal(key, value)
+			}
+		}(job)
+	}
+	wg.Wait()
+	a.Equal(jobs*keys, m.Len())
+	for job := 0; job < jobs; job++ {
+		for i := 0; i < keys; i++ {
+			key := []byte(fmt.Sprintf("%d.%d", job, i))
+			value, ok := m.Get(key)
+			a.True(ok)
+			a.Equal(key, value)
+		}
+	}
+}
+
+func ExampleSharedMap() {
+	DestroySharedMap("map")
+	m, err := CreateSharedMap("map", os.O_CREATE|os.O_EXCL, 0666, 128, 32, 32)
+	if err != nil {
+		panic(err)
+	}
+	defer m.Destroy()
+	// another process can open the map by its name.
+	m2, err := OpenSharedMap("map")
+	if err != nil {
+		panic(err)
+	}
+	defer m2.Close()
+	if err = m.Put([]byte("service"), []byte("/tmp/service.sock")); err != nil {
+		panic(err)
+	}
+	value, ok := m2.Get([]byte("service"))
+	fmt.Println(string(value), ok)
+	// Output:
+	// /tmp/service.sock true
+}
@@ -0,0 +1,219 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// Package attach implements a shared table of processes, which use an ipc object.
+// It is used to count users of composite objects and to destroy them,
+// when the last user detaches.
+package attach
+
+import (
+	"os"
+	"sync/atomic"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
+	"bitbucket.org/avd/go-ipc/mmf"
+	"bitbucket.org/avd/go-ipc/shm"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxAttachments is the maximum number of simultaneous attachments to one object.
+	MaxAttachments = 128
+
+	flagDestroyOnClose = 1
+
+	tableSize = int(unsafe.Sizeof(table{}))
+)
+
+var (
+	// ErrDestroying is returned, when a process attaches to an object, which is being destroyed.
+	ErrDestroying = errors.New("the object is being destroyed")
+)
+
+// table is the shared state. each attachment occupies one slot with the pid of its process.
+// destroyer is the pid of the process, which is destroying the object.
+// zeroed memory is a valid empty table.
+type table struct {
+	flags          uint32
+	destroyer      uint32
+	destroyerStart uint64
+	slots          [MaxAttachments]slot
+}
+
+// slot identifies an attached process by its pid and start time, so that the reuse of its pid is detected.
+// start is 0, if it is unknown. it is set after the pid, and is reset before the pid is released.
+type slot struct {
+	pid    uint32
+	unused uint32
+	start  uint64
+}
+
+// Table is an attachment of the current process to a shared table.
+type Table struct {
+	region *mmf.MemoryRegion
+	t      *table
+	pid    uint32
+	start  uint64
+	slot   int
+}
+
+// Open opens or creates a table for an object with the given name and attaches to it.
+//	name - name of the object, which users are counted.
+//	perm - table's permission bits.
+func Open(name string, perm os.FileMode) (*Table, error) {
+	region, _, err := helper.CreateWritableRegion(tableName(name), os.O_CREATE, perm, tableSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create attach table")
+	}
+	result := &Table{
+		region: region,
+		t:      (*table)(allocator.ByteSliceData(region.Data())),
+		pid:    uint32(os.Getpid()),
+		slot:   -1,
+	}
+	result.start, _ = common.ProcessStartTime(os.Getpid())
+	if err = result.attach(); err != nil {
+		region.Close()
+		return nil, err
+	}
+	return result, nil
+}
+
+// Count returns the number of attachments, removing the ones of dead processes.
+func (t *Table) Count() int {
+	t.removeDead()
+	var result int
+	for i := range t.t.slots {
+		if atomic.LoadUint32(&t.t.slots[i].pid) != 0 {
+			result++
+		}
+	}
+	return result
+}
+
+// SetDestroyOnClose sets whether the object must be destroyed, when the last user detaches.
+// The setting is shared between all users of the object.
+func (t *Table) SetDestroyOnClose(enable bool) {
+	for {
+		flags := atomic.LoadUint32(&t.t.flags)
+		newFlags := flags &^ flagDestroyOnClose
+		if enable {
+			newFlags |= flagDestroyOnClose
+		}
+		if atomic.CompareAndSwapUint32(&t.t.flags, flags, newFlags) {
+			return
+		}
+	}
+}
+
+// DestroyOnClose returns true, if the object is destroyed, when the last user detaches.
+func (t *Table) DestroyOnClose() bool {
+	return atomic.LoadUint32(&t.t.flags)&flagDestroyOnClose != 0
+}
+
+// Detach removes the attachment of the current process and closes the table.
+// It returns true, if the caller was the last user of an object with destroy-on-close mode.
+// In this case the object is marked as being destroyed, and the caller must destroy it.
+func (t *Table) Detach() (bool, error) {
+	if t.region == nil {
+		return false, nil
+	}
+	t.release(t.slot)
+	var last bool
+	if t.DestroyOnClose() && t.Count() == 0 && atomic.CompareAndSwapUint32(&t.t.destroyer, 0, t.pid) {
+		atomic.StoreUint64(&t.t.destroyerStart, t.start)
+		// someone could have attached between the check and the state change.
+		// as they check the state after taking a slot, either they see it, or we see the slot.
+		if last = t.Count() == 0; !last {
+			atomic.StoreUint64(&t.t.destroyerStart, 0)
+			atomic.StoreUint32(&t.t.destroyer, 0)
+		}
+	}
+	err := t.region.Close()
+	t.region, t.t = nil, nil
+	return last, err
+}
+
+// Destroy removes the table of the object with the given name.
+func Destroy(name string) error {
+	return shm.DestroyMemoryObject(tableName(name))
+}
+
+// SetPermissions changes the mode and the ownership of the table of the object with the given name.
+// If the table does not exist, nothing is done.
+func SetPermissions(name string, perm ipcperm.Permissions) error {
+	if err := shm.SetPermissions(tableName(name), perm); err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return err
+	}
+	return nil
+}
+
+func (t *Table) attach() error {
+	for retry := 0; retry < 2; retry++ {
+		for i := range t.t.slots {
+			if !atomic.CompareAndSwapUint32(&t.t.slots[i].pid, 0, t.pid) {
+				continue
+			}
+			atomic.StoreUint64(&t.t.slots[i].start, t.start)
+			if t.destroying() {
+				t.release(i)
+				return ErrDestroying
+			}
+			t.slot = i
+			return nil
+		}
+		t.removeDead()
+	}
+	return errors.New("too many attachments")
+}
+
+// destroying returns true, if the object is being destroyed by a living process.
+// if the destroyer has died, the object is considered alive.
+func (t *Table) destroying() bool {
+	pid := atomic.LoadUint32(&t.t.destroyer)
+	if pid == 0 {
+		return false
+	}
+	start := atomic.LoadUint64(&t.t.destroyerStart)
+	if atomic.LoadUint32(&t.t.destroyer) != pid || common.ProcessAlive(int(pid), start) {
+		return true
+	}
+	// reset the start time first, so that no one compares it with the pid of the next destroyer.
+	if atomic.CompareAndSwapUint64(&t.t.destroyerStart, start, 0) {
+		atomic.CompareAndSwapUint32(&t.t.destroyer, pid, 0)
+	}
+	return false
+}
+
+// removeDead frees slots of the processes, which no longer exist.
+func (t *Table) removeDead() {
+	for i := range t.t.slots {
+		s := &t.t.slots[i]
+		pid := atomic.LoadUint32(&s.pid)
+		if pid == 0 || pid == t.pid {
+			continue
+		}
+		start := atomic.LoadUint64(&s.start)
+		if atomic.LoadUint32(&s.pid) != pid || common.ProcessAlive(int(pid), start) {
+			continue
+		}
+		// reset the start time first, so that no one compares it with the pid of the next owner.
+		if atomic.CompareAndSwapUint64(&s.start, start, 0) {
+			atomic.CompareAndSwapUint32(&s.pid, pid, 0)
+		}
+	}
+}
+
+// release frees a slot, taken by the current process.
+func (t *Table) release(slot int) {
+	atomic.StoreUint64(&t.t.slots[slot].start, 0)
+	atomic.StoreUint32(&t.t.slots[slot].pid, 0)
+}
+
+func tableName(name string) string {
+	return name + ".at"
+}
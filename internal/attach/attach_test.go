@@ -0,0 +1,123 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package attach
+
+import (
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"testing"
+
+	"bitbucket.org/avd/go-ipc/internal/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testTableName = "go-ipc-attach-test"
+)
+
+// deadPid returns a pid of a process, which has already exited.
+func deadPid(a *assert.Assertions) uint32 {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if !a.NoError(cmd.Run()) {
+		return 0
+	}
+	return uint32(cmd.Process.Pid)
+}
+
+func TestAttachCount(t *testing.T) {
+	a := assert.New(t)
+	a.NoError(Destroy(testTableName))
+	defer Destroy(testTableName)
+	t1, err := Open(testTableName, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	t2, err := Open(testTableName, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(2, t1.Count())
+	last, err := t1.Detach()
+	a.NoError(err)
+	a.False(last)
+	a.Equal(1, t2.Count())
+	last, err = t2.Detach()
+	a.NoError(err)
+	a.False(last)
+}
+
+func TestAttachDestroyOnClose(t *testing.T) {
+	a := assert.New(t)
+	a.NoError(Destroy(testTableName))
+	defer Destroy(testTableName)
+	t1, err := Open(testTableName, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	t2, err := Open(testTableName, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	a.False(t2.DestroyOnClose())
+	t1.SetDestroyOnClose(true)
+	a.True(t2.DestroyOnClose())
+	last, err := t1.Detach()
+	a.NoError(err)
+	a.False(last)
+	last, err = t2.Detach()
+	a.NoError(err)
+	a.True(last)
+	_, err = Open(testTableName, 0666)
+	a.Equal(ErrDestroying, err)
+}
+
+func TestAttachRemoveDead(t *testing.T) {
+	a := assert.New(t)
+	a.NoError(Destroy(testTableName))
+	defer Destroy(testTableName)
+	tbl, err := Open(testTableName, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer tbl.Detach()
+	pid := deadPid(a)
+	if pid == 0 {
+		return
+	}
+	atomic.StoreUint32(&tbl.t.slots[MaxAttachments-1].pid, pid)
+	a.Equal(1, tbl.Count())
+	atomic.StoreUint32(&tbl.t.destroyer, pid)
+	a.False(tbl.destroying())
+}
+
+func TestAttachPidReused(t *testing.T) {
+	a := assert.New(t)
+	pid := os.Getppid()
+	start, ok := common.ProcessStartTime(pid)
+	if !ok {
+		t.Skip("process start time is not supported")
+	}
+	a.NoError(Destroy(testTableName))
+	defer Destroy(testTableName)
+	tbl, err := Open(testTableName, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer tbl.Detach()
+	// the process is alive.
+	s := &tbl.t.slots[MaxAttachments-1]
+	atomic.StoreUint32(&s.pid, uint32(pid))
+	atomic.StoreUint64(&s.start, start)
+	a.Equal(2, tbl.Count())
+	atomic.StoreUint32(&tbl.t.destroyer, uint32(pid))
+	atomic.StoreUint64(&tbl.t.destroyerStart, start)
+	a.True(tbl.destroying())
+	// the process has died, and its pid has been reused by another process.
+	atomic.StoreUint64(&s.start, start+1)
+	a.Equal(1, tbl.Count())
+	atomic.StoreUint64(&tbl.t.destroyerStart, start+1)
+	a.False(tbl.destroying())
+	a.Equal(uint32(0), atomic.LoadUint32(&tbl.t.destroyer))
+}
@@ -13,6 +13,9 @@ const (
 	// O_NONBLOCK flag tell some functions not to block.
 	// Its value does not interfere with O_* constants from 'os' package.
 	O_NONBLOCK = syscall.O_NONBLOCK
+
+	// ReadyTimeout is the time an opener of a shared object waits for the creator to initialize it.
+	ReadyTimeout = 5 * time.Second
 )
 
 // Destroyer is an object which can be permanently removed.
@@ -97,3 +100,32 @@ func CallTimeout(f func(time.Duration) bool, timeout time.Duration) {
 		}
 	}
 }
+
+// WaitReady calls ready with growing delays, until it returns true, or ReadyTimeout expires.
+// It is used by the openers of shared objects, which must not access the shared state,
+// until the creator has initialized and published it.
+// Returns the last value returned by ready.
+func WaitReady(ready func() bool) bool {
+	deadline := time.Now().Add(ReadyTimeout)
+	for delay := 10 * time.Microsecond; !ready(); {
+		if time.Now().After(deadline) {
+			return ready()
+		}
+		time.Sleep(delay)
+		if delay < 10*time.Millisecond {
+			delay *= 2
+		}
+	}
+	return true
+}
+
+// ProcessAlive returns true, if the process with the given pid and start time exists.
+// If the start time is unknown (0), or can't be obtained on the current platform, only the pid is checked.
+func ProcessAlive(pid int, start uint64) bool {
+	if start != 0 {
+		if current, ok := ProcessStartTime(pid); ok {
+			return current == start
+		}
+	}
+	return ProcessExists(pid)
+}
@@ -137,3 +137,10 @@ func IsTimeoutErr(err error) bool {
 func NewTimeoutError(op string) error {
 	return os.NewSyscallError(op, unix.EAGAIN)
 }
+
+// ProcessExists returns true, if there is a process with the given pid.
+// A process, which we are not allowed to signal, still exists.
+func ProcessExists(pid int) bool {
+	err := unix.Kill(pid, 0)
+	return err == nil || err == unix.EPERM
+}
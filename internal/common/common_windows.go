@@ -5,10 +5,15 @@ package common
 import (
 	"os"
 	"syscall"
+
+	"golang.org/x/sys/windows"
 )
 
 const (
 	cERROR_TIMEOUT = syscall.Errno(1460)
+
+	cPROCESS_QUERY_LIMITED_INFORMATION = 0x1000
+	cSTILL_ACTIVE                      = 259
 )
 
 // IsTimeoutErr returns true, if the given error is a temporary syscall error.
@@ -25,3 +30,18 @@ func IsTimeoutErr(err error) bool {
 func NewTimeoutError(op string) error {
 	return os.NewSyscallError(op, cERROR_TIMEOUT)
 }
+
+// ProcessExists returns true, if there is a running process with the given pid.
+// A process, which we are not allowed to open, still exists.
+func ProcessExists(pid int) bool {
+	handle, err := windows.OpenProcess(cPROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return err != windows.ERROR_INVALID_PARAMETER
+	}
+	defer windows.CloseHandle(handle)
+	var code uint32
+	if err = windows.GetExitCodeProcess(handle, &code); err != nil {
+		return true
+	}
+	return code == cSTILL_ACTIVE
+}
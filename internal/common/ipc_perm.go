@@ -0,0 +1,83 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build darwin freebsd linux
+
+package common
+
+import (
+	"os"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// IpcDsSize is the size of a buffer, which is large enough to hold msqid_ds or semid_ds.
+const IpcDsSize = 256
+
+// IpcCtlFunc is a function, that calls msgctl or semctl for an object with the given command and buffer.
+type IpcCtlFunc func(cmd int, ds unsafe.Pointer) error
+
+// SetIpcPermissions changes the mode and the ownership of a System V ipc object.
+// The ownership and the mode of the object's key file are changed as well,
+// so that other users could generate the key.
+//	name - object name.
+//	ctl - a function, which calls msgctl or semctl for the object.
+//	mode - new mode. zero value means, that the mode is not changed.
+//	uid, gid - new owner and group. -1 means, that the value is not changed.
+func SetIpcPermissions(name string, ctl IpcCtlFunc, mode os.FileMode, uid, gid int) error {
+	var ds [IpcDsSize]byte
+	pDs := unsafe.Pointer(&ds[0])
+	if err := ctl(IpcStat, pDs); err != nil {
+		return errors.Wrap(err, "failed to get ipc_perm")
+	}
+	if mode != 0 {
+		*(*uint16)(unsafe.Pointer(&ds[ipcPermModeOffset])) = uint16(mode.Perm())
+	}
+	if uid != -1 {
+		setIpcPermID(ds[ipcPermUIDOffset:], uid)
+	}
+	if gid != -1 {
+		setIpcPermID(ds[ipcPermGIDOffset:], gid)
+	}
+	if err := ctl(IpcSet, pDs); err != nil {
+		return errors.Wrap(err, "failed to set ipc_perm")
+	}
+	keyFile := TmpFilename(name)
+	if mode != 0 {
+		if err := os.Chmod(keyFile, mode.Perm()&0666); err != nil {
+			return errors.Wrap(err, "failed to change key file mode")
+		}
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(keyFile, uid, gid); err != nil {
+			return errors.Wrap(err, "failed to change key file owner")
+		}
+	}
+	return nil
+}
+
+// GetIpcPermissions returns the mode and the ownership of a System V ipc object.
+//	ctl - a function, which calls msgctl or semctl for the object.
+func GetIpcPermissions(ctl IpcCtlFunc) (mode os.FileMode, uid, gid int, err error) {
+	var ds [IpcDsSize]byte
+	if err = ctl(IpcStat, unsafe.Pointer(&ds[0])); err != nil {
+		return 0, 0, 0, errors.Wrap(err, "failed to get ipc_perm")
+	}
+	mode = os.FileMode(*(*uint16)(unsafe.Pointer(&ds[ipcPermModeOffset]))).Perm()
+	return mode, ipcPermID(ds[ipcPermUIDOffset:]), ipcPermID(ds[ipcPermGIDOffset:]), nil
+}
+
+func ipcPermID(data []byte) int {
+	if ipcPermIDSize == 2 {
+		return int(*(*uint16)(unsafe.Pointer(&data[0])))
+	}
+	return int(*(*uint32)(unsafe.Pointer(&data[0])))
+}
+
+func setIpcPermID(data []byte, id int) {
+	if ipcPermIDSize == 2 {
+		*(*uint16)(unsafe.Pointer(&data[0])) = uint16(id)
+	} else {
+		*(*uint32)(unsafe.Pointer(&data[0])) = uint32(id)
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package common
+
+// offsets of the fields in struct ipc_perm.
+const (
+	ipcPermUIDOffset  = 0
+	ipcPermGIDOffset  = 4
+	ipcPermModeOffset = 16
+	ipcPermIDSize     = 4
+)
@@ -0,0 +1,13 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package common
+
+// offsets of the fields in struct ipc_perm_old, which is used by
+// freebsd7_msgctl and freebsd7___semctl syscalls.
+// uid and gid are 16-bit values there.
+const (
+	ipcPermUIDOffset  = 4
+	ipcPermGIDOffset  = 6
+	ipcPermModeOffset = 8
+	ipcPermIDSize     = 2
+)
@@ -0,0 +1,11 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package common
+
+// offsets of the fields in struct ipc64_perm.
+const (
+	ipcPermUIDOffset  = 4
+	ipcPermGIDOffset  = 8
+	ipcPermModeOffset = 20
+	ipcPermIDSize     = 4
+)
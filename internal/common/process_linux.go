@@ -0,0 +1,35 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package common
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// ProcessStartTime returns the start time of the process with the given pid in clock ticks since boot.
+// Together with the pid it identifies the process, even if the pid has been reused.
+// Returns false, if the process does not exist, or the time can't be obtained.
+func ProcessStartTime(pid int) (uint64, bool) {
+	data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return 0, false
+	}
+	// the command name may contain spaces and parentheses, so skip it first.
+	stat := string(data)
+	idx := strings.LastIndexByte(stat, ')')
+	if idx < 0 {
+		return 0, false
+	}
+	// the fields after the name start with the 3rd one, and starttime is the 22nd.
+	fields := strings.Fields(stat[idx+1:])
+	if len(fields) < 20 {
+		return 0, false
+	}
+	result, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return result, true
+}
@@ -0,0 +1,10 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build !linux
+
+package common
+
+// ProcessStartTime is not supported on this platform, so it always returns false.
+func ProcessStartTime(pid int) (uint64, bool) {
+	return 0, false
+}
@@ -37,3 +37,40 @@ func CreateWritableRegion(name string, flag int, perm os.FileMode, size int) (*m
 	}
 	return region, created, nil
 }
+
+// CreateWritableRegionMinSize is the same as CreateWritableRegion, but an existing object
+// may be smaller, than size, if it was created by an earlier version with a smaller state.
+// Such object must not be smaller, than minSize, and is mapped entirely.
+func CreateWritableRegionMinSize(name string, flag int, perm os.FileMode, size, minSize int) (*mmf.MemoryRegion, bool, error) {
+	obj, created, resultErr := shm.NewMemoryObjectSize(name, flag, perm, 0)
+	if resultErr != nil {
+		return nil, false, errors.Wrap(resultErr, "failed to create shm object")
+	}
+	var region *mmf.MemoryRegion
+	defer func() {
+		obj.Close()
+		if resultErr == nil {
+			return
+		}
+		if region != nil {
+			region.Close()
+		}
+		if created {
+			obj.Destroy()
+		}
+	}()
+	if created {
+		if resultErr = obj.Truncate(int64(size)); resultErr != nil {
+			return nil, false, errors.Wrap(resultErr, "failed to truncate shm object")
+		}
+	} else if objSize := obj.Size(); objSize < int64(minSize) {
+		resultErr = errors.Errorf("existing object is smaller (%d), than needed(%d)", objSize, minSize)
+		return nil, false, resultErr
+	} else if objSize < int64(size) {
+		size = int(objSize)
+	}
+	if region, resultErr = mmf.NewMemoryRegion(obj, mmf.MEM_READWRITE, 0, size); resultErr != nil {
+		return nil, false, errors.Wrap(resultErr, "failed to create shm region")
+	}
+	return region, created, nil
+}
@@ -0,0 +1,4 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// Package ipcperm describes access rights of ipc objects.
+package ipcperm
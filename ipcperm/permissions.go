@@ -0,0 +1,68 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package ipcperm
+
+import (
+	"os"
+)
+
+// Permissions describe access rights of an ipc object.
+// They are applied after the object has been created,
+// so, unlike permissions passed to constructors, they are not affected by umask.
+// This allows processes running under different users to share objects.
+// The zero value does not change anything.
+type Permissions struct {
+	// Mode is the exact set of permission bits. If it is zero, the mode is not changed.
+	Mode os.FileMode
+	// UID is the new owner of the object. If it is nil, the owner is not changed.
+	UID *int
+	// GID is the new group of the object. If it is nil, the group is not changed.
+	GID *int
+}
+
+// Mode returns permissions, which set the exact mode and keep the ownership.
+func Mode(mode os.FileMode) Permissions {
+	return Permissions{Mode: mode}
+}
+
+// Owner returns permissions, which set the owner and the group and keep the mode.
+// If uid or gid is -1, the corresponding value is not changed.
+func Owner(uid, gid int) Permissions {
+	return Exact(0, uid, gid)
+}
+
+// Exact returns permissions, which set the mode, the owner and the group.
+// If mode is zero, or uid or gid is -1, the corresponding value is not changed.
+func Exact(mode os.FileMode, uid, gid int) Permissions {
+	result := Permissions{Mode: mode}
+	if uid != -1 {
+		result.UID = &uid
+	}
+	if gid != -1 {
+		result.GID = &gid
+	}
+	return result
+}
+
+// ChangesMode returns true, if the permissions change the mode of an object.
+func (p Permissions) ChangesMode() bool {
+	return p.Mode != 0
+}
+
+// ChangesOwner returns true, if the permissions change the owner or the group of an object.
+func (p Permissions) ChangesOwner() bool {
+	return p.UID != nil || p.GID != nil
+}
+
+// IDs returns the new owner and group in a form, which is accepted by chown.
+// If a value is not changed, -1 is returned for it.
+func (p Permissions) IDs() (uid, gid int) {
+	uid, gid = -1, -1
+	if p.UID != nil {
+		uid = *p.UID
+	}
+	if p.GID != nil {
+		gid = *p.GID
+	}
+	return
+}
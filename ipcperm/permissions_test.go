@@ -0,0 +1,33 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package ipcperm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermissions(t *testing.T) {
+	a := assert.New(t)
+	var zero Permissions
+	a.False(zero.ChangesMode())
+	a.False(zero.ChangesOwner())
+	uid, gid := zero.IDs()
+	a.Equal(-1, uid)
+	a.Equal(-1, gid)
+	p := Mode(0640)
+	a.True(p.ChangesMode())
+	a.False(p.ChangesOwner())
+	p = Owner(0, -1)
+	a.False(p.ChangesMode())
+	a.True(p.ChangesOwner())
+	uid, gid = p.IDs()
+	a.Equal(0, uid)
+	a.Equal(-1, gid)
+	p = Exact(0600, 10, 20)
+	a.True(p.ChangesMode())
+	uid, gid = p.IDs()
+	a.Equal(10, uid)
+	a.Equal(20, gid)
+}
@@ -0,0 +1,36 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// Package journal implements a crash-consistent append-only log on memory-mapped files.
+//
+// A log is a directory with segment files. Several processes can append records
+// to the log and read them. Appends are serialized by an interprocess mutex,
+// readers can wait for new records via an interprocess condition variable.
+// Each segment has a fixed size. When a record does not fit into the last segment,
+// a new segment is created and the old one is sealed.
+//
+// A record becomes visible to the readers, when the commit offset in the header
+// of its segment is updated. The data of the records is written before the commit offset,
+// and each record has a checksum, so after a crash, records after the commit offset
+// are ignored, and if the data of the committed records did not reach the disk,
+// the tail of the log is truncated to the last valid record, when the log is opened.
+// Use Sync to make the appended records durable.
+// On linux and freebsd the mutex is robust: if a process dies, holding it,
+// the next process, which locks the mutex, recovers the log the same way.
+//
+// Segment files are named after the log offset of their first record: %020d.seg.
+// Offsets are global for the log and increase monotonically.
+//
+// Segment layout.
+// All values are stored in the native byte order.
+//	header (64 bytes):
+//		0	uint32	magic, 0x4c4e524a ("JRNL")
+//		4	uint32	layout version, currently 1
+//		8	uint64	log offset of the first record of the segment
+//		16	uint64	commit offset, the end of the committed records from the beginning of the file
+//		24	uint32	1, if the segment is sealed, and no more records can be appended
+//		28	36 bytes reserved
+//	records, each record is padded to 8 bytes:
+//		0	uint32	payload length
+//		4	uint32	crc32 (Castagnoli) of the payload and its length
+//		8	payload bytes
+package journal
@@ -0,0 +1,349 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package journal
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ipc_sync "bitbucket.org/avd/go-ipc/sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultSegmentSize is the size of a segment file, if it is not specified.
+	DefaultSegmentSize = 16 * 1024 * 1024
+)
+
+var (
+	// ErrCorrupted is returned, when a record fails the checksum check.
+	ErrCorrupted = errors.New("the record is corrupted")
+)
+
+// Log is an append-only log, which can be shared between processes.
+type Log struct {
+	dir         string
+	perm        os.FileMode
+	segmentSize int
+	seg         *segment
+	locker      *logLocker
+	cond        *ipc_sync.Cond
+}
+
+// NewLog opens or creates a log in the given directory.
+//	dir - log directory. it is created, if it does not exist and os.O_CREATE is set.
+//	flag - flag is a combination of os.O_CREATE and os.O_EXCL.
+//	perm - permission bits for the directory, segment files and ipc objects.
+//	segmentSize - size of new segment files. if it is 0, DefaultSegmentSize is used.
+// The log is recovered when it is opened: the tail of the last segment,
+// which does not contain valid records, is truncated.
+func NewLog(dir string, flag int, perm os.FileMode, segmentSize int) (*Log, error) {
+	if segmentSize == 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	if segmentSize < segmentHdrSize+recordSize(1) {
+		return nil, errors.New("invalid segment size")
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get log path")
+	}
+	if flag&os.O_CREATE != 0 {
+		if err = os.MkdirAll(dir, perm|0700); err != nil {
+			return nil, errors.Wrap(err, "failed to create log directory")
+		}
+	}
+	bases, err := listSegments(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list segments")
+	}
+	if len(bases) == 0 && flag&os.O_CREATE == 0 {
+		return nil, errors.Wrap(os.ErrNotExist, "the log does not exist")
+	}
+	if len(bases) > 0 && flag&os.O_EXCL != 0 {
+		return nil, errors.Wrap(os.ErrExist, "the log already exists")
+	}
+	result := &Log{dir: dir, perm: perm, segmentSize: segmentSize}
+	if result.locker, err = newLogLocker(dir, perm, result.reopen); err != nil {
+		return nil, errors.Wrap(err, "failed to create a locker")
+	}
+	if result.cond, err = ipc_sync.NewCond(logCondName(dir), os.O_CREATE, perm, result.locker); err != nil {
+		result.locker.Close()
+		return nil, errors.Wrap(err, "failed to create a condvar")
+	}
+	if err = result.locker.lock(); err != nil {
+		result.Close()
+		return nil, errors.Wrap(err, "failed to lock the log")
+	}
+	err = result.reopen()
+	result.locker.Unlock()
+	if err != nil {
+		result.Close()
+		return nil, err
+	}
+	return result, nil
+}
+
+// DestroyLog permanently removes the log in the given directory.
+// The directory itself is removed, if it is empty.
+func DestroyLog(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to get log path")
+	}
+	var result error
+	if err := ipc_sync.DestroyCond(logCondName(dir)); err != nil {
+		result = errors.Wrap(err, "failed to destroy condvar")
+	}
+	if err := destroyLogLocker(dir); err != nil && result == nil {
+		result = errors.Wrap(err, "failed to destroy locker")
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return errors.Wrap(err, "failed to list segments")
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, segmentExt) || strings.HasSuffix(name, tempExt) {
+			if err := os.Remove(name); err != nil && result == nil {
+				result = errors.Wrap(err, "failed to remove segment")
+			}
+		}
+	}
+	os.Remove(dir)
+	return result
+}
+
+// Append appends a record to the log and returns its offset.
+// The record becomes visible to the readers immediately, but it is not durable until Sync is called.
+// If the record does not fit into the last segment, a new segment is created.
+func (l *Log) Append(payload []byte) (uint64, error) {
+	if recordSize(len(payload)) > l.segmentSize-segmentHdrSize {
+		return 0, errors.New("the record is too big")
+	}
+	if err := l.locker.lock(); err != nil {
+		return 0, errors.Wrap(err, "failed to lock the log")
+	}
+	defer l.locker.Unlock()
+	if err := l.follow(); err != nil {
+		return 0, err
+	}
+	if !l.seg.fits(len(payload)) {
+		if err := l.rollover(); err != nil {
+			return 0, err
+		}
+	}
+	pos := l.seg.append(payload)
+	l.cond.Broadcast()
+	return l.seg.offset(pos), nil
+}
+
+// Sync flushes the last segment of the log to the disk.
+func (l *Log) Sync() error {
+	if err := l.locker.lock(); err != nil {
+		return errors.Wrap(err, "failed to lock the log")
+	}
+	defer l.locker.Unlock()
+	if err := l.follow(); err != nil {
+		return err
+	}
+	return errors.Wrap(l.seg.flush(), "failed to flush the segment")
+}
+
+// End returns the offset, at which the next record will be appended.
+func (l *Log) End() (uint64, error) {
+	if err := l.locker.lock(); err != nil {
+		return 0, errors.Wrap(err, "failed to lock the log")
+	}
+	defer l.locker.Unlock()
+	if err := l.follow(); err != nil {
+		return 0, err
+	}
+	return l.seg.offset(l.seg.commit()), nil
+}
+
+// Close closes the log. It does not flush the data.
+func (l *Log) Close() error {
+	var result error
+	if l.seg != nil {
+		if err := l.seg.close(); err != nil {
+			result = errors.Wrap(err, "failed to close the segment")
+		}
+		l.seg = nil
+	}
+	if err := l.cond.Close(); err != nil && result == nil {
+		result = errors.Wrap(err, "failed to close condvar")
+	}
+	if err := l.locker.Close(); err != nil && result == nil {
+		result = errors.Wrap(err, "failed to close locker")
+	}
+	return result
+}
+
+// Destroy closes the log and removes it permanently.
+func (l *Log) Destroy() error {
+	e1, e2 := l.Close(), DestroyLog(l.dir)
+	if e1 != nil {
+		return errors.Wrap(e1, "failed to close the log")
+	}
+	if e2 != nil {
+		return errors.Wrap(e2, "failed to destroy the log")
+	}
+	return nil
+}
+
+// NewReader returns a reader, which reads the log starting from the given offset.
+// The offset must be 0, or an offset of a record, or the end of the log.
+func (l *Log) NewReader(offset uint64) (*Reader, error) {
+	bases, err := listSegments(l.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list segments")
+	}
+	if len(bases) == 0 {
+		return nil, errors.New("the log has no segments")
+	}
+	base := bases[0]
+	for _, b := range bases {
+		if b <= offset {
+			base = b
+		}
+	}
+	if offset < base {
+		offset = base
+	}
+	seg, err := openSegment(l.dir, base, false)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{log: l, seg: seg, pos: segmentHdrSize + int(offset-base)}, nil
+}
+
+// recover opens the last segment, or creates the first one.
+// it must be called with the log locked.
+func (l *Log) recover() error {
+	bases, err := listSegments(l.dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to list segments")
+	}
+	l.removeTemp()
+	if len(bases) == 0 {
+		l.seg, err = createSegment(l.dir, 0, l.segmentSize, l.perm)
+		return err
+	}
+	last := bases[len(bases)-1]
+	// a process could have crashed after the creation of a new segment, but before sealing the previous one.
+	if len(bases) > 1 {
+		if last, err = l.recoverPrev(bases[len(bases)-2], last); err != nil {
+			return err
+		}
+	}
+	if l.seg, err = openSegment(l.dir, last, true); err != nil {
+		return err
+	}
+	if l.seg.sealed() {
+		return l.follow()
+	}
+	if l.seg.recover() {
+		return errors.Wrap(l.seg.flush(), "failed to flush the segment")
+	}
+	return nil
+}
+
+// recoverPrev checks, that the last segment follows the previous one, and seals the previous segment.
+// if the last segment is an empty orphan, which was created by a process, that had crashed
+// before sealing the previous segment, while other processes kept appending to the previous one,
+// the orphan is removed. it returns the base of the segment, which is the last one after the recovery.
+func (l *Log) recoverPrev(prevBase, lastBase uint64) (uint64, error) {
+	prev, err := openSegment(l.dir, prevBase, true)
+	if err != nil {
+		return 0, err
+	}
+	defer prev.close()
+	if prev.nextBase() == lastBase {
+		if !prev.sealed() {
+			prev.seal()
+			prev.flush()
+		}
+		return lastBase, nil
+	}
+	if prev.sealed() || !l.removeOrphan(lastBase) {
+		return 0, errors.Errorf("segment %d does not follow segment %d", lastBase, prevBase)
+	}
+	return prevBase, nil
+}
+
+// removeOrphan removes the segment, if it has no records.
+func (l *Log) removeOrphan(base uint64) bool {
+	seg, err := openSegment(l.dir, base, false)
+	if err != nil {
+		return false
+	}
+	empty := seg.commit() == segmentHdrSize && !seg.sealed()
+	seg.close()
+	return empty && os.Remove(segmentPath(l.dir, base)) == nil
+}
+
+// reopen closes the current segment, if any, and recovers the log.
+// it is also called, when the previous owner of the lock died, holding it.
+// it must be called with the log locked.
+func (l *Log) reopen() error {
+	if l.seg != nil {
+		l.seg.close()
+		l.seg = nil
+	}
+	return l.recover()
+}
+
+// follow switches to the last segment, if the current one was sealed by another process.
+// it must be called with the log locked.
+func (l *Log) follow() error {
+	for l.seg.sealed() {
+		next, err := openSegment(l.dir, l.seg.nextBase(), true)
+		if err != nil {
+			return err
+		}
+		l.seg.close()
+		l.seg = next
+	}
+	return nil
+}
+
+// rollover seals the current segment and creates a new one.
+// it must be called with the log locked.
+func (l *Log) rollover() error {
+	next, err := createSegment(l.dir, l.seg.nextBase(), l.segmentSize, l.perm)
+	if err != nil {
+		return err
+	}
+	// the new segment must exist, when the readers see the seal.
+	l.seg.seal()
+	l.seg.flush()
+	l.seg.close()
+	l.seg = next
+	l.cond.Broadcast()
+	return nil
+}
+
+func (l *Log) removeTemp() {
+	names, _ := filepath.Glob(filepath.Join(l.dir, "*"+tempExt))
+	for _, name := range names {
+		os.Remove(name)
+	}
+}
+
+func logObjectName(dir string) string {
+	h := fnv.New64a()
+	h.Write([]byte(dir))
+	return fmt.Sprintf("go-ipc.jrnl.%x", h.Sum64())
+}
+
+func logLockerName(dir string) string {
+	return logObjectName(dir) + ".m"
+}
+
+func logCondName(dir string) string {
+	return logObjectName(dir) + ".c"
+}
@@ -0,0 +1,229 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package journal
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testSegmentSize = 4096
+)
+
+func makeTestLog() (*Log, string, error) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		return nil, "", err
+	}
+	l, err := NewLog(dir, os.O_CREATE|os.O_EXCL, 0666, testSegmentSize)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+	return l, dir, nil
+}
+
+func TestLogAppendRead(t *testing.T) {
+	a := assert.New(t)
+	l, dir, err := makeTestLog()
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	defer func() {
+		a.NoError(l.Destroy())
+	}()
+	_, err = NewLog(dir, os.O_CREATE|os.O_EXCL, 0666, testSegmentSize)
+	a.Error(err)
+	_, err = l.Append(make([]byte, testSegmentSize))
+	a.Error(err)
+	var offsets []uint64
+	for i := 0; i < 200; i++ {
+		off, err := l.Append([]byte(fmt.Sprintf("record %d", i)))
+		if !a.NoError(err) {
+			return
+		}
+		offsets = append(offsets, off)
+	}
+	a.NoError(l.Sync())
+	bases, err := listSegments(dir)
+	a.NoError(err)
+	a.True(len(bases) > 1)
+	r, err := l.NewReader(0)
+	if !a.NoError(err) {
+		return
+	}
+	defer r.Close()
+	for i := 0; i < 200; i++ {
+		a.Equal(offsets[i], r.Offset())
+		data, err := r.Next()
+		if !a.NoError(err) {
+			return
+		}
+		a.Equal(fmt.Sprintf("record %d", i), string(data))
+	}
+	_, err = r.Next()
+	a.Equal(io.EOF, err)
+	end, err := l.End()
+	a.NoError(err)
+	a.Equal(end, r.Offset())
+	r2, err := l.NewReader(offsets[150])
+	if !a.NoError(err) {
+		return
+	}
+	defer r2.Close()
+	data, err := r2.Next()
+	a.NoError(err)
+	a.Equal("record 150", string(data))
+}
+
+func TestLogTornTail(t *testing.T) {
+	a := assert.New(t)
+	l, dir, err := makeTestLog()
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	for i := 0; i < 3; i++ {
+		_, err = l.Append([]byte("record"))
+		a.NoError(err)
+	}
+	a.NoError(l.Close())
+	// damage the last record.
+	file, err := os.OpenFile(segmentPath(dir, 0), os.O_RDWR, 0)
+	if !a.NoError(err) {
+		return
+	}
+	_, err = file.WriteAt([]byte("garbage"), int64(segmentHdrSize+recordSize(6)*2+recordHdrSize))
+	a.NoError(err)
+	a.NoError(file.Close())
+	l, err = NewLog(dir, 0, 0666, testSegmentSize)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(l.Destroy())
+	}()
+	end, err := l.End()
+	a.NoError(err)
+	a.Equal(uint64(recordSize(6)*2), end)
+	off, err := l.Append([]byte("new"))
+	a.NoError(err)
+	a.Equal(end, off)
+	r, err := l.NewReader(0)
+	if !a.NoError(err) {
+		return
+	}
+	defer r.Close()
+	for _, expected := range []string{"record", "record", "new"} {
+		data, err := r.Next()
+		a.NoError(err)
+		a.Equal(expected, string(data))
+	}
+}
+
+func TestLogFollow(t *testing.T) {
+	a := assert.New(t)
+	l, dir, err := makeTestLog()
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	defer func() {
+		a.NoError(l.Destroy())
+	}()
+	r, err := l.NewReader(0)
+	if !a.NoError(err) {
+		return
+	}
+	defer r.Close()
+	a.False(r.Wait(50 * time.Millisecond))
+	const writers, records = 2, 100
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w, err := NewLog(dir, 0, 0666, testSegmentSize)
+			if !a.NoError(err) {
+				return
+			}
+			defer w.Close()
+			for j := 0; j < records; j++ {
+				_, err = w.Append([]byte("data"))
+				a.NoError(err)
+			}
+		}()
+	}
+	var received int
+	for received < writers*records {
+		if !a.True(r.Wait(5 * time.Second)) {
+			break
+		}
+		for {
+			data, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if !a.NoError(err) {
+				return
+			}
+			a.Equal("data", string(data))
+			received++
+		}
+	}
+	wg.Wait()
+	a.Equal(writers*records, received)
+}
+
+func TestLogOrphanedSegment(t *testing.T) {
+	a := assert.New(t)
+	l, dir, err := makeTestLog()
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	_, err = l.Append([]byte("record"))
+	a.NoError(err)
+	// a process created the next segment and crashed before sealing the current one.
+	orphan, err := createSegment(dir, l.seg.nextBase(), testSegmentSize, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(orphan.close())
+	// the other processes kept appending to the current segment.
+	_, err = l.Append([]byte("record"))
+	a.NoError(err)
+	a.NoError(l.Close())
+	l, err = NewLog(dir, 0, 0666, testSegmentSize)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(l.Destroy())
+	}()
+	bases, err := listSegments(dir)
+	a.NoError(err)
+	a.Equal([]uint64{0}, bases)
+	end, err := l.End()
+	a.NoError(err)
+	a.Equal(uint64(recordSize(6)*2), end)
+	// a segment with records, which does not follow the previous one, is not removed.
+	a.NoError(l.rollover())
+	seg, err := createSegment(dir, l.seg.nextBase()+8, testSegmentSize, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	seg.append([]byte("record"))
+	a.NoError(seg.close())
+	_, err = NewLog(dir, 0, 0666, testSegmentSize)
+	a.Error(err)
+}
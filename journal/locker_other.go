@@ -0,0 +1,34 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build !linux,!freebsd
+
+package journal
+
+import (
+	"os"
+
+	ipc_sync "bitbucket.org/avd/go-ipc/sync"
+)
+
+// logLocker is a regular mutex, as robust mutexes are not supported on this platform.
+// If a process dies, holding the lock, the log can't be used, until it is destroyed.
+type logLocker struct {
+	ipc_sync.IPCLocker
+}
+
+func newLogLocker(dir string, perm os.FileMode, onOwnerDied func() error) (*logLocker, error) {
+	m, err := ipc_sync.NewMutex(logLockerName(dir), os.O_CREATE, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &logLocker{IPCLocker: m}, nil
+}
+
+func destroyLogLocker(dir string) error {
+	return ipc_sync.DestroyMutex(logLockerName(dir))
+}
+
+func (l *logLocker) lock() error {
+	l.Lock()
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux freebsd
+
+package journal
+
+import (
+	"os"
+
+	ipc_sync "bitbucket.org/avd/go-ipc/sync"
+)
+
+// logLocker is a robust mutex, so that the log can be used, even if a process dies, holding the lock.
+// A process could die in the middle of a rollover, after the creation of a new segment,
+// but before sealing the previous one, so the next owner recovers the log before using it.
+type logLocker struct {
+	*ipc_sync.RobustMutex
+	onOwnerDied func() error
+}
+
+func newLogLocker(dir string, perm os.FileMode, onOwnerDied func() error) (*logLocker, error) {
+	m, err := ipc_sync.NewRobustMutex(logLockerName(dir), os.O_CREATE, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &logLocker{RobustMutex: m, onOwnerDied: onOwnerDied}, nil
+}
+
+func destroyLogLocker(dir string) error {
+	return ipc_sync.DestroyRobustMutex(logLockerName(dir))
+}
+
+// lock locks the mutex. If the previous owner died, holding it, the log is recovered.
+// If the recovery fails, the mutex is released without being marked consistent,
+// so it becomes not recoverable, and the log can't be used, until it is destroyed.
+func (l *logLocker) lock() error {
+	err := l.LockRobust()
+	if err != ipc_sync.ErrOwnerDied {
+		return err
+	}
+	if err = l.onOwnerDied(); err != nil {
+		l.RobustMutex.Unlock()
+		return err
+	}
+	return l.MarkConsistent()
+}
+
+// Lock locks the mutex. It panics on an error.
+// It is used by the condvar to lock the mutex after a wait.
+func (l *logLocker) Lock() {
+	if err := l.lock(); err != nil {
+		panic(err)
+	}
+}
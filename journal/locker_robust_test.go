@@ -0,0 +1,73 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux freebsd
+
+package journal
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testHelperEnv = "GO_IPC_JOURNAL_TEST_HELPER"
+)
+
+// TestLogRolloverHelper is not a real test. It is run in a child process by TestLogOwnerDied.
+// It locks the log, creates the next segment and exits without sealing the current one.
+func TestLogRolloverHelper(t *testing.T) {
+	dir := os.Getenv(testHelperEnv)
+	if dir == "" {
+		return
+	}
+	l, err := NewLog(dir, 0, 0666, testSegmentSize)
+	if err != nil {
+		os.Exit(1)
+	}
+	if err = l.locker.lock(); err != nil {
+		os.Exit(1)
+	}
+	if _, err = createSegment(dir, l.seg.nextBase(), testSegmentSize, 0666); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestLogOwnerDied(t *testing.T) {
+	a := assert.New(t)
+	l, dir, err := makeTestLog()
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	defer func() {
+		a.NoError(l.Destroy())
+	}()
+	_, err = l.Append([]byte("first"))
+	a.NoError(err)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLogRolloverHelper$")
+	cmd.Env = append(os.Environ(), testHelperEnv+"="+dir)
+	if !a.NoError(cmd.Run()) {
+		return
+	}
+	// the log must be recovered, so that the record goes to the new segment.
+	off, err := l.Append([]byte("second"))
+	a.NoError(err)
+	a.Equal(uint64(recordSize(5)), off)
+	bases, err := listSegments(dir)
+	a.NoError(err)
+	a.Equal([]uint64{0, uint64(recordSize(5))}, bases)
+	r, err := l.NewReader(0)
+	if !a.NoError(err) {
+		return
+	}
+	defer r.Close()
+	for _, expected := range []string{"first", "second"} {
+		data, err := r.Next()
+		a.NoError(err)
+		a.Equal(expected, string(data))
+	}
+}
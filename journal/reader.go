@@ -0,0 +1,102 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package journal
+
+import (
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Reader reads records of a log sequentially.
+// It moves to the next segment, when the current one is sealed.
+// A reader must not be used concurrently.
+type Reader struct {
+	log *Log
+	seg *segment
+	pos int
+}
+
+// Next returns a copy of the next record.
+// It returns io.EOF, if there are no more committed records. Use Wait to wait for them.
+func (r *Reader) Next() ([]byte, error) {
+	if r.seg == nil {
+		return nil, errors.New("the reader is closed")
+	}
+	for {
+		commit := r.seg.commit()
+		if r.pos < commit {
+			payload, next, err := r.seg.record(r.pos, commit)
+			if err != nil {
+				return nil, err
+			}
+			r.pos = next
+			return append([]byte(nil), payload...), nil
+		}
+		if !r.seg.sealed() {
+			return nil, io.EOF
+		}
+		// the segment could have been sealed after we loaded the commit offset.
+		if r.pos < r.seg.commit() {
+			continue
+		}
+		next, err := openSegment(r.log.dir, r.seg.nextBase(), false)
+		if err != nil {
+			return nil, err
+		}
+		r.seg.close()
+		r.seg, r.pos = next, segmentHdrSize
+	}
+}
+
+// Wait waits for a new record to be appended to the log for not longer, than timeout.
+// Passing negative value as a timeout makes the timeout infinite.
+// It returns true, if Next can return a new record.
+func (r *Reader) Wait(timeout time.Duration) bool {
+	if r.seg == nil {
+		return false
+	}
+	var deadline time.Time
+	if timeout >= 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := r.log.locker.lock(); err != nil {
+		return false
+	}
+	defer r.log.locker.Unlock()
+	for !r.ready() {
+		if timeout < 0 {
+			r.log.cond.Wait()
+			continue
+		}
+		left := time.Until(deadline)
+		if left <= 0 {
+			return false
+		}
+		r.log.cond.WaitTimeout(left)
+	}
+	return true
+}
+
+// Offset returns the log offset of the next record.
+func (r *Reader) Offset() uint64 {
+	if r.seg == nil {
+		return 0
+	}
+	return r.seg.offset(r.pos)
+}
+
+// Close closes the reader.
+func (r *Reader) Close() error {
+	if r.seg == nil {
+		return nil
+	}
+	err := r.seg.close()
+	r.seg = nil
+	return err
+}
+
+func (r *Reader) ready() bool {
+	return r.pos < r.seg.commit() || r.seg.sealed()
+}
@@ -0,0 +1,269 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package journal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/mmf"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	segmentMagic   = 0x4c4e524a
+	segmentVersion = 1
+	segmentHdrSize = 64
+	recordHdrSize  = int(unsafe.Sizeof(recordHdr{}))
+	segmentExt     = ".seg"
+	tempExt        = ".tmp"
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+type segmentHdr struct {
+	magic   uint32
+	version uint32
+	base    uint64
+	commit  uint64
+	sealed  uint32
+}
+
+type recordHdr struct {
+	length uint32
+	crc    uint32
+}
+
+// segment is a mapped segment file.
+type segment struct {
+	region *mmf.MemoryRegion
+	hdr    *segmentHdr
+	data   []byte
+	base   uint64
+}
+
+// createSegment creates and maps a new segment file.
+// the file is prepared under a temporary name and then renamed,
+// so other processes never see uninitialized segments.
+func createSegment(dir string, base uint64, size int, perm os.FileMode) (*segment, error) {
+	path := segmentPath(dir, base)
+	tmpPath := strings.TrimSuffix(path, segmentExt) + tempExt
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, perm)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create segment file")
+	}
+	if err = file.Truncate(int64(size)); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return nil, errors.Wrap(err, "failed to truncate segment file")
+	}
+	seg, err := mapSegment(file, true)
+	file.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	seg.hdr.version = segmentVersion
+	seg.hdr.base = base
+	seg.hdr.commit = segmentHdrSize
+	seg.hdr.magic = segmentMagic
+	seg.base = base
+	if err = seg.region.Flush(false); err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		seg.close()
+		os.Remove(tmpPath)
+		return nil, errors.Wrap(err, "failed to publish segment file")
+	}
+	return seg, nil
+}
+
+// openSegment maps an existing segment file.
+func openSegment(dir string, base uint64, writable bool) (*segment, error) {
+	flag := os.O_RDONLY
+	if writable {
+		flag = os.O_RDWR
+	}
+	file, err := os.OpenFile(segmentPath(dir, base), flag, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open segment file")
+	}
+	defer file.Close()
+	seg, err := mapSegment(file, writable)
+	if err != nil {
+		return nil, err
+	}
+	if seg.hdr.magic != segmentMagic || seg.hdr.version != segmentVersion || seg.hdr.base != base {
+		seg.close()
+		return nil, errors.Errorf("invalid segment %d", base)
+	}
+	seg.base = base
+	return seg, nil
+}
+
+func mapSegment(file *os.File, writable bool) (*segment, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to stat segment file")
+	}
+	if stat.Size() < segmentHdrSize {
+		return nil, errors.New("segment file is too small")
+	}
+	mode := mmf.MEM_READ_ONLY
+	if writable {
+		mode = mmf.MEM_READWRITE
+	}
+	region, err := mmf.NewMemoryRegion(file, mode, 0, int(stat.Size()))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to map segment file")
+	}
+	data := region.Data()
+	return &segment{
+		region: region,
+		hdr:    (*segmentHdr)(allocator.ByteSliceData(data)),
+		data:   data,
+	}, nil
+}
+
+func (s *segment) commit() int {
+	return int(atomic.LoadUint64(&s.hdr.commit))
+}
+
+func (s *segment) sealed() bool {
+	return atomic.LoadUint32(&s.hdr.sealed) != 0
+}
+
+// nextBase returns the log offset of the segment, which follows the sealed segment.
+func (s *segment) nextBase() uint64 {
+	return s.base + uint64(s.commit()-segmentHdrSize)
+}
+
+// offset converts a position in the segment into a log offset.
+func (s *segment) offset(pos int) uint64 {
+	return s.base + uint64(pos-segmentHdrSize)
+}
+
+// fits returns true, if a record of the given size can be appended to the segment.
+func (s *segment) fits(size int) bool {
+	return s.commit()+recordSize(size) <= len(s.data)
+}
+
+// append writes a record and commits it. it returns the position of the record.
+func (s *segment) append(payload []byte) int {
+	pos := s.commit()
+	hdr := s.recordHdrAt(pos)
+	copy(s.data[pos+recordHdrSize:], payload)
+	hdr.length = uint32(len(payload))
+	hdr.crc = recordCrc(payload)
+	atomic.StoreUint64(&s.hdr.commit, uint64(pos+recordSize(len(payload))))
+	return pos
+}
+
+// record returns the payload of a record at the given position and the position of the next record.
+// the record must end before limit.
+func (s *segment) record(pos, limit int) ([]byte, int, error) {
+	if pos < segmentHdrSize || pos+recordHdrSize > limit {
+		return nil, pos, errors.New("invalid record position")
+	}
+	hdr := s.recordHdrAt(pos)
+	end := pos + recordHdrSize + int(hdr.length)
+	if end > limit {
+		return nil, pos, ErrCorrupted
+	}
+	payload := s.data[pos+recordHdrSize : end]
+	if recordCrc(payload) != hdr.crc {
+		return nil, pos, ErrCorrupted
+	}
+	return payload, pos + recordSize(len(payload)), nil
+}
+
+// recover truncates the committed data of the segment to the last valid record.
+// it returns true, if the segment was truncated.
+func (s *segment) recover() bool {
+	commit := s.commit()
+	if commit > len(s.data) {
+		commit = len(s.data)
+	}
+	pos := segmentHdrSize
+	for pos < commit {
+		_, next, err := s.record(pos, commit)
+		if err != nil || next > commit {
+			break
+		}
+		pos = next
+	}
+	if pos == s.commit() {
+		return false
+	}
+	if pos+recordHdrSize <= len(s.data) {
+		*s.recordHdrAt(pos) = recordHdr{}
+	}
+	atomic.StoreUint64(&s.hdr.commit, uint64(pos))
+	return true
+}
+
+func (s *segment) seal() {
+	atomic.StoreUint32(&s.hdr.sealed, 1)
+}
+
+func (s *segment) flush() error {
+	return s.region.Flush(false)
+}
+
+func (s *segment) close() error {
+	return s.region.Close()
+}
+
+func (s *segment) recordHdrAt(pos int) *recordHdr {
+	return (*recordHdr)(allocator.ByteSliceData(s.data[pos:]))
+}
+
+func recordSize(payloadSize int) int {
+	return (recordHdrSize + payloadSize + 7) &^ 7
+}
+
+func recordCrc(payload []byte) uint32 {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(payload)))
+	return crc32.Update(crc32.Checksum(payload, crcTable), crcTable, length[:])
+}
+
+func segmentPath(dir string, base uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", base, segmentExt))
+}
+
+// listSegments returns sorted bases of the segments in the directory.
+func listSegments(dir string) ([]uint64, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var result []uint64
+	for _, info := range infos {
+		name := info.Name()
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		base, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		result = append(result, base)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result, nil
+}
@@ -0,0 +1,252 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package mmf
+
+import (
+	"sync/atomic"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+
+	"github.com/pkg/errors"
+)
+
+// Atomic accessors operate on the values at byte offsets from the beginning of the region data.
+// The offset must be within the region and aligned to the size of the value.
+// The region is kept alive, while the operation is running.
+
+// LoadInt32 atomically loads int32 at the given offset.
+func (region *MemoryRegion) LoadInt32(offset int) (int32, error) {
+	ptr, err := region.atomicPointer(offset, 4)
+	if err != nil {
+		return 0, err
+	}
+	result := atomic.LoadInt32((*int32)(ptr))
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// StoreInt32 atomically stores int32 at the given offset.
+func (region *MemoryRegion) StoreInt32(offset int, value int32) error {
+	ptr, err := region.atomicPointer(offset, 4)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32((*int32)(ptr), value)
+	allocator.Use(unsafe.Pointer(region))
+	return nil
+}
+
+// AddInt32 atomically adds delta to int32 at the given offset and returns the new value.
+func (region *MemoryRegion) AddInt32(offset int, delta int32) (int32, error) {
+	ptr, err := region.atomicPointer(offset, 4)
+	if err != nil {
+		return 0, err
+	}
+	result := atomic.AddInt32((*int32)(ptr), delta)
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// SwapInt32 atomically stores new int32 at the given offset and returns the old value.
+func (region *MemoryRegion) SwapInt32(offset int, new int32) (int32, error) {
+	ptr, err := region.atomicPointer(offset, 4)
+	if err != nil {
+		return 0, err
+	}
+	result := atomic.SwapInt32((*int32)(ptr), new)
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// CompareAndSwapInt32 executes the compare-and-swap operation for int32 at the given offset.
+func (region *MemoryRegion) CompareAndSwapInt32(offset int, old, new int32) (bool, error) {
+	ptr, err := region.atomicPointer(offset, 4)
+	if err != nil {
+		return false, err
+	}
+	result := atomic.CompareAndSwapInt32((*int32)(ptr), old, new)
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// LoadUint32 atomically loads uint32 at the given offset.
+func (region *MemoryRegion) LoadUint32(offset int) (uint32, error) {
+	ptr, err := region.atomicPointer(offset, 4)
+	if err != nil {
+		return 0, err
+	}
+	result := atomic.LoadUint32((*uint32)(ptr))
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// StoreUint32 atomically stores uint32 at the given offset.
+func (region *MemoryRegion) StoreUint32(offset int, value uint32) error {
+	ptr, err := region.atomicPointer(offset, 4)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint32((*uint32)(ptr), value)
+	allocator.Use(unsafe.Pointer(region))
+	return nil
+}
+
+// AddUint32 atomically adds delta to uint32 at the given offset and returns the new value.
+func (region *MemoryRegion) AddUint32(offset int, delta uint32) (uint32, error) {
+	ptr, err := region.atomicPointer(offset, 4)
+	if err != nil {
+		return 0, err
+	}
+	result := atomic.AddUint32((*uint32)(ptr), delta)
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// SwapUint32 atomically stores new uint32 at the given offset and returns the old value.
+func (region *MemoryRegion) SwapUint32(offset int, new uint32) (uint32, error) {
+	ptr, err := region.atomicPointer(offset, 4)
+	if err != nil {
+		return 0, err
+	}
+	result := atomic.SwapUint32((*uint32)(ptr), new)
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// CompareAndSwapUint32 executes the compare-and-swap operation for uint32 at the given offset.
+func (region *MemoryRegion) CompareAndSwapUint32(offset int, old, new uint32) (bool, error) {
+	ptr, err := region.atomicPointer(offset, 4)
+	if err != nil {
+		return false, err
+	}
+	result := atomic.CompareAndSwapUint32((*uint32)(ptr), old, new)
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// LoadInt64 atomically loads int64 at the given offset.
+func (region *MemoryRegion) LoadInt64(offset int) (int64, error) {
+	ptr, err := region.atomicPointer(offset, 8)
+	if err != nil {
+		return 0, err
+	}
+	result := atomic.LoadInt64((*int64)(ptr))
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// StoreInt64 atomically stores int64 at the given offset.
+func (region *MemoryRegion) StoreInt64(offset int, value int64) error {
+	ptr, err := region.atomicPointer(offset, 8)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64((*int64)(ptr), value)
+	allocator.Use(unsafe.Pointer(region))
+	return nil
+}
+
+// AddInt64 atomically adds delta to int64 at the given offset and returns the new value.
+func (region *MemoryRegion) AddInt64(offset int, delta int64) (int64, error) {
+	ptr, err := region.atomicPointer(offset, 8)
+	if err != nil {
+		return 0, err
+	}
+	result := atomic.AddInt64((*int64)(ptr), delta)
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// SwapInt64 atomically stores new int64 at the given offset and returns the old value.
+func (region *MemoryRegion) SwapInt64(offset int, new int64) (int64, error) {
+	ptr, err := region.atomicPointer(offset, 8)
+	if err != nil {
+		return 0, err
+	}
+	result := atomic.SwapInt64((*int64)(ptr), new)
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// CompareAndSwapInt64 executes the compare-and-swap operation for int64 at the given offset.
+func (region *MemoryRegion) CompareAndSwapInt64(offset int, old, new int64) (bool, error) {
+	ptr, err := region.atomicPointer(offset, 8)
+	if err != nil {
+		return false, err
+	}
+	result := atomic.CompareAndSwapInt64((*int64)(ptr), old, new)
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// LoadUint64 atomically loads uint64 at the given offset.
+func (region *MemoryRegion) LoadUint64(offset int) (uint64, error) {
+	ptr, err := region.atomicPointer(offset, 8)
+	if err != nil {
+		return 0, err
+	}
+	result := atomic.LoadUint64((*uint64)(ptr))
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// StoreUint64 atomically stores uint64 at the given offset.
+func (region *MemoryRegion) StoreUint64(offset int, value uint64) error {
+	ptr, err := region.atomicPointer(offset, 8)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint64((*uint64)(ptr), value)
+	allocator.Use(unsafe.Pointer(region))
+	return nil
+}
+
+// AddUint64 atomically adds delta to uint64 at the given offset and returns the new value.
+func (region *MemoryRegion) AddUint64(offset int, delta uint64) (uint64, error) {
+	ptr, err := region.atomicPointer(offset, 8)
+	if err != nil {
+		return 0, err
+	}
+	result := atomic.AddUint64((*uint64)(ptr), delta)
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// SwapUint64 atomically stores new uint64 at the given offset and returns the old value.
+func (region *MemoryRegion) SwapUint64(offset int, new uint64) (uint64, error) {
+	ptr, err := region.atomicPointer(offset, 8)
+	if err != nil {
+		return 0, err
+	}
+	result := atomic.SwapUint64((*uint64)(ptr), new)
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// CompareAndSwapUint64 executes the compare-and-swap operation for uint64 at the given offset.
+func (region *MemoryRegion) CompareAndSwapUint64(offset int, old, new uint64) (bool, error) {
+	ptr, err := region.atomicPointer(offset, 8)
+	if err != nil {
+		return false, err
+	}
+	result := atomic.CompareAndSwapUint64((*uint64)(ptr), old, new)
+	allocator.Use(unsafe.Pointer(region))
+	return result, nil
+}
+
+// atomicPointer returns a pointer to a value of the given size at the offset, checking its bounds and alignment.
+func (region *MemoryRegion) atomicPointer(offset, size int) (unsafe.Pointer, error) {
+	if region.data == nil {
+		return nil, errors.New("the region is closed")
+	}
+	data := region.Data()
+	if offset < 0 || offset+size > len(data) {
+		return nil, errors.Errorf("offset %d is out of the region bounds", offset)
+	}
+	ptr := unsafe.Pointer(&data[offset])
+	if uintptr(ptr)%uintptr(size) != 0 {
+		return nil, errors.Errorf("offset %d is not aligned to %d bytes", offset, size)
+	}
+	return ptr, nil
+}
@@ -0,0 +1,332 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package mmf
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/common"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	growableMagic = 0x47524d47
+	// GrowableHeaderSize is the size of the header, which precedes the data of a growable region.
+	GrowableHeaderSize = 64
+	// the header lock checks, whether its owner is alive, after this number of attempts.
+	growableCheckSpins = 1000
+)
+
+// growableHdr is stored at the beginning of the object.
+// lock serializes resizes between processes. it is the pid of the owner, and lockStart is its start time,
+// or 0, if it is unknown, so that the lock can be taken over, if its owner dies.
+// generation is incremented after each resize. magic is set, when the header is initialized.
+type growableHdr struct {
+	magic      uint32
+	lock       uint32
+	generation uint64
+	size       uint64
+	lockStart  uint64
+}
+
+// GrowableObject is a mappable object, which size can be changed.
+type GrowableObject interface {
+	Mappable
+	Truncate(size int64) error
+}
+
+// GrowableRegion is a memory region, which can be grown by any process, that uses it.
+// The object stores the size of the data and a generation number in its header,
+// so that other processes notice the change and remap the object on the next access.
+// On Linux mremap is used, so the data can be remapped without creating a new mapping.
+// The data may be moved to another address after the remapping,
+// so it must not be used outside of Access, unless you track the changes with OnResize.
+// The region can only grow, it is never shrunk.
+type GrowableRegion struct {
+	mut      sync.RWMutex
+	object   GrowableObject
+	region   *MemoryRegion
+	hdr      *growableHdr
+	gen      uint64
+	pid      uint32
+	start    uint64
+	onResize []func(data []byte)
+}
+
+// NewGrowableRegion maps the object as a growable region.
+// If the object is smaller, than requested, it is grown.
+// The region takes the ownership of the object, and closes it, if it is an io.Closer.
+//	object - an object to mmap. it must be opened for reading and writing.
+//	created - true, if the object has just been created exclusively by the caller, and must be initialized.
+//	otherwise the region waits for the creator to initialize the object.
+//	size - minimal size of the data, not including the header.
+func NewGrowableRegion(object GrowableObject, created bool, size int) (*GrowableRegion, error) {
+	if size < 0 {
+		return nil, errors.New("invalid size")
+	}
+	if created {
+		// only the creator truncates the object, so that it never shrinks an object, which was grown by another process.
+		if err := object.Truncate(int64(GrowableHeaderSize + size)); err != nil {
+			return nil, errors.Wrap(err, "failed to truncate the object")
+		}
+	} else {
+		sizeReady := func() bool {
+			objSize, err := fileSizeFromFd(object)
+			return err != nil || objSize >= GrowableHeaderSize
+		}
+		if !common.WaitReady(sizeReady) {
+			return nil, errors.New("the object was not initialized")
+		}
+	}
+	region, err := NewMemoryRegion(object, MEM_READWRITE, 0, GrowableHeaderSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to map the object header")
+	}
+	result := &GrowableRegion{object: object, region: region, pid: uint32(os.Getpid())}
+	result.start, _ = common.ProcessStartTime(os.Getpid())
+	result.hdr = result.header()
+	if created {
+		result.init(size)
+	} else {
+		err = result.open(size)
+	}
+	if err == nil {
+		result.mut.Lock()
+		_, err = result.refresh()
+		result.mut.Unlock()
+	}
+	if err != nil {
+		region.Close()
+		return nil, err
+	}
+	return result, nil
+}
+
+// Access calls f with the data of the region, remapping it, if it was resized by another process.
+// The data is valid only while f runs, as it can be remapped after that.
+func (g *GrowableRegion) Access(f func(data []byte)) error {
+	g.mut.RLock()
+	for g.changed() {
+		g.mut.RUnlock()
+		g.mut.Lock()
+		_, err := g.refresh()
+		g.mut.Unlock()
+		if err != nil {
+			return err
+		}
+		g.mut.RLock()
+	}
+	defer g.mut.RUnlock()
+	if g.region == nil {
+		return errors.New("the region is closed")
+	}
+	f(g.data())
+	return nil
+}
+
+// Refresh remaps the region, if it was resized by another process.
+// Returns true, if the region was remapped.
+func (g *GrowableRegion) Refresh() (bool, error) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	return g.refresh()
+}
+
+// Resize grows the region, so that it can hold at least 'size' bytes of data.
+// If the region is already large enough, nothing is done.
+func (g *GrowableRegion) Resize(size int) error {
+	if size < 0 {
+		return errors.New("invalid size")
+	}
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	if g.region == nil {
+		return errors.New("the region is closed")
+	}
+	g.lockHeader()
+	err := g.grow(size)
+	g.unlockHeader()
+	if err != nil {
+		return err
+	}
+	_, err = g.refresh()
+	return err
+}
+
+// OnResize adds a function, which is called after the region was remapped.
+// f receives new data of the region. It is called with the region locked,
+// so it must not call region's methods.
+func (g *GrowableRegion) OnResize(f func(data []byte)) {
+	g.mut.Lock()
+	g.onResize = append(g.onResize, f)
+	g.mut.Unlock()
+}
+
+// Size returns the current size of the data, as seen by all processes.
+func (g *GrowableRegion) Size() int {
+	g.mut.RLock()
+	defer g.mut.RUnlock()
+	if g.hdr == nil {
+		return 0
+	}
+	return int(atomic.LoadUint64(&g.hdr.size))
+}
+
+// Generation returns the number of the resizes made to the object.
+func (g *GrowableRegion) Generation() uint64 {
+	g.mut.RLock()
+	defer g.mut.RUnlock()
+	if g.hdr == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&g.hdr.generation)
+}
+
+// Flush syncs mapped content with the object.
+func (g *GrowableRegion) Flush(async bool) error {
+	g.mut.RLock()
+	defer g.mut.RUnlock()
+	if g.region == nil {
+		return errors.New("the region is closed")
+	}
+	return g.region.Flush(async)
+}
+
+// Close unmaps the region and closes the object.
+func (g *GrowableRegion) Close() error {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	if g.region == nil {
+		return nil
+	}
+	err := g.region.Close()
+	g.region, g.hdr = nil, nil
+	if closer, ok := g.object.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// init initializes the header of a new object, which was truncated by the creator,
+// and publishes it by setting the magic.
+func (g *GrowableRegion) init(size int) {
+	atomic.StoreUint64(&g.hdr.size, uint64(size))
+	atomic.StoreUint64(&g.hdr.generation, 1)
+	atomic.StoreUint32(&g.hdr.magic, growableMagic)
+}
+
+// open waits for the creator to initialize the header, and grows the object, if needed.
+func (g *GrowableRegion) open(size int) error {
+	if !common.WaitReady(func() bool { return atomic.LoadUint32(&g.hdr.magic) != 0 }) {
+		return errors.New("the object was not initialized")
+	}
+	if atomic.LoadUint32(&g.hdr.magic) != growableMagic {
+		return errors.New("the object is not a growable region")
+	}
+	g.lockHeader()
+	defer g.unlockHeader()
+	return g.grow(size)
+}
+
+// grow must be called with the header locked.
+func (g *GrowableRegion) grow(size int) error {
+	if uint64(size) <= atomic.LoadUint64(&g.hdr.size) {
+		return nil
+	}
+	if err := g.object.Truncate(int64(GrowableHeaderSize + size)); err != nil {
+		return errors.Wrap(err, "failed to truncate the object")
+	}
+	atomic.StoreUint64(&g.hdr.size, uint64(size))
+	atomic.AddUint64(&g.hdr.generation, 1)
+	return nil
+}
+
+func (g *GrowableRegion) changed() bool {
+	return g.hdr != nil && atomic.LoadUint64(&g.hdr.generation) != g.gen
+}
+
+// refresh must be called with the region locked for writing.
+func (g *GrowableRegion) refresh() (bool, error) {
+	if g.region == nil {
+		return false, errors.New("the region is closed")
+	}
+	// read generation first, so that the size is not older, than the generation.
+	gen := atomic.LoadUint64(&g.hdr.generation)
+	size := GrowableHeaderSize + int(atomic.LoadUint64(&g.hdr.size))
+	if size == g.region.Size() {
+		g.gen = gen
+		return false, nil
+	}
+	if err := g.region.remap(size, true); err != nil {
+		region, err := NewMemoryRegion(g.object, MEM_READWRITE, 0, size)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to remap the object")
+		}
+		g.region.Close()
+		g.region = region
+	}
+	g.hdr = g.header()
+	g.gen = gen
+	for _, f := range g.onResize {
+		f(g.data())
+	}
+	return true, nil
+}
+
+// lockHeader locks the header. if the owner of the lock died, the lock is taken over.
+func (g *GrowableRegion) lockHeader() {
+	for spins := 1; ; spins++ {
+		owner := atomic.LoadUint32(&g.hdr.lock)
+		if owner == 0 {
+			if atomic.CompareAndSwapUint32(&g.hdr.lock, 0, g.pid) {
+				atomic.StoreUint64(&g.hdr.lockStart, g.start)
+				return
+			}
+		} else if spins%growableCheckSpins == 0 && g.takeOverHeader(owner) {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+// takeOverHeader locks the header, if its owner is dead.
+// the header is changed with atomic stores, and the object is truncated before its size is changed,
+// so a dead owner can't leave it inconsistent. the generation is incremented after the takeover,
+// so that the size, which the owner could have changed, is noticed by the other processes.
+func (g *GrowableRegion) takeOverHeader(owner uint32) bool {
+	start := atomic.LoadUint64(&g.hdr.lockStart)
+	if atomic.LoadUint32(&g.hdr.lock) != owner || common.ProcessAlive(int(owner), start) {
+		return false
+	}
+	// reset the start time of the dead owner first, so that no one compares it with the pid of the new owner.
+	if !atomic.CompareAndSwapUint64(&g.hdr.lockStart, start, 0) {
+		return false
+	}
+	if !atomic.CompareAndSwapUint32(&g.hdr.lock, owner, g.pid) {
+		return false
+	}
+	atomic.StoreUint64(&g.hdr.lockStart, g.start)
+	atomic.AddUint64(&g.hdr.generation, 1)
+	return true
+}
+
+func (g *GrowableRegion) unlockHeader() {
+	atomic.StoreUint64(&g.hdr.lockStart, 0)
+	atomic.StoreUint32(&g.hdr.lock, 0)
+}
+
+func (g *GrowableRegion) header() *growableHdr {
+	return (*growableHdr)(allocator.ByteSliceData(g.region.Data()))
+}
+
+func (g *GrowableRegion) data() []byte {
+	return g.region.Data()[GrowableHeaderSize:]
+}
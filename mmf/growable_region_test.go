@@ -0,0 +1,150 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package mmf
+
+import (
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"bitbucket.org/avd/go-ipc/internal/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openGrowableTestFile(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0666)
+}
+
+func TestGrowableRegionResize(t *testing.T) {
+	a := assert.New(t)
+	tmp, err := ioutil.TempFile("", "growable")
+	if !a.NoError(err) {
+		return
+	}
+	name := tmp.Name()
+	defer os.Remove(name)
+	g1, err := NewGrowableRegion(tmp, true, 100)
+	if !a.NoError(err) {
+		return
+	}
+	defer g1.Close()
+	a.Equal(100, g1.Size())
+	a.NoError(g1.Access(func(data []byte) {
+		a.Len(data, 100)
+		copy(data, "hello")
+	}))
+	file, err := openGrowableTestFile(name)
+	if !a.NoError(err) {
+		return
+	}
+	g2, err := NewGrowableRegion(file, false, 10)
+	if !a.NoError(err) {
+		return
+	}
+	defer g2.Close()
+	var resized []int
+	g2.OnResize(func(data []byte) {
+		resized = append(resized, len(data))
+	})
+	a.Equal(100, g2.Size())
+	gen := g1.Generation()
+	a.NoError(g1.Resize(50))
+	a.Equal(gen, g1.Generation())
+	a.NoError(g1.Resize(1 << 20))
+	a.Equal(gen+1, g2.Generation())
+	a.NoError(g2.Access(func(data []byte) {
+		a.Len(data, 1<<20)
+		a.Equal("hello", string(data[:5]))
+		data[len(data)-1] = 42
+	}))
+	a.Equal([]int{1 << 20}, resized)
+	a.NoError(g1.Access(func(data []byte) {
+		a.Equal(byte(42), data[len(data)-1])
+	}))
+	remapped, err := g2.Refresh()
+	a.NoError(err)
+	a.False(remapped)
+}
+
+func TestGrowableRegionInvalidObject(t *testing.T) {
+	a := assert.New(t)
+	tmp, err := ioutil.TempFile("", "growable")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(make([]byte, GrowableHeaderSize))
+	a.NoError(err)
+	_, err = tmp.WriteAt([]byte{1, 2, 3, 4}, 0)
+	a.NoError(err)
+	_, err = NewGrowableRegion(tmp, false, 10)
+	a.Error(err)
+	tmp.Close()
+}
+
+func TestGrowableRegionOpenBeforeInit(t *testing.T) {
+	a := assert.New(t)
+	tmp, err := ioutil.TempFile("", "growable")
+	if !a.NoError(err) {
+		return
+	}
+	name := tmp.Name()
+	defer os.Remove(name)
+	file, err := openGrowableTestFile(name)
+	if !a.NoError(err) {
+		tmp.Close()
+		return
+	}
+	// the object is opened, before the creator truncates it.
+	opened := make(chan *GrowableRegion)
+	go func() {
+		g, err := NewGrowableRegion(file, false, 10)
+		a.NoError(err)
+		opened <- g
+	}()
+	time.Sleep(time.Millisecond * 50)
+	g1, err := NewGrowableRegion(tmp, true, 100)
+	if !a.NoError(err) {
+		return
+	}
+	defer g1.Close()
+	g2 := <-opened
+	if g2 == nil {
+		return
+	}
+	defer g2.Close()
+	a.Equal(100, g2.Size())
+	a.NoError(g2.Access(func(data []byte) {
+		a.Len(data, 100)
+	}))
+}
+
+func TestGrowableRegionLockOwnerDied(t *testing.T) {
+	a := assert.New(t)
+	owner := os.Getppid()
+	start, ok := common.ProcessStartTime(owner)
+	if !ok {
+		t.Skip("process start time is not supported")
+	}
+	tmp, err := ioutil.TempFile("", "growable")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	g, err := NewGrowableRegion(tmp, true, 100)
+	if !a.NoError(err) {
+		return
+	}
+	defer g.Close()
+	// the owner of the lock has died, and its pid has been reused by another process.
+	atomic.StoreUint32(&g.hdr.lock, uint32(owner))
+	atomic.StoreUint64(&g.hdr.lockStart, start+1)
+	gen := g.Generation()
+	a.NoError(g.Resize(1000))
+	a.Equal(1000, g.Size())
+	a.Equal(gen+2, g.Generation())
+	a.Equal(uint32(0), atomic.LoadUint32(&g.hdr.lock))
+}
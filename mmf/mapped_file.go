@@ -0,0 +1,289 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package mmf
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MappedFileChunkSize is the granularity, with which mapped files are extended.
+	MappedFileChunkSize = 64 * 1024
+)
+
+// MappedFile is a file, which is accessed via a memory mapping.
+// It implements io.ReaderAt, io.WriterAt, io.ReadWriteSeeker, io.ReaderFrom, and io.WriterTo.
+// When a write goes past the end of the file, the file is extended by MappedFileChunkSize chunks
+// and remapped. While the file is open, its size on disk can be greater, than the size of the data.
+// The file is truncated to the size of the data on Close.
+// ReadAt and WriteAt can be used concurrently, other methods use the shared position and
+// should not be called concurrently.
+type MappedFile struct {
+	mut      sync.RWMutex
+	file     *os.File
+	region   *MemoryRegion
+	writable bool
+	append   bool
+	size     int64
+	pos      int64
+}
+
+// NewMappedFile opens a file and maps it into memory.
+//	name - file name.
+//	flag - flag is a combination of open flags from 'os' package.
+//	perm - file's permission bits.
+// As mapping requires read access, os.O_WRONLY is treated as os.O_RDWR.
+func NewMappedFile(name string, flag int, perm os.FileMode) (*MappedFile, error) {
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if writable {
+		flag = flag&^os.O_WRONLY | os.O_RDWR
+	}
+	file, err := os.OpenFile(name, flag&^os.O_APPEND, perm)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open the file")
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "failed to stat the file")
+	}
+	result := &MappedFile{file: file, writable: writable, append: flag&os.O_APPEND != 0, size: stat.Size()}
+	if result.size > 0 {
+		if err = result.mapFile(int(result.size)); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// ReadAt is to implement io.ReaderAt.
+func (f *MappedFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	f.mut.RLock()
+	defer f.mut.RUnlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	n = copy(p, f.region.Data()[off:f.size])
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+// WriteAt is to implement io.WriterAt.
+// If the write goes past the end of the file, the file is extended.
+func (f *MappedFile) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	return f.writeAt(p, off)
+}
+
+// Read is to implement io.Reader.
+func (f *MappedFile) Read(p []byte) (n int, err error) {
+	n, err = f.ReadAt(p, f.pos)
+	f.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Write is to implement io.Writer.
+// If the file was opened with os.O_APPEND, the data is written to the end of the file.
+func (f *MappedFile) Write(p []byte) (n int, err error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.append {
+		f.pos = f.size
+	}
+	n, err = f.writeAt(p, f.pos)
+	f.pos += int64(n)
+	return n, err
+}
+
+// Seek is to implement io.Seeker.
+func (f *MappedFile) Seek(offset int64, whence int) (int64, error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = f.pos + offset
+	case io.SeekEnd:
+		pos = f.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.pos = pos
+	return pos, nil
+}
+
+// ReadFrom is to implement io.ReaderFrom.
+// It reads the data directly into the mapping, starting at the current position.
+func (f *MappedFile) ReadFrom(r io.Reader) (n int64, err error) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.append {
+		f.pos = f.size
+	}
+	for {
+		if err = f.ensureCapacity(f.pos + 1); err != nil {
+			return n, err
+		}
+		data := f.region.Data()
+		read, readErr := r.Read(data[f.pos:])
+		f.pos += int64(read)
+		n += int64(read)
+		if f.pos > f.size {
+			f.size = f.pos
+		}
+		if readErr == io.EOF {
+			return n, nil
+		}
+		if readErr != nil {
+			return n, readErr
+		}
+	}
+}
+
+// WriteTo is to implement io.WriterTo.
+// It writes the data from the current position to the end of the file.
+func (f *MappedFile) WriteTo(w io.Writer) (n int64, err error) {
+	f.mut.RLock()
+	defer f.mut.RUnlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.pos >= f.size {
+		return 0, nil
+	}
+	rest := f.region.Data()[f.pos:f.size]
+	written, err := w.Write(rest)
+	f.pos += int64(written)
+	if err == nil && written < len(rest) {
+		err = io.ErrShortWrite
+	}
+	return int64(written), err
+}
+
+// Size returns the size of the file data.
+func (f *MappedFile) Size() int64 {
+	f.mut.RLock()
+	defer f.mut.RUnlock()
+	return f.size
+}
+
+// Sync flushes the mapped data to the disk.
+func (f *MappedFile) Sync() error {
+	f.mut.RLock()
+	defer f.mut.RUnlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	if f.region == nil {
+		return nil
+	}
+	return f.region.Flush(false)
+}
+
+// Close unmaps the file, truncates it to the size of its data and closes it.
+func (f *MappedFile) Close() error {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	var result error
+	if f.region != nil {
+		if err := f.region.Close(); err != nil {
+			result = errors.Wrap(err, "failed to close the region")
+		}
+		f.region = nil
+	}
+	if f.writable {
+		if err := f.file.Truncate(f.size); err != nil && result == nil {
+			result = errors.Wrap(err, "failed to truncate the file")
+		}
+	}
+	if err := f.file.Close(); err != nil && result == nil {
+		result = errors.Wrap(err, "failed to close the file")
+	}
+	f.file = nil
+	return result
+}
+
+// writeAt must be called with the file locked for writing.
+func (f *MappedFile) writeAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	end := off + int64(len(p))
+	if err := f.ensureCapacity(end); err != nil {
+		return 0, err
+	}
+	copy(f.region.Data()[off:], p)
+	if end > f.size {
+		f.size = end
+	}
+	return len(p), nil
+}
+
+// ensureCapacity extends and remaps the file, so that it can hold at least 'size' bytes.
+// it must be called with the file locked for writing.
+func (f *MappedFile) ensureCapacity(size int64) error {
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	if !f.writable {
+		return errors.New("the file is not opened for writing")
+	}
+	if f.region != nil && int64(f.region.Size()) >= size {
+		return nil
+	}
+	newSize := (size + MappedFileChunkSize - 1) / MappedFileChunkSize * MappedFileChunkSize
+	if int64(int(newSize)) != newSize {
+		return errors.New("the file is too large")
+	}
+	if err := f.file.Truncate(newSize); err != nil {
+		return errors.Wrap(err, "failed to extend the file")
+	}
+	if f.region == nil {
+		return f.mapFile(int(newSize))
+	}
+	if _, err := f.region.Resize(int(newSize), true); err != nil {
+		return errors.Wrap(err, "failed to remap the file")
+	}
+	return nil
+}
+
+func (f *MappedFile) mapFile(size int) error {
+	mode := MEM_READ_ONLY
+	if f.writable {
+		mode = MEM_READWRITE
+	}
+	region, err := NewMemoryRegion(f.file, mode, 0, size)
+	if err != nil {
+		return errors.Wrap(err, "failed to map the file")
+	}
+	f.region = region
+	return nil
+}
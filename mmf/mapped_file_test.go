@@ -0,0 +1,102 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package mmf
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappedFileReadWrite(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "mapped")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "file")
+	f, err := NewMappedFile(name, os.O_CREATE|os.O_RDWR, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(int64(0), f.Size())
+	buf := make([]byte, 5)
+	_, err = f.Read(buf)
+	a.Equal(io.EOF, err)
+	n, err := f.Write([]byte("hello"))
+	a.NoError(err)
+	a.Equal(5, n)
+	off := int64(MappedFileChunkSize*2 + 10)
+	_, err = f.WriteAt([]byte("world"), off)
+	a.NoError(err)
+	a.Equal(off+5, f.Size())
+	_, err = f.ReadAt(buf, off)
+	a.NoError(err)
+	a.Equal([]byte("world"), buf)
+	n, err = f.ReadAt(buf, off+2)
+	a.Equal(io.EOF, err)
+	a.Equal(3, n)
+	pos, err := f.Seek(-5, io.SeekEnd)
+	a.NoError(err)
+	a.Equal(off, pos)
+	_, err = f.Seek(-1, io.SeekStart)
+	a.Error(err)
+	_, err = f.Seek(0, io.SeekStart)
+	a.NoError(err)
+	_, err = f.Read(buf)
+	a.NoError(err)
+	a.Equal([]byte("hello"), buf)
+	a.NoError(f.Sync())
+	a.NoError(f.Close())
+	stat, err := os.Stat(name)
+	if a.NoError(err) {
+		a.Equal(off+5, stat.Size())
+	}
+	f, err = NewMappedFile(name, os.O_RDONLY, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer f.Close()
+	_, err = f.Write([]byte("data"))
+	a.Error(err)
+	_, err = f.ReadAt(buf, 0)
+	a.NoError(err)
+	a.Equal([]byte("hello"), buf)
+}
+
+func TestMappedFileCopy(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "mapped")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	expected := bytes.Repeat([]byte("0123456789"), MappedFileChunkSize/3)
+	in, err := NewMappedFile(filepath.Join(dir, "in"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer in.Close()
+	written, err := in.ReadFrom(bytes.NewReader(expected))
+	a.NoError(err)
+	a.Equal(int64(len(expected)), written)
+	_, err = in.Seek(0, io.SeekStart)
+	a.NoError(err)
+	out, err := NewMappedFile(filepath.Join(dir, "out"), os.O_CREATE|os.O_RDWR, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	written, err = io.Copy(out, in)
+	a.NoError(err)
+	a.Equal(int64(len(expected)), written)
+	a.NoError(out.Close())
+	actual, err := ioutil.ReadFile(filepath.Join(dir, "out"))
+	a.NoError(err)
+	a.Equal(expected, actual)
+}
@@ -5,6 +5,7 @@ package mmf
 import (
 	"os"
 	"runtime"
+	"time"
 	"unsafe"
 
 	"bitbucket.org/avd/go-ipc/internal/allocator"
@@ -17,6 +18,23 @@ const (
 	MEM_READ_PRIVATE  = 0x00000002
 	MEM_READWRITE     = 0x00000004
 	MEM_COPY_ON_WRITE = 0x00000008
+	// MEM_NO_ACCESS can only be used with MemoryRegion.Protect.
+	MEM_NO_ACCESS = 0x00000010
+)
+
+// Advices for MemoryRegion.Advise.
+const (
+	// ADVICE_NORMAL means no special treatment.
+	ADVICE_NORMAL = iota
+	// ADVICE_RANDOM means, that the pages are expected to be accessed in random order.
+	ADVICE_RANDOM
+	// ADVICE_SEQUENTIAL means, that the pages are expected to be accessed in sequential order.
+	ADVICE_SEQUENTIAL
+	// ADVICE_WILLNEED means, that the pages are expected to be accessed soon, so they can be prefetched.
+	ADVICE_WILLNEED
+	// ADVICE_DONTNEED means, that the pages are not expected to be accessed soon, so they can be dropped.
+	// The data of a shared mapping is not lost, it will be reread from the object on the next access.
+	ADVICE_DONTNEED
 )
 
 var (
@@ -33,9 +51,19 @@ var (
 // 		return g(region.Data())
 // 	}
 // region may be gc'ed while its data is used by g().
-// To avoid this, you can use UseMemoryRegion() or region readers/writers.
+// To avoid this, use Acquire() to get a handle, which keeps the region alive
+// until it is released, or use region readers/writers.
 type MemoryRegion struct {
 	*memoryRegion
+	object Mappable
+	flag   int
+	offset int64
+	refs   regionRefs
+}
+
+// truncater is an object, which size can be changed.
+type truncater interface {
+	Truncate(size int64) error
 }
 
 // Mappable is a named object, which can return a handle,
@@ -54,7 +82,32 @@ func NewMemoryRegion(object Mappable, flag int, offset int64, size int) (*Memory
 	if err != nil {
 		return nil, err
 	}
-	result := &MemoryRegion{impl}
+	result := &MemoryRegion{memoryRegion: impl, object: object, flag: flag, offset: offset}
+	runtime.SetFinalizer(impl, func(region *memoryRegion) {
+		region.Close()
+	})
+	return result, nil
+}
+
+// NewGuardedMemoryRegion creates a new shared memory region with inaccessible guard pages around it.
+// Any access to a guard page causes a fault, so an overrun of the region is detected immediately.
+// The mapping is extended to the page boundaries, so to detect an overrun right after the end of the data,
+// the sum of the offset and the size should be a multiple of the page size.
+// Guarded regions can't be resized. Guard pages are supported on Linux only.
+// 	object - an object to mmap.
+// 	flag - open flags. see MEM_* constants.
+// 	offset - offset in bytes from the beginning of the mmaped file.
+// 	size - mapping size.
+// 	guardPages - number of guard pages before and after the region.
+func NewGuardedMemoryRegion(object Mappable, flag int, offset int64, size int, guardPages int) (*MemoryRegion, error) {
+	if guardPages <= 0 {
+		return nil, errors.New("invalid number of guard pages")
+	}
+	impl, err := newGuardedMemoryRegion(object, flag, offset, size, guardPages*os.Getpagesize())
+	if err != nil {
+		return nil, err
+	}
+	result := &MemoryRegion{memoryRegion: impl, object: object, flag: flag, offset: offset}
 	runtime.SetFinalizer(impl, func(region *memoryRegion) {
 		region.Close()
 	})
@@ -62,13 +115,35 @@ func NewMemoryRegion(object Mappable, flag int, offset int64, size int) (*Memory
 }
 
 // Close unmaps the regions so that it cannot be longer used.
+// If there are handles, which were not released, ErrRegionInUse is returned.
 func (region *MemoryRegion) Close() error {
+	if !region.refs.close() {
+		return ErrRegionInUse
+	}
+	region.object = nil
+	return region.memoryRegion.Close()
+}
+
+// CloseWait waits for all the handles of the region to be released and closes it.
+// New handles can't be acquired while CloseWait is waiting.
+// Passing negative value as a timeout makes the timeout infinite.
+// If the timeout expires, ErrRegionInUse is returned, and the region remains open.
+func (region *MemoryRegion) CloseWait(timeout time.Duration) error {
+	if !region.refs.closeWait(timeout) {
+		return ErrRegionInUse
+	}
+	region.object = nil
 	return region.memoryRegion.Close()
 }
 
 // Data returns region's mapped data.
 // This function can be dangerous and could be removed in future releases.
+// Use Acquire to get the data safely.
+// In debug mode it panics, if the region is closed.
 func (region *MemoryRegion) Data() []byte {
+	if debugEnabled() && region.data == nil {
+		panic("mmf: access to the data of a closed memory region")
+	}
 	return region.memoryRegion.Data()
 }
 
@@ -82,6 +157,108 @@ func (region *MemoryRegion) Size() int {
 	return region.memoryRegion.Size()
 }
 
+// Resize changes the size of the region.
+// If the new size exceeds the size of the object, the object is grown first.
+// In this case it must be still open and must have Truncate(int64) method.
+// Shrinking the region does not shrink the object.
+// On Linux the mapping is resized with mremap. If it fails, or on other platforms,
+// a new mapping is created, if mayMove is true, which requires the object to be open.
+// If mayMove is false, and the mapping can't be resized in place, an error is returned.
+// Returns true, if the data was moved to another address.
+// In this case all the slices, previously returned by Data, become invalid.
+// MemoryRegionReader and MemoryRegionWriter can still be used after the resize.
+// If there are handles, which were not released, ErrRegionInUse is returned.
+func (region *MemoryRegion) Resize(newSize int, mayMove bool) (bool, error) {
+	if newSize <= 0 {
+		return false, errors.New("invalid size")
+	}
+	if region.data == nil {
+		return false, errors.New("the region is closed")
+	}
+	if region.refs.inUse() {
+		return false, ErrRegionInUse
+	}
+	if newSize == region.size {
+		return false, nil
+	}
+	if region.guard > 0 {
+		return false, errors.New("guarded regions can't be resized")
+	}
+	if newSize > region.size {
+		if err := region.growObject(newSize); err != nil {
+			return false, err
+		}
+	}
+	oldAddr := allocator.ByteSliceData(region.data)
+	if err := region.remap(newSize, mayMove); err != nil {
+		if !mayMove {
+			return false, err
+		}
+		if err = region.recreate(newSize); err != nil {
+			return false, err
+		}
+	}
+	return allocator.ByteSliceData(region.data) != oldAddr, nil
+}
+
+// Advise gives the os a hint about how a range of the region is going to be used.
+//	offset - offset of the range from the beginning of the region data.
+//	length - length of the range.
+//	advice - one of ADVICE_* constants.
+// The range is extended to the page boundaries.
+func (region *MemoryRegion) Advise(offset, length, advice int) error {
+	pages, err := region.pages(offset, length)
+	if err != nil || len(pages) == 0 {
+		return err
+	}
+	return madvise(pages, advice)
+}
+
+// Lock locks the pages of a range of the region in memory, so that they are not paged out.
+// The range is extended to the page boundaries.
+func (region *MemoryRegion) Lock(offset, length int) error {
+	pages, err := region.pages(offset, length)
+	if err != nil || len(pages) == 0 {
+		return err
+	}
+	return mlock(pages)
+}
+
+// Unlock unlocks the pages of a range of the region, which were locked with Lock.
+// The range is extended to the page boundaries.
+func (region *MemoryRegion) Unlock(offset, length int) error {
+	pages, err := region.pages(offset, length)
+	if err != nil || len(pages) == 0 {
+		return err
+	}
+	return munlock(pages)
+}
+
+// Protect changes the access protection of the pages of a range of the region.
+//	offset - offset of the range from the beginning of the region data.
+//	length - length of the range.
+//	mode - one of MEM_READ_ONLY, MEM_READWRITE, or MEM_NO_ACCESS.
+// The range is extended to the page boundaries.
+// The protection can't give more access, than the object was opened with.
+func (region *MemoryRegion) Protect(offset, length, mode int) error {
+	pages, err := region.pages(offset, length)
+	if err != nil || len(pages) == 0 {
+		return err
+	}
+	return mprotect(pages, mode)
+}
+
+// Resident returns the residency status of the pages of a range of the region.
+// The result contains one value for each page of the range, extended to the page boundaries.
+// A value is true, if the page is resident in memory.
+func (region *MemoryRegion) Resident(offset, length int) ([]bool, error) {
+	pages, err := region.pages(offset, length)
+	if err != nil || len(pages) == 0 {
+		return nil, err
+	}
+	return mincore(pages)
+}
+
 // UseMemoryRegion ensures, that the object is still alive at the moment of the call.
 // The usecase is when you use memory region's Data() and don't use the
 // region itself anymore. In this case the region can be gc'ed, the memory mapping
@@ -91,12 +268,69 @@ func (region *MemoryRegion) Size() int {
 //	defer UseMemoryRegion(region)
 // 	data := region.Data()
 //	{ work with data }
-// However, it is better to use MemoryRegionReader/Writer.
+// However, it is better to use Acquire() or MemoryRegionReader/Writer.
 // This function could be removed in future releases.
 func UseMemoryRegion(region *MemoryRegion) {
 	allocator.Use(unsafe.Pointer(region))
 }
 
+// growObject ensures, that the object is large enough to be mapped with the given size.
+func (region *MemoryRegion) growObject(size int) error {
+	if region.object == nil {
+		return errors.New("the object is unknown")
+	}
+	objSize, err := fileSizeFromFd(region.object)
+	if err != nil {
+		return errors.Wrap(err, "file size check failed")
+	}
+	required := region.offset + int64(size)
+	if objSize >= required {
+		return nil
+	}
+	t, ok := region.object.(truncater)
+	if !ok {
+		return errors.New("the object can't be grown")
+	}
+	if err = t.Truncate(required); err != nil {
+		return errors.Wrap(err, "failed to truncate the object")
+	}
+	return nil
+}
+
+// recreate replaces the mapping with a new one of the given size.
+func (region *MemoryRegion) recreate(size int) error {
+	if region.object == nil {
+		return errors.New("the object is unknown")
+	}
+	impl, err := newMemoryRegion(region.object, region.flag, region.offset, size)
+	if err != nil {
+		return errors.Wrap(err, "failed to create a new mapping")
+	}
+	*region.memoryRegion, *impl = *impl, *region.memoryRegion
+	if err = impl.Close(); err != nil {
+		return errors.Wrap(err, "failed to close the old mapping")
+	}
+	return nil
+}
+
+// pages returns the mapped data of the range, which starts at a page boundary.
+// the end of the range is not aligned, as the os does it itself.
+func (region *memoryRegion) pages(offset, length int) ([]byte, error) {
+	if region.data == nil {
+		return nil, errors.New("the region is closed")
+	}
+	if offset < 0 || length < 0 || offset+length > region.size {
+		return nil, errors.New("invalid range")
+	}
+	if length == 0 {
+		return nil, nil
+	}
+	start := int(region.pageOffset) + offset
+	end := start + length
+	start -= start % os.Getpagesize()
+	return region.data[start:end], nil
+}
+
 // calcMmapOffsetFixup returns a value X,
 // so that  offset - X is a valid mmap offset
 // typically the value of the fixup is a memory page size,
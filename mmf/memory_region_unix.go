@@ -23,9 +23,15 @@ type memoryRegion struct {
 	data       []byte
 	size       int
 	pageOffset int64
+	guard      int
 }
 
 func newMemoryRegion(obj Mappable, flag int, offset int64, size int) (*memoryRegion, error) {
+	return newGuardedMemoryRegion(obj, flag, offset, size, 0)
+}
+
+// newGuardedMemoryRegion maps the object with 'guard' bytes of inaccessible memory before and after the mapping.
+func newGuardedMemoryRegion(obj Mappable, flag int, offset int64, size int, guard int) (*memoryRegion, error) {
 	prot, flags, err := memProtAndFlagsFromMode(flag)
 	if err != nil {
 		return nil, errors.Wrap(err, "memory region flags check failed")
@@ -44,18 +50,29 @@ func newMemoryRegion(obj Mappable, flag int, offset int64, size int) (*memoryReg
 	}
 	pageOffset := calcMmapOffsetFixup(offset)
 	var data []byte
-	if data, err = unix.Mmap(int(obj.Fd()), offset-pageOffset, size+int(pageOffset), prot, flags); err != nil {
+	if guard == 0 {
+		data, err = mmap(int(obj.Fd()), offset-pageOffset, size+int(pageOffset), prot, flags)
+	} else {
+		data, err = mmapGuarded(int(obj.Fd()), offset-pageOffset, size+int(pageOffset), prot, flags, guard)
+	}
+	if err != nil {
 		return nil, errors.Wrap(err, "mmap failed")
 	}
-	return &memoryRegion{data: data, size: size, pageOffset: pageOffset}, nil
+	return &memoryRegion{data: data, size: size, pageOffset: pageOffset, guard: guard}, nil
 }
 
 func (region *memoryRegion) Close() error {
 	if region.data != nil {
-		err := unix.Munmap(region.data)
+		var err error
+		if region.guard == 0 {
+			err = munmap(region.data)
+		} else {
+			err = munmapGuarded(region.data, region.guard)
+		}
 		region.data = nil
 		region.pageOffset = 0
 		region.size = 0
+		region.guard = 0
 		return errors.Wrap(err, "munmap failed")
 	}
 	return nil
@@ -100,7 +117,89 @@ func memProtAndFlagsFromMode(mode int) (prot, flags int, err error) {
 	return
 }
 
+func sysProt(mode int) (int, error) {
+	switch mode {
+	case MEM_READ_ONLY:
+		return unix.PROT_READ, nil
+	case MEM_READWRITE:
+		return unix.PROT_READ | unix.PROT_WRITE, nil
+	case MEM_NO_ACCESS:
+		return unix.PROT_NONE, nil
+	default:
+		return 0, errors.Errorf("invalid protection mode %d", mode)
+	}
+}
+
+func sysAdvice(advice int) (int, error) {
+	switch advice {
+	case ADVICE_NORMAL:
+		return unix.MADV_NORMAL, nil
+	case ADVICE_RANDOM:
+		return unix.MADV_RANDOM, nil
+	case ADVICE_SEQUENTIAL:
+		return unix.MADV_SEQUENTIAL, nil
+	case ADVICE_WILLNEED:
+		return unix.MADV_WILLNEED, nil
+	case ADVICE_DONTNEED:
+		return unix.MADV_DONTNEED, nil
+	default:
+		return 0, errors.Errorf("invalid advice %d", advice)
+	}
+}
+
 // syscalls
+func madvise(data []byte, advice int) error {
+	sysAdv, err := sysAdvice(advice)
+	if err != nil {
+		return err
+	}
+	if err = unix.Madvise(data, sysAdv); err != nil {
+		return errors.Wrap(err, "madvise failed")
+	}
+	return nil
+}
+
+func mprotect(data []byte, mode int) error {
+	prot, err := sysProt(mode)
+	if err != nil {
+		return err
+	}
+	if err = unix.Mprotect(data, prot); err != nil {
+		return errors.Wrap(err, "mprotect failed")
+	}
+	return nil
+}
+
+func mlock(data []byte) error {
+	if err := unix.Mlock(data); err != nil {
+		return errors.Wrap(err, "mlock failed")
+	}
+	return nil
+}
+
+func munlock(data []byte) error {
+	if err := unix.Munlock(data); err != nil {
+		return errors.Wrap(err, "munlock failed")
+	}
+	return nil
+}
+
+func mincore(data []byte) ([]bool, error) {
+	pageSize := os.Getpagesize()
+	vec := make([]byte, (len(data)+pageSize-1)/pageSize)
+	dataPointer := unsafe.Pointer(&data[0])
+	_, _, err := unix.Syscall(unix.SYS_MINCORE, uintptr(dataPointer), uintptr(len(data)), uintptr(unsafe.Pointer(&vec[0])))
+	allocator.Use(dataPointer)
+	if err != syscall.Errno(0) {
+		return nil, errors.Wrap(err, "mincore failed")
+	}
+	result := make([]bool, len(vec))
+	for i, v := range vec {
+		result[i] = v&1 != 0
+	}
+	return result, nil
+}
+
 func msync(data []byte, flags int) error {
 	dataPointer := unsafe.Pointer(&data[0])
 	_, _, err := unix.Syscall(unix.SYS_MSYNC, uintptr(dataPointer), uintptr(len(data)), uintptr(flags))
@@ -5,6 +5,7 @@ package mmf
 import (
 	"os"
 	"runtime"
+	"syscall"
 	"unsafe"
 
 	"bitbucket.org/avd/go-ipc/internal/allocator"
@@ -23,10 +24,15 @@ func init() {
 	}
 }
 
+const (
+	errNotLocked = syscall.Errno(158) // ERROR_NOT_LOCKED
+)
+
 type memoryRegion struct {
 	data       []byte
 	size       int
 	pageOffset int64
+	guard      int
 }
 
 type native interface {
@@ -124,3 +130,65 @@ func sysProtAndFlagsFromFlag(mode int) (prot uint32, flags uint32, err error) {
 	}
 	return
 }
+
+func newGuardedMemoryRegion(obj Mappable, mode int, offset int64, size int, guard int) (*memoryRegion, error) {
+	return nil, errors.New("guard pages are not supported on this platform")
+}
+
+func mprotect(data []byte, mode int) error {
+	var prot uint32
+	switch mode {
+	case MEM_READ_ONLY:
+		prot = windows.PAGE_READONLY
+	case MEM_READWRITE:
+		prot = windows.PAGE_READWRITE
+	case MEM_NO_ACCESS:
+		prot = windows.PAGE_NOACCESS
+	default:
+		return errors.Errorf("invalid protection mode %d", mode)
+	}
+	var old uint32
+	if err := windows.VirtualProtect(uintptr(allocator.ByteSliceData(data)), uintptr(len(data)), prot, &old); err != nil {
+		return errors.Wrap(err, "VirtualProtect failed")
+	}
+	return nil
+}
+
+func madvise(data []byte, advice int) error {
+	switch advice {
+	case ADVICE_NORMAL, ADVICE_RANDOM, ADVICE_SEQUENTIAL, ADVICE_WILLNEED:
+		// these are only hints, which can be ignored.
+		return nil
+	case ADVICE_DONTNEED:
+		// unlocking pages, that are not locked, removes them from the working set.
+		err := windows.VirtualUnlock(uintptr(allocator.ByteSliceData(data)), uintptr(len(data)))
+		if err != nil && err != errNotLocked {
+			return errors.Wrap(err, "VirtualUnlock failed")
+		}
+		return nil
+	default:
+		return errors.Errorf("invalid advice %d", advice)
+	}
+}
+
+func mlock(data []byte) error {
+	if err := windows.VirtualLock(uintptr(allocator.ByteSliceData(data)), uintptr(len(data))); err != nil {
+		return errors.Wrap(err, "VirtualLock failed")
+	}
+	return nil
+}
+
+func munlock(data []byte) error {
+	if err := windows.VirtualUnlock(uintptr(allocator.ByteSliceData(data)), uintptr(len(data))); err != nil {
+		return errors.Wrap(err, "VirtualUnlock failed")
+	}
+	return nil
+}
+
+func mincore(data []byte) ([]bool, error) {
+	return nil, errors.New("page residency check is not supported on this platform")
+}
+
+func (region *memoryRegion) remap(size int, mayMove bool) error {
+	return errors.New("remapping is not supported on this platform")
+}
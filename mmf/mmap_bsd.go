@@ -0,0 +1,30 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build darwin freebsd
+
+package mmf
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+func mmap(fd int, offset int64, length int, prot int, flags int) ([]byte, error) {
+	return unix.Mmap(fd, offset, length, prot, flags)
+}
+
+func munmap(data []byte) error {
+	return unix.Munmap(data)
+}
+
+func (region *memoryRegion) remap(size int, mayMove bool) error {
+	return errors.New("remapping is not supported on this platform")
+}
+
+func mmapGuarded(fd int, offset int64, length int, prot int, flags int, guard int) ([]byte, error) {
+	return nil, errors.New("guard pages are not supported on this platform")
+}
+
+func munmapGuarded(data []byte, guard int) error {
+	return errors.New("guard pages are not supported on this platform")
+}
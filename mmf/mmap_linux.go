@@ -0,0 +1,119 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package mmf
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	cMREMAP_MAYMOVE = 1
+)
+
+// on linux we do not use unix.Mmap/unix.Munmap, as they keep track of all the mappings,
+// and a region, which was remapped with mremap, could not be unmapped then.
+
+func mmap(fd int, offset int64, length int, prot int, flags int) ([]byte, error) {
+	if length <= 0 {
+		return nil, unix.EINVAL
+	}
+	addr, err := mmapAt(0, fd, offset, length, prot, flags)
+	if err != nil {
+		return nil, err
+	}
+	return allocator.ByteSliceFromUnsafePointer(uintptrToPointer(addr), length, length), nil
+}
+
+// mmapGuarded reserves inaccessible memory for the mapping and the guard areas,
+// and then maps the object in the middle of it.
+func mmapGuarded(fd int, offset int64, length int, prot int, flags int, guard int) ([]byte, error) {
+	if length <= 0 {
+		return nil, unix.EINVAL
+	}
+	total := guardedLength(length, guard)
+	addr, err := mmapAt(0, -1, 0, total, unix.PROT_NONE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = mmapAt(addr+uintptr(guard), fd, offset, length, prot, flags|unix.MAP_FIXED); err != nil {
+		munmapAt(addr, total)
+		return nil, err
+	}
+	return allocator.ByteSliceFromUnsafePointer(uintptrToPointer(addr+uintptr(guard)), length, length), nil
+}
+
+func mmapAt(addr uintptr, fd int, offset int64, length int, prot int, flags int) (uintptr, error) {
+	result, _, err := unix.Syscall6(sysMmap, addr, uintptr(length), uintptr(prot), uintptr(flags), uintptr(fd), uintptr(offset>>mmapOffsetShift))
+	if err != syscall.Errno(0) {
+		return 0, os.NewSyscallError("MMAP", err)
+	}
+	return result, nil
+}
+
+func munmap(data []byte) error {
+	if len(data) == 0 {
+		return unix.EINVAL
+	}
+	return munmapAt(uintptr(allocator.ByteSliceData(data)), len(data))
+}
+
+// munmapGuarded unmaps the data mapped with mmapGuarded along with its guard areas.
+func munmapGuarded(data []byte, guard int) error {
+	if len(data) == 0 {
+		return unix.EINVAL
+	}
+	return munmapAt(uintptr(allocator.ByteSliceData(data))-uintptr(guard), guardedLength(len(data), guard))
+}
+
+func munmapAt(addr uintptr, length int) error {
+	_, _, err := unix.Syscall(unix.SYS_MUNMAP, addr, uintptr(length), 0)
+	if err != syscall.Errno(0) {
+		return os.NewSyscallError("MUNMAP", err)
+	}
+	return nil
+}
+
+// guardedLength returns the length of the mapping along with its guard areas.
+func guardedLength(length, guard int) int {
+	pageSize := os.Getpagesize()
+	return (length+pageSize-1)/pageSize*pageSize + 2*guard
+}
+
+func mremap(data []byte, newLength int, flags int) ([]byte, error) {
+	addr, _, err := unix.Syscall6(unix.SYS_MREMAP, uintptr(allocator.ByteSliceData(data)), uintptr(len(data)), uintptr(newLength), uintptr(flags), 0, 0)
+	if err != syscall.Errno(0) {
+		return nil, os.NewSyscallError("MREMAP", err)
+	}
+	return allocator.ByteSliceFromUnsafePointer(uintptrToPointer(addr), newLength, newLength), nil
+}
+
+// remap changes the size of the mapping, preserving its offset and contents.
+// if mayMove is false, and the mapping cannot be expanded in place, an error is returned.
+func (region *memoryRegion) remap(size int, mayMove bool) error {
+	if region.data == nil {
+		return errors.New("the region is closed")
+	}
+	flags := 0
+	if mayMove {
+		flags = cMREMAP_MAYMOVE
+	}
+	data, err := mremap(region.data, size+int(region.pageOffset), flags)
+	if err != nil {
+		return errors.Wrap(err, "mremap failed")
+	}
+	region.data = data
+	region.size = size
+	return nil
+}
+
+// uintptrToPointer converts an address returned by the kernel into a pointer.
+func uintptrToPointer(addr uintptr) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&addr))
+}
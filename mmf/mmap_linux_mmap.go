@@ -0,0 +1,14 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux,!386,!arm,!mips,!mipsle
+
+package mmf
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+const (
+	sysMmap         = unix.SYS_MMAP
+	mmapOffsetShift = 0
+)
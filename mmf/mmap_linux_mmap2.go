@@ -0,0 +1,15 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux,386 linux,arm linux,mips linux,mipsle
+
+package mmf
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// 32-bit platforms use mmap2, which takes the offset in 4096-byte units.
+const (
+	sysMmap         = unix.SYS_MMAP2
+	mmapOffsetShift = 12
+)
@@ -6,8 +6,12 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"runtime"
+	"runtime/debug"
 	"testing"
 
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -165,3 +169,267 @@ func ExampleMemoryRegion() {
 		panic("flush")
 	}
 }
+
+func TestMemoryRegionAdviseLockResident(t *testing.T) {
+	a := assert.New(t)
+	pageSize := os.Getpagesize()
+	tmp, err := ioutil.TempFile("", "advise")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if !a.NoError(tmp.Truncate(int64(pageSize * 4))) {
+		return
+	}
+	region, err := NewMemoryRegion(tmp, MEM_READWRITE, int64(pageSize), pageSize*3)
+	if !a.NoError(err) {
+		return
+	}
+	defer region.Close()
+	a.Error(region.Advise(-1, 1, ADVICE_NORMAL))
+	a.Error(region.Advise(pageSize, pageSize*2+1, ADVICE_NORMAL))
+	a.Error(region.Advise(0, 1, 100))
+	a.NoError(region.Advise(0, 0, ADVICE_NORMAL))
+	a.NoError(region.Advise(1, pageSize, ADVICE_WILLNEED))
+	a.NoError(region.Advise(0, pageSize*3, ADVICE_RANDOM))
+	data := region.Data()
+	data[pageSize+1] = 1
+	if err = region.Lock(pageSize+1, 10); err == nil {
+		a.NoError(region.Unlock(pageSize+1, 10))
+	}
+	a.NoError(region.Advise(0, pageSize*3, ADVICE_DONTNEED))
+	a.Equal(byte(1), data[pageSize+1])
+	if runtime.GOOS == "windows" {
+		return
+	}
+	resident, err := region.Resident(pageSize+1, pageSize)
+	if !a.NoError(err) {
+		return
+	}
+	a.Len(resident, 2)
+	a.True(resident[0])
+}
+
+func TestMemoryRegionResize(t *testing.T) {
+	a := assert.New(t)
+	pageSize := os.Getpagesize()
+	tmp, err := ioutil.TempFile("", "resize")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if !a.NoError(tmp.Truncate(int64(pageSize))) {
+		return
+	}
+	region, err := NewMemoryRegion(tmp, MEM_READWRITE, 0, pageSize)
+	if !a.NoError(err) {
+		return
+	}
+	defer region.Close()
+	rd, wr := NewMemoryRegionReader(region), NewMemoryRegionWriter(region)
+	_, err = wr.Write([]byte("hello"))
+	a.NoError(err)
+	_, err = region.Resize(0, true)
+	a.Error(err)
+	moved, err := region.Resize(pageSize*16, true)
+	if !a.NoError(err) {
+		return
+	}
+	if !moved {
+		_, err = region.Resize(pageSize*32, false)
+		a.NoError(err)
+	}
+	stat, err := tmp.Stat()
+	if a.NoError(err) {
+		a.True(stat.Size() >= int64(pageSize*16))
+	}
+	a.Equal(int64(region.Size()), rd.Size())
+	n, err := wr.WriteAt([]byte("world"), int64(pageSize*15))
+	a.NoError(err)
+	a.Equal(5, n)
+	buf := make([]byte, 5)
+	_, err = rd.ReadAt(buf, 0)
+	a.NoError(err)
+	a.Equal([]byte("hello"), buf)
+	_, err = rd.ReadAt(buf, int64(pageSize*15))
+	a.NoError(err)
+	a.Equal([]byte("world"), buf)
+	_, err = region.Resize(pageSize, true)
+	a.NoError(err)
+	a.Equal(pageSize, region.Size())
+	a.Equal(pageSize, rd.Len())
+	_, err = rd.ReadAt(buf, int64(pageSize*15))
+	a.Equal(io.EOF, err)
+	b, err := rd.ReadByte()
+	a.NoError(err)
+	a.Equal(byte('h'), b)
+}
+
+func TestMemoryRegionReaderScanner(t *testing.T) {
+	a := assert.New(t)
+	tmp, err := ioutil.TempFile("", "scanner")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	data := "hi, мир"
+	if _, err = tmp.Write([]byte(data)); !a.NoError(err) {
+		return
+	}
+	region, err := NewMemoryRegion(tmp, MEM_READ_ONLY, 0, len(data))
+	if !a.NoError(err) {
+		return
+	}
+	defer region.Close()
+	rd := NewMemoryRegionReader(region)
+	a.Error(rd.UnreadByte())
+	a.Error(rd.UnreadRune())
+	_, err = rd.Seek(4, io.SeekStart)
+	a.NoError(err)
+	ch, size, err := rd.ReadRune()
+	a.NoError(err)
+	a.Equal('м', ch)
+	a.Equal(2, size)
+	a.NoError(rd.UnreadRune())
+	a.Error(rd.UnreadRune())
+	a.Equal(len(data)-4, rd.Len())
+	b, err := rd.ReadByte()
+	a.NoError(err)
+	a.NoError(rd.UnreadByte())
+	b2, err := rd.ReadByte()
+	a.NoError(err)
+	a.Equal(b, b2)
+	a.Error(rd.UnreadRune())
+	rd.Reset(region)
+	ch, _, err = rd.ReadRune()
+	a.NoError(err)
+	a.Equal('h', ch)
+	_, err = rd.Seek(0, io.SeekEnd)
+	a.NoError(err)
+	_, _, err = rd.ReadRune()
+	a.Equal(io.EOF, err)
+}
+
+var faultSink byte
+
+// faults returns true, if f causes a memory fault.
+func faults(f func()) (result bool) {
+	old := debug.SetPanicOnFault(true)
+	defer func() {
+		debug.SetPanicOnFault(old)
+		result = recover() != nil
+	}()
+	f()
+	return false
+}
+
+func TestMemoryRegionProtect(t *testing.T) {
+	a := assert.New(t)
+	pageSize := os.Getpagesize()
+	tmp, err := ioutil.TempFile("", "protect")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if !a.NoError(tmp.Truncate(int64(pageSize * 2))) {
+		return
+	}
+	region, err := NewMemoryRegion(tmp, MEM_READWRITE, 0, pageSize*2)
+	if !a.NoError(err) {
+		return
+	}
+	defer region.Close()
+	data := region.Data()
+	a.Error(region.Protect(0, pageSize, MEM_COPY_ON_WRITE))
+	a.Error(region.Protect(pageSize, pageSize*2, MEM_READ_ONLY))
+	a.NoError(region.Protect(pageSize+1, 1, MEM_READ_ONLY))
+	a.False(faults(func() { data[0] = 1 }))
+	a.True(faults(func() { data[pageSize] = 1 }))
+	a.NoError(region.Protect(pageSize, pageSize, MEM_NO_ACCESS))
+	a.True(faults(func() { faultSink = data[pageSize] }))
+	a.NoError(region.Protect(pageSize, pageSize, MEM_READWRITE))
+	a.False(faults(func() { data[pageSize] = 1 }))
+}
+
+func TestGuardedMemoryRegion(t *testing.T) {
+	a := assert.New(t)
+	pageSize := os.Getpagesize()
+	tmp, err := ioutil.TempFile("", "guarded")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if !a.NoError(tmp.Truncate(int64(pageSize))) {
+		return
+	}
+	_, err = NewGuardedMemoryRegion(tmp, MEM_READWRITE, 0, pageSize, 0)
+	a.Error(err)
+	region, err := NewGuardedMemoryRegion(tmp, MEM_READWRITE, 0, pageSize, 1)
+	if runtime.GOOS != "linux" {
+		a.Error(err)
+		return
+	}
+	if !a.NoError(err) {
+		return
+	}
+	data := region.Data()
+	data[pageSize-1] = 1
+	_, err = region.Resize(pageSize*2, true)
+	a.Error(err)
+	overrun := allocator.ByteSliceFromUnsafePointer(allocator.ByteSliceData(data), pageSize+1, pageSize+1)
+	a.True(faults(func() { overrun[pageSize] = 1 }))
+	a.NoError(region.Close())
+}
+
+func TestMemoryRegionAtomics(t *testing.T) {
+	a := assert.New(t)
+	tmp, err := ioutil.TempFile("", "atomic")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if !a.NoError(tmp.Truncate(64)) {
+		return
+	}
+	region, err := NewMemoryRegion(tmp, MEM_READWRITE, 0, 64)
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(region.StoreInt32(4, -5))
+	v32, err := region.AddInt32(4, 2)
+	a.NoError(err)
+	a.Equal(int32(-3), v32)
+	u32, err := region.SwapUint32(4, 7)
+	a.NoError(err)
+	a.Equal(uint32(0xfffffffd), u32)
+	swapped, err := region.CompareAndSwapUint32(4, 7, 8)
+	a.NoError(err)
+	a.True(swapped)
+	u32, err = region.LoadUint32(4)
+	a.NoError(err)
+	a.Equal(uint32(8), u32)
+	a.NoError(region.StoreUint64(56, 1<<40))
+	v64, err := region.AddInt64(56, -1)
+	a.NoError(err)
+	a.Equal(int64(1<<40-1), v64)
+	swapped, err = region.CompareAndSwapInt64(56, 0, 1)
+	a.NoError(err)
+	a.False(swapped)
+	_, err = region.LoadInt32(2)
+	a.Error(err)
+	_, err = region.LoadInt64(4)
+	a.Error(err)
+	_, err = region.LoadUint64(60)
+	a.Error(err)
+	_, err = region.LoadUint32(-4)
+	a.Error(err)
+	a.NoError(region.Close())
+	_, err = region.LoadUint32(0)
+	a.Error(err)
+}
@@ -3,23 +3,152 @@
 package mmf
 
 import (
-	"bytes"
 	"io"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
 )
 
 // MemoryRegionReader is a reader for safe operations over a shared memory region.
 // It holds a reference to the region, so the former can't be gc'ed.
+// The reader accesses current region's data on each call, so it can be used after the region was resized.
 type MemoryRegionReader struct {
-	region *MemoryRegion
-	*bytes.Reader
+	region   *MemoryRegion
+	pos      int64
+	prevRune int64 // position of the previous rune; or < 0.
 }
 
 // NewMemoryRegionReader creates a new reader for the given region.
 func NewMemoryRegionReader(region *MemoryRegion) *MemoryRegionReader {
-	return &MemoryRegionReader{
-		region: region,
-		Reader: bytes.NewReader(region.Data()),
+	return &MemoryRegionReader{region: region, prevRune: -1}
+}
+
+// Reset resets the reader to be reading from the beginning of the given region.
+func (r *MemoryRegionReader) Reset(region *MemoryRegion) {
+	*r = MemoryRegionReader{region: region, prevRune: -1}
+}
+
+// ReadAt is to implement io.ReaderAt.
+func (r *MemoryRegionReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	data := r.region.Data()
+	if off >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n = copy(p, data[off:])
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+// Read is to implement io.Reader.
+func (r *MemoryRegionReader) Read(p []byte) (n int, err error) {
+	r.prevRune = -1
+	n, err = r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadByte is to implement io.ByteReader.
+func (r *MemoryRegionReader) ReadByte() (byte, error) {
+	var b [1]byte
+	if _, err := r.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// UnreadByte complements ReadByte in implementing io.ByteScanner.
+func (r *MemoryRegionReader) UnreadByte() error {
+	if r.pos <= 0 {
+		return errors.New("at beginning of the region")
 	}
+	r.prevRune = -1
+	r.pos--
+	return nil
+}
+
+// ReadRune is to implement io.RuneReader.
+func (r *MemoryRegionReader) ReadRune() (ch rune, size int, err error) {
+	data := r.region.Data()
+	if r.pos >= int64(len(data)) {
+		r.prevRune = -1
+		return 0, 0, io.EOF
+	}
+	r.prevRune = r.pos
+	if c := data[r.pos]; c < utf8.RuneSelf {
+		r.pos++
+		return rune(c), 1, nil
+	}
+	ch, size = utf8.DecodeRune(data[r.pos:])
+	r.pos += int64(size)
+	return
+}
+
+// UnreadRune complements ReadRune in implementing io.RuneScanner.
+func (r *MemoryRegionReader) UnreadRune() error {
+	if r.prevRune < 0 {
+		return errors.New("previous operation was not ReadRune")
+	}
+	r.pos = r.prevRune
+	r.prevRune = -1
+	return nil
+}
+
+// Seek is to implement io.Seeker.
+func (r *MemoryRegionReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.pos + offset
+	case io.SeekEnd:
+		pos = int64(r.region.Size()) + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.prevRune = -1
+	r.pos = pos
+	return pos, nil
+}
+
+// WriteTo is to implement io.WriterTo.
+func (r *MemoryRegionReader) WriteTo(w io.Writer) (n int64, err error) {
+	r.prevRune = -1
+	data := r.region.Data()
+	if r.pos >= int64(len(data)) {
+		return 0, nil
+	}
+	rest := data[r.pos:]
+	written, err := w.Write(rest)
+	r.pos += int64(written)
+	if err == nil && written < len(rest) {
+		err = io.ErrShortWrite
+	}
+	return int64(written), err
+}
+
+// Len returns the number of the unread bytes of the region.
+func (r *MemoryRegionReader) Len() int {
+	if left := int64(r.region.Size()) - r.pos; left > 0 {
+		return int(left)
+	}
+	return 0
+}
+
+// Size returns current size of the region.
+func (r *MemoryRegionReader) Size() int64 {
+	return int64(r.region.Size())
 }
 
 // MemoryRegionWriter is a writer for safe operations over a shared memory region.
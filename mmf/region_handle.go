@@ -0,0 +1,153 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package mmf
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrRegionInUse is returned, when a region, which has unreleased handles, is being closed or resized.
+	ErrRegionInUse = errors.New("the region has unreleased handles")
+
+	debugMode int32
+)
+
+// SetDebug enables or disables debug checks for memory regions.
+// In debug mode an access to the data of a closed region, or of a released handle panics
+// with a clear message instead of reading or corrupting memory, which may be unmapped.
+// Debug checks can't protect slices, which were obtained before the region was closed.
+func SetDebug(enable bool) {
+	var value int32
+	if enable {
+		value = 1
+	}
+	atomic.StoreInt32(&debugMode, value)
+}
+
+func debugEnabled() bool {
+	return atomic.LoadInt32(&debugMode) != 0
+}
+
+// RegionHandle keeps a region mapped until it is released.
+type RegionHandle struct {
+	region   *MemoryRegion
+	released int32
+}
+
+// Acquire returns a handle, which keeps the region mapped until Release is called.
+// While there are unreleased handles, Close and Resize fail, and CloseWait waits for them.
+func (region *MemoryRegion) Acquire() (*RegionHandle, error) {
+	if !region.refs.acquire() {
+		return nil, errors.New("the region is closed")
+	}
+	return &RegionHandle{region: region}, nil
+}
+
+// Data returns the data of the region. It is valid until the handle is released.
+// In debug mode it panics, if the handle was released.
+func (h *RegionHandle) Data() []byte {
+	if atomic.LoadInt32(&h.released) != 0 {
+		if debugEnabled() {
+			panic("mmf: access to the data of a released region handle")
+		}
+		return nil
+	}
+	return h.region.Data()
+}
+
+// Release releases the handle. The data, returned by the handle, must not be used after that.
+// In debug mode it panics, if the handle was already released.
+func (h *RegionHandle) Release() {
+	if !atomic.CompareAndSwapInt32(&h.released, 0, 1) {
+		if debugEnabled() {
+			panic("mmf: region handle is released twice")
+		}
+		return
+	}
+	h.region.refs.release()
+}
+
+// regionRefs counts handles of a region.
+type regionRefs struct {
+	mut     sync.Mutex
+	handles int
+	closing bool
+	closed  bool
+	idle    chan struct{}
+}
+
+func (r *regionRefs) acquire() bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if r.closing || r.closed {
+		return false
+	}
+	if r.handles == 0 {
+		r.idle = make(chan struct{})
+	}
+	r.handles++
+	return true
+}
+
+func (r *regionRefs) release() {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.handles--
+	if r.handles == 0 {
+		close(r.idle)
+	}
+}
+
+// inUse returns true, if there are unreleased handles.
+func (r *regionRefs) inUse() bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.handles > 0
+}
+
+// close marks the region as closed, if there are no handles.
+func (r *regionRefs) close() bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if r.handles > 0 {
+		return false
+	}
+	r.closed = true
+	return true
+}
+
+// closeWait waits for the handles to be released and marks the region as closed.
+func (r *regionRefs) closeWait(timeout time.Duration) bool {
+	r.mut.Lock()
+	if r.handles == 0 {
+		r.closed = true
+		r.mut.Unlock()
+		return true
+	}
+	r.closing = true
+	idle := r.idle
+	r.mut.Unlock()
+	var expired <-chan time.Time
+	if timeout >= 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-idle:
+	case <-expired:
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.closing = false
+	if r.handles > 0 {
+		return false
+	}
+	r.closed = true
+	return true
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package mmf
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeHandleTestRegion(a *assert.Assertions) (*MemoryRegion, func()) {
+	tmp, err := ioutil.TempFile("", "handle")
+	if !a.NoError(err) {
+		return nil, nil
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	if !a.NoError(tmp.Truncate(1024)) {
+		cleanup()
+		return nil, nil
+	}
+	region, err := NewMemoryRegion(tmp, MEM_READWRITE, 0, 1024)
+	if !a.NoError(err) {
+		cleanup()
+		return nil, nil
+	}
+	return region, cleanup
+}
+
+func TestRegionHandleClose(t *testing.T) {
+	a := assert.New(t)
+	region, cleanup := makeHandleTestRegion(a)
+	if region == nil {
+		return
+	}
+	defer cleanup()
+	h1, err := region.Acquire()
+	if !a.NoError(err) {
+		return
+	}
+	h2, err := region.Acquire()
+	if !a.NoError(err) {
+		return
+	}
+	h1.Data()[0] = 1
+	a.Equal(byte(1), h2.Data()[0])
+	a.Equal(ErrRegionInUse, region.Close())
+	h1.Release()
+	h1.Release()
+	a.Nil(h1.Data())
+	a.Equal(ErrRegionInUse, region.CloseWait(10*time.Millisecond))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		h2.Release()
+	}()
+	a.NoError(region.CloseWait(-1))
+	_, err = region.Acquire()
+	a.Error(err)
+}
+
+func TestRegionHandleDebug(t *testing.T) {
+	a := assert.New(t)
+	region, cleanup := makeHandleTestRegion(a)
+	if region == nil {
+		return
+	}
+	defer cleanup()
+	SetDebug(true)
+	defer SetDebug(false)
+	h, err := region.Acquire()
+	if !a.NoError(err) {
+		return
+	}
+	h.Release()
+	a.Panics(func() { h.Data() })
+	a.Panics(func() { h.Release() })
+	a.NoError(region.Close())
+	a.Panics(func() { region.Data() })
+}
+
+func TestRegionHandleResize(t *testing.T) {
+	a := assert.New(t)
+	region, cleanup := makeHandleTestRegion(a)
+	if region == nil {
+		return
+	}
+	defer cleanup()
+	h, err := region.Acquire()
+	if !a.NoError(err) {
+		return
+	}
+	_, err = region.Resize(4096, true)
+	a.Equal(ErrRegionInUse, err)
+	a.Equal(1024, region.Size())
+	a.Len(h.Data(), 1024)
+	h.Release()
+	_, err = region.Resize(4096, true)
+	a.NoError(err)
+	a.Equal(4096, region.Size())
+	a.NoError(region.Close())
+}
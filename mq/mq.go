@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 )
 
 const (
@@ -90,6 +91,27 @@ func Destroy(name string) error {
 	return destroyMq(name)
 }
 
+// SetPermissions changes the mode and the ownership of the mq with the given name.
+// It uses the default implementation.
+//	name - unique queue name.
+//	perm - new permissions.
+func SetPermissions(name string, perm ipcperm.Permissions) error {
+	return setMqPermissions(name, perm)
+}
+
+// Chmod sets the exact mode of the mq with the given name.
+// It uses the default implementation.
+func Chmod(name string, mode os.FileMode) error {
+	return setMqPermissions(name, ipcperm.Mode(mode))
+}
+
+// Chown changes the owner and the group of the mq with the given name.
+// If uid or gid is -1, the corresponding value is not changed.
+// It uses the default implementation.
+func Chown(name string, uid, gid int) error {
+	return setMqPermissions(name, ipcperm.Owner(uid, gid))
+}
+
 func checkMqPerm(perm os.FileMode) bool {
 	return uint(perm)&0111 == 0
 }
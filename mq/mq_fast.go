@@ -7,8 +7,10 @@ import (
 	"runtime"
 	"time"
 
+	"bitbucket.org/avd/go-ipc/internal/attach"
 	"bitbucket.org/avd/go-ipc/internal/common"
 	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 	"bitbucket.org/avd/go-ipc/mmf"
 	"bitbucket.org/avd/go-ipc/shm"
 	ipc_sync "bitbucket.org/avd/go-ipc/sync"
@@ -47,6 +49,7 @@ type FastMq struct {
 	impl     *fastMq
 	condSend *ipc_sync.Cond
 	condRecv *ipc_sync.Cond
+	refs     *attach.Table
 }
 
 func openFastMq(name string, flag int, perm os.FileMode, maxQueueSize, maxMsgSize int) (*FastMq, error) {
@@ -71,6 +74,8 @@ func openFastMq(name string, flag int, perm os.FileMode, maxQueueSize, maxMsgSiz
 		name:   name,
 		flag:   flag,
 	}
+	// the objects, which have been opened, are closed, if any of the steps below,
+	// including the attachment, fails. all of them must assign err.
 	defer func() {
 		fastMqCleanup(result, created, err)
 	}()
@@ -95,6 +100,9 @@ func openFastMq(name string, flag int, perm os.FileMode, maxQueueSize, maxMsgSiz
 	if err != nil {
 		return nil, errors.Wrap(err, "fast mq: failed to create a recv cond")
 	}
+	if result.refs, err = attach.Open(name, perm); err != nil {
+		return nil, errors.Wrap(err, "fast mq: failed to attach")
+	}
 	result.impl = newFastMq(result.region.Data(), maxQueueSize, maxMsgSize, created)
 	return result, err
 }
@@ -126,6 +134,7 @@ func DestroyFastMq(name string) error {
 	errObject := shm.DestroyMemoryObject(fastMqStateName(name))
 	errCondSndDestroy := ipc_sync.DestroyCond(fastMqCondName(name, "s"))
 	errCondRcvDestroy := ipc_sync.DestroyCond(fastMqCondName(name, "r"))
+	errAttach := attach.Destroy(name)
 	if errMutex != nil {
 		return errors.Wrap(errMutex, "failed to destroy ipc locker")
 	}
@@ -138,9 +147,29 @@ func DestroyFastMq(name string) error {
 	if errCondRcvDestroy != nil {
 		return errors.Wrap(errCondRcvDestroy, "failed to destroy receive condvar")
 	}
+	if errAttach != nil {
+		return errors.Wrap(errAttach, "failed to destroy attach table")
+	}
 	return nil
 }
 
+// SetFastMqPermissions changes the mode and the ownership of all the objects, that make up a FastMq.
+func SetFastMqPermissions(name string, perm ipcperm.Permissions) error {
+	if err := shm.SetPermissions(fastMqStateName(name), perm); err != nil {
+		return errors.Wrap(err, "failed to set memory object permissions")
+	}
+	if err := ipc_sync.SetMutexPermissions(fastMqLockerName(name), perm); err != nil {
+		return errors.Wrap(err, "failed to set ipc locker permissions")
+	}
+	if err := ipc_sync.SetCondPermissions(fastMqCondName(name, "s"), perm); err != nil {
+		return errors.Wrap(err, "failed to set send condvar permissions")
+	}
+	if err := ipc_sync.SetCondPermissions(fastMqCondName(name, "r"), perm); err != nil {
+		return errors.Wrap(err, "failed to set receive condvar permissions")
+	}
+	return attach.SetPermissions(name, perm)
+}
+
 // FastMqAttrs returns capacity and max message size of the existing mq.
 func FastMqAttrs(name string) (int, int, error) {
 	obj, err := shm.NewMemoryObject(fastMqStateName(name), os.O_RDONLY, 0666)
@@ -276,23 +305,47 @@ func (mq *FastMq) SetBlocking(block bool) error {
 }
 
 // Close closes a FastMq instance.
+// The instance is detached from the mq, even if some of its objects failed to close,
+// and the first error is returned.
 func (mq *FastMq) Close() error {
 	errLocker := mq.locker.Close()
-	if errRegion := mq.region.Close(); errRegion != nil {
+	errRegion := mq.region.Close()
+	errCondSend := mq.condSend.Close()
+	errCondRecv := mq.condRecv.Close()
+	last, errDetach := mq.refs.Detach()
+	if errRegion != nil {
 		return errors.Wrap(errRegion, "failed to close memory region")
 	}
 	if errLocker != nil {
 		return errors.Wrap(errLocker, "failed to close ipc locker")
 	}
-	if err := mq.condSend.Close(); err != nil {
-		return errors.Wrap(err, "failed to close send cond")
+	if errCondSend != nil {
+		return errors.Wrap(errCondSend, "failed to close send cond")
+	}
+	if errCondRecv != nil {
+		return errors.Wrap(errCondRecv, "failed to close recv cond")
 	}
-	if err := mq.condRecv.Close(); err != nil {
-		return errors.Wrap(err, "failed to close recv cond")
+	if errDetach != nil {
+		return errors.Wrap(errDetach, "failed to detach from mq")
+	}
+	if last {
+		return DestroyFastMq(mq.name)
 	}
 	return nil
 }
 
+// SetDestroyOnClose sets whether the mq is destroyed, when the last process closes it.
+// The mode is shared between all processes, which use the mq.
+func (mq *FastMq) SetDestroyOnClose(enable bool) {
+	mq.refs.SetDestroyOnClose(enable)
+}
+
+// Attached returns the number of open instances of the mq in all processes.
+// Instances of crashed processes are not counted.
+func (mq *FastMq) Attached() int {
+	return mq.refs.Count()
+}
+
 // Destroy permanently removes a FastMq instance.
 func (mq *FastMq) Destroy() error {
 	e1, e2 := mq.Close(), DestroyFastMq(mq.name)
@@ -5,6 +5,10 @@ package mq
 import (
 	"os"
 	"testing"
+
+	"bitbucket.org/avd/go-ipc/internal/attach"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func fastMqCtor(name string, flag int, perm os.FileMode) (Messenger, error) {
@@ -88,3 +92,47 @@ func BenchmarkFastMqBlock(b *testing.B) {
 	params := &prioBenchmarkParams{readers: 4, writers: 4, mqSize: 8, msgSize: 1024, flag: 0}
 	benchmarkPrioMq1(b, fastMqCtorPrio, fastMqOpenerPrio, fastMqDtor, params)
 }
+
+func TestFastMqDestroyOnClose(t *testing.T) {
+	a := assert.New(t)
+	a.NoError(DestroyFastMq(testMqName))
+	mq, err := CreateFastMq(testMqName, os.O_EXCL, 0666, 1, DefaultFastMqMessageSize)
+	if !a.NoError(err) {
+		return
+	}
+	mq2, err := OpenFastMq(testMqName, 0)
+	if !a.NoError(err) {
+		mq.Destroy()
+		return
+	}
+	a.Equal(2, mq.Attached())
+	mq2.SetDestroyOnClose(true)
+	a.NoError(mq2.Close())
+	a.NoError(mq.Close())
+	_, err = OpenFastMq(testMqName, 0)
+	a.Error(err)
+}
+
+func TestFastMqOpenWhileDestroying(t *testing.T) {
+	a := assert.New(t)
+	a.NoError(DestroyFastMq(testMqName))
+	mq, err := CreateFastMq(testMqName, os.O_EXCL, 0666, 1, DefaultFastMqMessageSize)
+	if !a.NoError(err) {
+		return
+	}
+	defer mq.Destroy()
+	refs, err := attach.Open(fastMqCondName(testMqName, "s"), 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer refs.Detach()
+	// the queue is being destroyed by a living process, so it can't be opened,
+	// and the objects, opened before the attachment, must be closed.
+	mq.SetDestroyOnClose(true)
+	last, err := mq.refs.Detach()
+	a.NoError(err)
+	a.True(last)
+	_, err = OpenFastMq(testMqName, 0)
+	a.Error(err)
+	a.Equal(2, refs.Count())
+}
@@ -4,7 +4,11 @@
 
 package mq
 
-import "os"
+import (
+	"os"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
+)
 
 func createMQ(name string, flag int, perm os.FileMode) (Messenger, error) {
 	mq, err := CreateFastMq(name, flag, perm, DefaultFastMqMaxSize, DefaultFastMqMessageSize)
@@ -25,3 +29,7 @@ func openMQ(name string, flags int) (Messenger, error) {
 func destroyMq(name string) error {
 	return DestroyFastMq(name)
 }
+
+func setMqPermissions(name string, perm ipcperm.Permissions) error {
+	return SetFastMqPermissions(name, perm)
+}
@@ -4,7 +4,11 @@
 
 package mq
 
-import "os"
+import (
+	"os"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
+)
 
 func createMQ(name string, flag int, perm os.FileMode) (Messenger, error) {
 	mq, err := CreateLinuxMessageQueue(name, flag, perm, DefaultLinuxMqMaxSize, DefaultLinuxMqMessageSize)
@@ -25,3 +29,7 @@ func openMQ(name string, flags int) (Messenger, error) {
 func destroyMq(name string) error {
 	return DestroyLinuxMessageQueue(name)
 }
+
+func setMqPermissions(name string, perm ipcperm.Permissions) error {
+	return SetLinuxMessageQueuePermissions(name, perm)
+}
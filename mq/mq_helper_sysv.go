@@ -6,7 +6,11 @@
 
 package mq
 
-import "os"
+import (
+	"os"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
+)
 
 func createMQ(name string, flag int, perm os.FileMode) (Messenger, error) {
 	mq, err := CreateSystemVMessageQueue(name, flag, perm)
@@ -27,3 +31,7 @@ func openMQ(name string, flag int) (Messenger, error) {
 func destroyMq(name string) error {
 	return DestroySystemVMessageQueue(name)
 }
+
+func setMqPermissions(name string, perm ipcperm.Permissions) error {
+	return SetSystemVMessageQueuePermissions(name, perm)
+}
@@ -9,6 +9,7 @@ import (
 
 	"bitbucket.org/avd/go-ipc/internal/allocator"
 	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 
 	"github.com/pkg/errors"
 	"golang.org/x/sys/unix"
@@ -319,6 +320,27 @@ func DestroyLinuxMessageQueue(name string) error {
 	return err
 }
 
+// SetLinuxMessageQueuePermissions changes the mode and the ownership of the queue with the given name.
+func SetLinuxMessageQueuePermissions(name string, perm ipcperm.Permissions) error {
+	id, err := mq_open(name, unix.O_RDONLY|unix.O_CLOEXEC, uint32(0), nil)
+	if err != nil {
+		return errors.Wrap(err, "mq_open failed")
+	}
+	defer unix.Close(id)
+	if perm.ChangesMode() {
+		if err = unix.Fchmod(id, uint32(perm.Mode.Perm())); err != nil {
+			return errors.Wrap(os.NewSyscallError("FCHMOD", err), "failed to change mq mode")
+		}
+	}
+	if perm.ChangesOwner() {
+		uid, gid := perm.IDs()
+		if err = unix.Fchown(id, uid, gid); err != nil {
+			return errors.Wrap(os.NewSyscallError("FCHOWN", err), "failed to change mq owner")
+		}
+	}
+	return nil
+}
+
 // SetLinuxMqBlocking sets whether the operations on a linux mq block.
 // This will apply for all send/receive operations on any instance of the
 // linux mq with the given name.
@@ -20,6 +20,8 @@ const (
 	cMSGRCV = 12
 	cMSGGET = 13
 	cMSGCTL = 14
+
+	cIPC_64 = 0x100
 )
 
 func msgget(k common.Key, flags int) (int, error) {
@@ -72,8 +74,11 @@ func msgrcv(id int, data []byte, typ int, flags int) (int, error) {
 	return int(len), nil
 }
 
+// msgctl calls ipc syscall with IPC_64 flag, so that the kernel uses 64-bit ipc_perm.
 func msgctl(id int, cmd int, buf *msqidDs) error {
-	_, _, err := unix.Syscall(unix.SYS_IPC, uintptr(cMSGCTL), uintptr(id), uintptr(cmd))
+	pBuf := unsafe.Pointer(buf)
+	_, _, err := unix.Syscall6(unix.SYS_IPC, uintptr(cMSGCTL), uintptr(id), uintptr(cmd|cIPC_64), 0, uintptr(pBuf), 0)
+	allocator.Use(pBuf)
 	if err != syscall.Errno(0) {
 		return os.NewSyscallError("MSGCTL", err)
 	}
@@ -9,6 +9,7 @@ import (
 	"unsafe"
 
 	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 
 	"github.com/pkg/errors"
 )
@@ -27,8 +28,10 @@ type SystemVMessageQueue struct {
 	name  string
 }
 
-// msqidDs is for msgctl syscall, but it is not currently used
+// msqidDs is a buffer for msqid_ds struct, which is used in msgctl syscall.
+// Only its ipc_perm part is accessed, so the exact layout is not needed.
 type msqidDs struct {
+	data [common.IpcDsSize]byte
 }
 
 // this is to ensure, that system V implementation of ipc mq
@@ -154,3 +157,16 @@ func DestroySystemVMessageQueue(name string) error {
 	}
 	return err
 }
+
+// SetSystemVMessageQueuePermissions changes the mode and the ownership of the queue with the given name.
+func SetSystemVMessageQueuePermissions(name string, perm ipcperm.Permissions) error {
+	mq, err := OpenSystemVMessageQueue(name, 0)
+	if err != nil {
+		return errors.Wrap(err, "open mq")
+	}
+	ctl := func(cmd int, ds unsafe.Pointer) error {
+		return msgctl(mq.id, cmd, (*msqidDs)(ds))
+	}
+	uid, gid := perm.IDs()
+	return common.SetIpcPermissions(name, ctl, perm.Mode, uid, gid)
+}
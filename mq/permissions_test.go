@@ -0,0 +1,78 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux
+
+package mq
+
+import (
+	"os"
+	"testing"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/ipcperm"
+	"bitbucket.org/avd/go-ipc/shm"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestSysVMqPermissions(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySystemVMessageQueue(testMqName)) {
+		return
+	}
+	mq, err := CreateSystemVMessageQueue(testMqName, os.O_EXCL, 0600)
+	if !a.NoError(err) {
+		return
+	}
+	defer mq.Destroy()
+	a.NoError(SetSystemVMessageQueuePermissions(testMqName, ipcperm.Exact(0660, -1, os.Getgid())))
+	ctl := func(cmd int, ds unsafe.Pointer) error {
+		return msgctl(mq.id, cmd, (*msqidDs)(ds))
+	}
+	mode, uid, gid, err := common.GetIpcPermissions(ctl)
+	if a.NoError(err) {
+		a.Equal(os.FileMode(0660), mode)
+		a.Equal(os.Getuid(), uid)
+		a.Equal(os.Getgid(), gid)
+	}
+}
+
+func TestLinuxMqPermissions(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyLinuxMessageQueue(testMqName)) {
+		return
+	}
+	mq, err := CreateLinuxMessageQueue(testMqName, os.O_EXCL, 0600, 1, 8)
+	if !a.NoError(err) {
+		return
+	}
+	defer mq.Destroy()
+	a.NoError(SetLinuxMessageQueuePermissions(testMqName, ipcperm.Mode(0620)))
+	var st unix.Stat_t
+	if a.NoError(unix.Fstat(mq.ID(), &st)) {
+		a.Equal(uint32(0620), st.Mode&0777)
+	}
+}
+
+func TestFastMqPermissions(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyFastMq(testMqName)) {
+		return
+	}
+	mq, err := CreateFastMq(testMqName, os.O_EXCL, 0600, 1, 8)
+	if !a.NoError(err) {
+		return
+	}
+	defer mq.Destroy()
+	a.NoError(SetFastMqPermissions(testMqName, ipcperm.Mode(0666)))
+	obj, err := shm.NewMemoryObject(fastMqStateName(testMqName), os.O_RDONLY, 0)
+	if a.NoError(err) {
+		defer obj.Close()
+		var st unix.Stat_t
+		if a.NoError(unix.Fstat(int(obj.Fd()), &st)) {
+			a.Equal(uint32(0666), st.Mode&0777)
+		}
+	}
+}
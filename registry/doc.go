@@ -0,0 +1,34 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// Package registry implements a directory of named objects placed in shared memory.
+//
+// Processes publish entries under string keys. An entry describes an ipc object:
+// its kind, its name, the pid of the process, which created it, creation time
+// and free-form metadata. Other processes can look the entries up, list them
+// and watch for changes, so they don't have to agree on object names in advance.
+//
+// Entries belong to the processes, which published them. When a process dies,
+// its entries are removed by the first process, which accesses the registry.
+// All the operations are serialized by one interprocess mutex, changes are signaled
+// to the watchers via an interprocess condition variable. On linux and freebsd the mutex is robust,
+// so the registry remains usable, if a process dies, holding it.
+//
+// Shared state layout.
+// All values are stored in the native byte order. Zeroed memory is an empty registry.
+//	header (64 bytes):
+//		0	uint64	generation, incremented after each change
+//		8	56 bytes reserved
+//	entries:
+//		MaxEntries entries of 760 bytes:
+//		0	uint32	pid of the owner, 0 for a free entry
+//		4	uint16	key length
+//		6	uint16	kind length
+//		8	uint16	name length
+//		10	uint16	metadata length
+//		12	uint32	reserved
+//		16	int64	creation time, nanoseconds since the unix epoch
+//		24	key bytes, MaxKeySize bytes
+//		88	kind bytes, MaxKindSize bytes
+//		120	name bytes, MaxNameSize bytes
+//		248	metadata bytes, MaxMetadataSize bytes
+package registry
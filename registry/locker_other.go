@@ -0,0 +1,21 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build !linux,!freebsd
+
+package registry
+
+import (
+	"os"
+
+	ipc_sync "bitbucket.org/avd/go-ipc/sync"
+)
+
+// newRegistryLocker opens a regular mutex, as robust mutexes are not supported on this platform.
+// If a process dies, holding the lock, the registry can't be used, until it is destroyed.
+func newRegistryLocker(name string, perm os.FileMode) (ipc_sync.IPCLocker, error) {
+	return ipc_sync.NewMutex(registryLockerName(name), os.O_CREATE, perm)
+}
+
+func destroyRegistryLocker(name string) error {
+	return ipc_sync.DestroyMutex(registryLockerName(name))
+}
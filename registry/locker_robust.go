@@ -0,0 +1,22 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux freebsd
+
+package registry
+
+import (
+	"os"
+
+	ipc_sync "bitbucket.org/avd/go-ipc/sync"
+)
+
+// newRegistryLocker opens a robust mutex, so that the registry can be used,
+// even if a process dies, holding the lock. As the entries are written field by field,
+// a partially written entry is still valid, and the mutex is marked consistent automatically.
+func newRegistryLocker(name string, perm os.FileMode) (ipc_sync.IPCLocker, error) {
+	return ipc_sync.NewRobustMutex(registryLockerName(name), os.O_CREATE, perm)
+}
+
+func destroyRegistryLocker(name string) error {
+	return ipc_sync.DestroyRobustMutex(registryLockerName(name))
+}
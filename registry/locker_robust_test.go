@@ -0,0 +1,53 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux freebsd
+
+package registry
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testHelperEnv = "GO_IPC_REGISTRY_TEST_HELPER"
+)
+
+// TestRegistryLockHelper is not a real test. It is run in a child process by TestRegistryOwnerDied.
+// It locks the registry and exits without unlocking it.
+func TestRegistryLockHelper(t *testing.T) {
+	if os.Getenv(testHelperEnv) == "" {
+		return
+	}
+	r, err := OpenRegistry(testRegistryName, 0666)
+	if err != nil {
+		os.Exit(1)
+	}
+	r.locker.Lock()
+	os.Exit(0)
+}
+
+func TestRegistryOwnerDied(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRegistry(testRegistryName)) {
+		return
+	}
+	r, err := OpenRegistry(testRegistryName, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(r.Destroy())
+	}()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRegistryLockHelper$")
+	cmd.Env = append(os.Environ(), testHelperEnv+"=1")
+	if !a.NoError(cmd.Run()) {
+		return
+	}
+	a.NoError(r.Publish(Entry{Key: "key"}))
+	_, found := r.Lookup("key")
+	a.True(found)
+}
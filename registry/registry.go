@@ -0,0 +1,359 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package registry
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/mmf"
+	"bitbucket.org/avd/go-ipc/shm"
+	ipc_sync "bitbucket.org/avd/go-ipc/sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultRegistryName is the name of the well-known registry, which all processes can use.
+	DefaultRegistryName = "go-ipc.registry"
+
+	// MaxEntries is the maximum number of entries in a registry.
+	MaxEntries = 256
+	// MaxKeySize is the maximum length of an entry key.
+	MaxKeySize = 64
+	// MaxKindSize is the maximum length of an object kind.
+	MaxKindSize = 32
+	// MaxNameSize is the maximum length of an object name.
+	MaxNameSize = 128
+	// MaxMetadataSize is the maximum size of entry metadata.
+	MaxMetadataSize = 512
+
+	hdrSize   = 64
+	stateSize = hdrSize + MaxEntries*int(unsafe.Sizeof(entry{}))
+
+	// watchers remove dead entries with this interval.
+	pruneInterval = 500 * time.Millisecond
+)
+
+var (
+	// ErrRegistryFull is returned by Publish, if there is no room for a new entry.
+	ErrRegistryFull = errors.New("the registry is full")
+)
+
+// Entry describes a published object.
+type Entry struct {
+	// Key is a unique key of the entry.
+	Key string
+	// Kind is the kind of the object, for instance, "mq" or "mutex".
+	Kind string
+	// Name is the name of the object.
+	Name string
+	// PID is the pid of the process, which owns the entry.
+	// The entry is removed, when the process dies.
+	PID int
+	// Created is the creation time of the object.
+	Created time.Time
+	// Metadata is free-form data, describing the object.
+	Metadata []byte
+}
+
+type registryHdr struct {
+	generation uint64
+	reserved   [7]uint64
+}
+
+type entry struct {
+	pid      uint32
+	keyLen   uint16
+	kindLen  uint16
+	nameLen  uint16
+	metaLen  uint16
+	reserved uint32
+	created  int64
+	key      [MaxKeySize]byte
+	kind     [MaxKindSize]byte
+	name     [MaxNameSize]byte
+	metadata [MaxMetadataSize]byte
+}
+
+// Registry is a directory of named objects placed in shared memory.
+type Registry struct {
+	name    string
+	region  *mmf.MemoryRegion
+	hdr     *registryHdr
+	entries []entry
+	locker  ipc_sync.IPCLocker
+	cond    *ipc_sync.Cond
+}
+
+// OpenRegistry opens a registry with the given name, creating it, if it does not exist.
+//	name - registry name. use DefaultRegistryName for the well-known registry.
+//	perm - permission bits for the registry objects, if they are created.
+func OpenRegistry(name string, perm os.FileMode) (*Registry, error) {
+	region, _, err := helper.CreateWritableRegion(registryStateName(name), os.O_CREATE, perm, stateSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create shared state")
+	}
+	result := &Registry{name: name, region: region}
+	defer func() {
+		registryCleanup(result, err)
+	}()
+	data := region.Data()
+	result.hdr = (*registryHdr)(allocator.ByteSliceData(data))
+	rawEntries := allocator.ByteSliceData(data[hdrSize:])
+	result.entries = (*[MaxEntries]entry)(rawEntries)[:]
+	// the objects are never recreated, as other processes may be using them.
+	if result.locker, err = newRegistryLocker(name, perm); err != nil {
+		return nil, errors.Wrap(err, "failed to create a locker")
+	}
+	if result.cond, err = ipc_sync.NewCond(registryCondName(name), os.O_CREATE, perm, result.locker); err != nil {
+		return nil, errors.Wrap(err, "failed to create a condvar")
+	}
+	return result, nil
+}
+
+// DestroyRegistry permanently removes a registry with the given name.
+func DestroyRegistry(name string) error {
+	var result error
+	if err := ipc_sync.DestroyCond(registryCondName(name)); err != nil {
+		result = errors.Wrap(err, "failed to destroy condvar")
+	}
+	if err := destroyRegistryLocker(name); err != nil && result == nil {
+		result = errors.Wrap(err, "failed to destroy locker")
+	}
+	if err := shm.DestroyMemoryObject(registryStateName(name)); err != nil && result == nil {
+		result = errors.Wrap(err, "failed to destroy memory object")
+	}
+	return result
+}
+
+// Publish adds an entry to the registry. If an entry with the same key exists, it is replaced.
+// If e.PID is 0, the pid of the current process is used.
+// If e.Created is zero, the current time is used.
+func (r *Registry) Publish(e Entry) error {
+	if len(e.Key) == 0 || len(e.Key) > MaxKeySize {
+		return errors.New("invalid key size")
+	}
+	if len(e.Kind) > MaxKindSize {
+		return errors.New("the kind is too long")
+	}
+	if len(e.Name) > MaxNameSize {
+		return errors.New("the name is too long")
+	}
+	if len(e.Metadata) > MaxMetadataSize {
+		return errors.New("the metadata is too big")
+	}
+	if e.PID == 0 {
+		e.PID = os.Getpid()
+	}
+	if e.Created.IsZero() {
+		e.Created = time.Now()
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	r.removeDead()
+	idx := r.find(e.Key)
+	if idx < 0 {
+		if idx = r.find(""); idx < 0 {
+			return ErrRegistryFull
+		}
+	}
+	r.entries[idx].set(e)
+	r.changed()
+	return nil
+}
+
+// Remove removes an entry with the given key. It returns true, if the entry existed.
+func (r *Registry) Remove(key string) bool {
+	if len(key) == 0 || len(key) > MaxKeySize {
+		return false
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	r.removeDead()
+	idx := r.find(key)
+	if idx < 0 {
+		return false
+	}
+	r.entries[idx] = entry{}
+	r.changed()
+	return true
+}
+
+// Lookup returns an entry with the given key, and true, if the entry exists.
+func (r *Registry) Lookup(key string) (Entry, bool) {
+	if len(key) == 0 || len(key) > MaxKeySize {
+		return Entry{}, false
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	r.removeDead()
+	idx := r.find(key)
+	if idx < 0 {
+		return Entry{}, false
+	}
+	return r.entries[idx].get(), true
+}
+
+// List returns all the entries of the registry.
+func (r *Registry) List() []Entry {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	r.removeDead()
+	var result []Entry
+	for i := range r.entries {
+		if r.entries[i].pid != 0 {
+			result = append(result, r.entries[i].get())
+		}
+	}
+	return result
+}
+
+// Generation returns the number of changes made to the registry.
+// It can be passed to Watch to wait for the next change.
+func (r *Registry) Generation() uint64 {
+	return atomic.LoadUint64(&r.hdr.generation)
+}
+
+// Watch waits for the registry to change, i.e. for its generation to become different from gen.
+// Entries of dead processes are removed during the wait, which is also considered a change.
+// Passing negative value as a timeout makes the timeout infinite.
+// It returns the current generation, which is equal to gen, if the timeout has expired.
+func (r *Registry) Watch(gen uint64, timeout time.Duration) uint64 {
+	var deadline time.Time
+	if timeout >= 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	for {
+		r.removeDead()
+		current := r.Generation()
+		if current != gen {
+			return current
+		}
+		wait := pruneInterval
+		if timeout >= 0 {
+			left := time.Until(deadline)
+			if left <= 0 {
+				return current
+			}
+			if left < wait {
+				wait = left
+			}
+		}
+		r.cond.WaitTimeout(wait)
+	}
+}
+
+// Close closes the registry instance. Entries of the current process are not removed.
+func (r *Registry) Close() error {
+	var result error
+	if err := r.cond.Close(); err != nil {
+		result = errors.Wrap(err, "failed to close condvar")
+	}
+	if err := r.locker.Close(); err != nil && result == nil {
+		result = errors.Wrap(err, "failed to close locker")
+	}
+	if err := r.region.Close(); err != nil && result == nil {
+		result = errors.Wrap(err, "failed to close memory region")
+	}
+	return result
+}
+
+// Destroy closes the registry and removes it permanently.
+func (r *Registry) Destroy() error {
+	e1, e2 := r.Close(), DestroyRegistry(r.name)
+	if e1 != nil {
+		return errors.Wrap(e1, "failed to close the registry")
+	}
+	if e2 != nil {
+		return errors.Wrap(e2, "failed to destroy the registry")
+	}
+	return nil
+}
+
+// find returns an index of the entry with the given key, or -1.
+// an empty key matches the first free entry.
+func (r *Registry) find(key string) int {
+	for i := range r.entries {
+		e := &r.entries[i]
+		if key == "" {
+			if e.pid == 0 {
+				return i
+			}
+		} else if e.pid != 0 && string(e.key[:e.keyLen]) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeDead must be called with the registry locked.
+func (r *Registry) removeDead() {
+	var removed bool
+	for i := range r.entries {
+		if pid := r.entries[i].pid; pid != 0 && !common.ProcessExists(int(pid)) {
+			r.entries[i] = entry{}
+			removed = true
+		}
+	}
+	if removed {
+		r.changed()
+	}
+}
+
+// changed must be called with the registry locked.
+func (r *Registry) changed() {
+	atomic.AddUint64(&r.hdr.generation, 1)
+	r.cond.Broadcast()
+}
+
+func (e *entry) set(from Entry) {
+	*e = entry{pid: uint32(from.PID), created: from.Created.UnixNano()}
+	e.keyLen = uint16(copy(e.key[:], from.Key))
+	e.kindLen = uint16(copy(e.kind[:], from.Kind))
+	e.nameLen = uint16(copy(e.name[:], from.Name))
+	e.metaLen = uint16(copy(e.metadata[:], from.Metadata))
+}
+
+func (e *entry) get() Entry {
+	return Entry{
+		Key:      string(e.key[:e.keyLen]),
+		Kind:     string(e.kind[:e.kindLen]),
+		Name:     string(e.name[:e.nameLen]),
+		PID:      int(e.pid),
+		Created:  time.Unix(0, e.created),
+		Metadata: append([]byte(nil), e.metadata[:e.metaLen]...),
+	}
+}
+
+func registryCleanup(r *Registry, err error) {
+	if err == nil {
+		return
+	}
+	if r.cond != nil {
+		r.cond.Close()
+	}
+	if r.locker != nil {
+		r.locker.Close()
+	}
+	r.region.Close()
+}
+
+func registryStateName(name string) string {
+	return name + ".rg"
+}
+
+func registryLockerName(name string) string {
+	return name + ".rgm"
+}
+
+func registryCondName(name string) string {
+	return name + ".rgc"
+}
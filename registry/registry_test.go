@@ -0,0 +1,124 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package registry
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testRegistryName = "go-ipc.rg-test"
+)
+
+func TestRegistryPublishLookup(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRegistry(testRegistryName)) {
+		return
+	}
+	r, err := OpenRegistry(testRegistryName, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(r.Destroy())
+	}()
+	created := time.Unix(100, 500)
+	a.NoError(r.Publish(Entry{Key: "svc.a", Kind: "mq", Name: "queue-a", Created: created, Metadata: []byte("meta")}))
+	a.NoError(r.Publish(Entry{Key: "svc.b", Kind: "fifo", Name: "fifo-b"}))
+	a.Error(r.Publish(Entry{Key: ""}))
+	a.Error(r.Publish(Entry{Key: "svc.c", Metadata: make([]byte, MaxMetadataSize+1)}))
+	r2, err := OpenRegistry(testRegistryName, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer r2.Close()
+	e, found := r2.Lookup("svc.a")
+	if a.True(found) {
+		a.Equal(Entry{Key: "svc.a", Kind: "mq", Name: "queue-a", PID: os.Getpid(), Created: created, Metadata: []byte("meta")}, e)
+	}
+	a.Len(r2.List(), 2)
+	a.NoError(r2.Publish(Entry{Key: "svc.a", Kind: "mq", Name: "queue-a2"}))
+	e, _ = r.Lookup("svc.a")
+	a.Equal("queue-a2", e.Name)
+	a.True(r.Remove("svc.b"))
+	a.False(r.Remove("svc.b"))
+	_, found = r2.Lookup("svc.b")
+	a.False(found)
+	a.Len(r2.List(), 1)
+}
+
+func TestRegistryFull(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRegistry(testRegistryName)) {
+		return
+	}
+	r, err := OpenRegistry(testRegistryName, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(r.Destroy())
+	}()
+	for i := 0; i < MaxEntries; i++ {
+		if !a.NoError(r.Publish(Entry{Key: string([]byte{byte(i / 16), byte(i % 16)})})) {
+			return
+		}
+	}
+	a.Equal(ErrRegistryFull, r.Publish(Entry{Key: "one more"}))
+}
+
+func TestRegistryRemoveDead(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRegistry(testRegistryName)) {
+		return
+	}
+	r, err := OpenRegistry(testRegistryName, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(r.Destroy())
+	}()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if !a.NoError(cmd.Run()) {
+		return
+	}
+	a.NoError(r.Publish(Entry{Key: "dead", PID: cmd.Process.Pid}))
+	a.NoError(r.Publish(Entry{Key: "alive"}))
+	_, found := r.Lookup("dead")
+	a.False(found)
+	a.Len(r.List(), 1)
+}
+
+func TestRegistryWatch(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRegistry(testRegistryName)) {
+		return
+	}
+	r, err := OpenRegistry(testRegistryName, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(r.Destroy())
+	}()
+	gen := r.Generation()
+	a.Equal(gen, r.Watch(gen, 50*time.Millisecond))
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		r2, err := OpenRegistry(testRegistryName, 0666)
+		if err != nil {
+			return
+		}
+		r2.Publish(Entry{Key: "svc"})
+		r2.Close()
+	}()
+	a.NotEqual(gen, r.Watch(gen, 5*time.Second))
+	_, found := r.Lookup("svc")
+	a.True(found)
+}
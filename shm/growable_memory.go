@@ -0,0 +1,36 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package shm
+
+import (
+	"os"
+
+	"bitbucket.org/avd/go-ipc/mmf"
+
+	"github.com/pkg/errors"
+)
+
+// NewGrowableMemory creates or opens a shared memory object and maps it as a growable region.
+// Any process can grow the region with Resize, and the others remap it on the next access.
+// The region owns the object, so the object is closed with the region.
+// On darwin shm objects can be truncated only once, so the region can't be resized there.
+//	name - object name.
+//	flag - flag is a combination of open flags from 'os' package.
+//	perm - object's permission bits.
+//	size - minimal size of the data.
+func NewGrowableMemory(name string, flag int, perm os.FileMode, size int) (*mmf.GrowableRegion, error) {
+	obj, created, err := NewMemoryObjectSize(name, flag, perm, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open shm object")
+	}
+	region, err := mmf.NewGrowableRegion(obj, created, size)
+	if err != nil {
+		if created {
+			obj.Destroy()
+		} else {
+			obj.Close()
+		}
+		return nil, errors.Wrap(err, "failed to create growable region")
+	}
+	return region, nil
+}
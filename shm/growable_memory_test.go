@@ -0,0 +1,40 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build !darwin
+
+package shm
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrowableMemory(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyMemoryObject(defaultObjectName)) {
+		return
+	}
+	defer DestroyMemoryObject(defaultObjectName)
+	g1, err := NewGrowableMemory(defaultObjectName, os.O_CREATE|os.O_EXCL, 0666, 16)
+	if !a.NoError(err) {
+		return
+	}
+	defer g1.Close()
+	g2, err := NewGrowableMemory(defaultObjectName, 0, 0666, 0)
+	if !a.NoError(err) {
+		return
+	}
+	defer g2.Close()
+	a.Equal(16, g2.Size())
+	a.NoError(g2.Resize(64 * 1024))
+	a.NoError(g2.Access(func(data []byte) {
+		data[len(data)-1] = 7
+	}))
+	a.NoError(g1.Access(func(data []byte) {
+		if a.Len(data, 64*1024) {
+			a.Equal(byte(7), data[len(data)-1])
+		}
+	}))
+}
@@ -0,0 +1,220 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package shm
+
+import (
+	"hash/fnv"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/mmf"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	mappedStructMagic   = 0x4d534947
+	mappedStructHdrSize = 32
+)
+
+// mappedStructHdr precedes the data of a mapped struct in the shared memory.
+type mappedStructHdr struct {
+	magic       uint32
+	align       uint32
+	fingerprint uint64
+	size        uint64
+}
+
+// MappedStruct is a shared memory object mapped onto a fixed-layout type.
+// The object has a header with a fingerprint of the type layout,
+// so an attempt to open the object with a different type fails.
+// The value returned by Interface or Pointer references the mapped memory,
+// so it can be used only while the MappedStruct is open and referenced.
+type MappedStruct struct {
+	name   string
+	typ    reflect.Type
+	region *mmf.MemoryRegion
+	ptr    unsafe.Pointer
+}
+
+// NewMappedStruct creates or opens a shared memory object and maps it onto the given type.
+//	name - object name.
+//	flag - flag is a combination of open flags from 'os' package.
+//	perm - object's permission bits.
+//	prototype - a value or a pointer to a value of the type, which must not contain any references.
+//		The value itself is not used, so it can be a typed nil pointer, like (*T)(nil).
+// If the object was created, it is zeroed.
+func NewMappedStruct(name string, flag int, perm os.FileMode, prototype interface{}) (*MappedStruct, error) {
+	typ, err := mappedStructType(prototype)
+	if err != nil {
+		return nil, err
+	}
+	size := mappedStructHdrSize + int(typ.Size())
+	region, created, err := openMappedStructRegion(name, flag, perm, size)
+	if err != nil {
+		return nil, err
+	}
+	raw := allocator.ByteSliceData(region.Data())
+	result := &MappedStruct{
+		name:   name,
+		typ:    typ,
+		region: region,
+		ptr:    allocator.AdvancePointer(raw, mappedStructHdrSize),
+	}
+	if uintptr(result.ptr)%uintptr(typ.Align()) != 0 {
+		err = errors.Errorf("mapped data is not aligned to %d bytes", typ.Align())
+	} else {
+		hdr := (*mappedStructHdr)(raw)
+		expected := mappedStructHdr{
+			magic:       mappedStructMagic,
+			align:       uint32(typ.Align()),
+			fingerprint: TypeFingerprint(typ),
+			size:        uint64(typ.Size()),
+		}
+		if created {
+			// the magic value is written last, so that openers see the entire header.
+			*hdr = expected
+			hdr.magic = 0
+			atomic.StoreUint32(&hdr.magic, mappedStructMagic)
+		} else if !common.WaitReady(func() bool { return atomic.LoadUint32(&hdr.magic) != 0 }) || *hdr != expected {
+			err = errors.Errorf("type %v does not match the layout of the object", typ)
+		}
+	}
+	if err != nil {
+		region.Close()
+		if created {
+			DestroyMemoryObject(name)
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// openMappedStructRegion creates a shm object of the given size, or opens an existing one,
+// waiting for its creator to truncate it, and then maps it.
+func openMappedStructRegion(name string, flag int, perm os.FileMode, size int) (*mmf.MemoryRegion, bool, error) {
+	var obj *MemoryObject
+	creator := func(create bool) error {
+		var err error
+		creatorFlag := os.O_RDWR
+		if create {
+			creatorFlag |= os.O_CREATE | os.O_EXCL
+		}
+		obj, err = NewMemoryObject(name, creatorFlag, perm)
+		return errors.Cause(err)
+	}
+	created, err := common.OpenOrCreate(creator, flag)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to open shm object")
+	}
+	defer obj.Close()
+	if created {
+		if err = obj.Truncate(int64(size)); err != nil {
+			obj.Destroy()
+			return nil, false, errors.Wrap(err, "failed to truncate shm object")
+		}
+	} else if !common.WaitReady(func() bool { return obj.Size() >= mappedStructHdrSize }) || obj.Size() < int64(size) {
+		return nil, false, errors.Errorf("existing object is smaller (%d), than needed(%d)", obj.Size(), size)
+	}
+	region, err := mmf.NewMemoryRegion(obj, mmf.MEM_READWRITE, 0, size)
+	if err != nil {
+		if created {
+			obj.Destroy()
+		}
+		return nil, false, errors.Wrap(err, "failed to create shm region")
+	}
+	return region, created, nil
+}
+
+// Interface returns a pointer to the mapped value of the type given to NewMappedStruct.
+// For example, if the prototype was (*T)(nil), it can be used as m.Interface().(*T).
+func (m *MappedStruct) Interface() interface{} {
+	return reflect.NewAt(m.typ, m.ptr).Interface()
+}
+
+// Pointer returns the address of the mapped value.
+func (m *MappedStruct) Pointer() unsafe.Pointer {
+	return m.ptr
+}
+
+// Type returns the type of the mapped value.
+func (m *MappedStruct) Type() reflect.Type {
+	return m.typ
+}
+
+// Region returns the underlying memory region, which includes the header.
+func (m *MappedStruct) Region() *mmf.MemoryRegion {
+	return m.region
+}
+
+// Close unmaps the object.
+func (m *MappedStruct) Close() error {
+	m.ptr = nil
+	return m.region.Close()
+}
+
+// Destroy closes the object and removes it permanently.
+func (m *MappedStruct) Destroy() error {
+	if err := m.Close(); err != nil {
+		return errors.Wrap(err, "failed to close shm region")
+	}
+	return DestroyMemoryObject(m.name)
+}
+
+// TypeFingerprint returns a hash of the memory layout of the type.
+// Types with the same sizes, offsets, field names, and kinds of all their components
+// have the same fingerprint.
+func TypeFingerprint(typ reflect.Type) uint64 {
+	h := fnv.New64a()
+	writeTypeLayout(h, typ)
+	return h.Sum64()
+}
+
+func writeTypeLayout(w io.Writer, typ reflect.Type) {
+	write := func(s string) {
+		w.Write([]byte(s))
+		w.Write([]byte{0})
+	}
+	write(typ.Kind().String())
+	write(strconv.FormatUint(uint64(typ.Size()), 10))
+	write(strconv.Itoa(typ.Align()))
+	switch typ.Kind() {
+	case reflect.Array:
+		write(strconv.Itoa(typ.Len()))
+		writeTypeLayout(w, typ.Elem())
+	case reflect.Struct:
+		write(strconv.Itoa(typ.NumField()))
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			write(field.Name)
+			write(strconv.FormatUint(uint64(field.Offset), 10))
+			writeTypeLayout(w, field.Type)
+		}
+	}
+}
+
+func mappedStructType(prototype interface{}) (reflect.Type, error) {
+	if prototype == nil {
+		return nil, errors.New("nil prototype")
+	}
+	typ := reflect.TypeOf(prototype)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Ptr {
+		return nil, errors.New("the type must be a plain value type")
+	}
+	if err := allocator.CheckObjectReferences(reflect.Zero(typ).Interface()); err != nil {
+		return nil, errors.Wrap(err, "invalid type")
+	}
+	if typ.Size() == 0 {
+		return nil, errors.New("zero-sized type")
+	}
+	return typ, nil
+}
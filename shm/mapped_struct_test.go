@@ -0,0 +1,144 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package shm
+
+import (
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mappedTestStruct struct {
+	Counter int64
+	Flags   uint32
+	Data    [16]byte
+}
+
+type mappedTestStruct2 struct {
+	Counter int64
+	Flags   uint32
+	Info    [16]byte
+}
+
+func TestMappedStructTypes(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyMemoryObject(defaultObjectName)) {
+		return
+	}
+	_, err := NewMappedStruct(defaultObjectName, os.O_CREATE, 0666, nil)
+	a.Error(err)
+	_, err = NewMappedStruct(defaultObjectName, os.O_CREATE, 0666, &struct{ s string }{})
+	a.Error(err)
+	_, err = NewMappedStruct(defaultObjectName, os.O_CREATE, 0666, []int{})
+	a.Error(err)
+	_, err = NewMappedStruct(defaultObjectName, os.O_CREATE, 0666, struct{}{})
+	a.Error(err)
+	m, err := NewMappedStruct(defaultObjectName, os.O_CREATE|os.O_EXCL, 0666, mappedTestStruct{})
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(reflect.TypeOf(mappedTestStruct{}), m.Type())
+	_, ok := m.Interface().(*mappedTestStruct)
+	a.True(ok)
+	a.NoError(m.Destroy())
+}
+
+func TestMappedStructShared(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyMemoryObject(defaultObjectName)) {
+		return
+	}
+	m, err := NewMappedStruct(defaultObjectName, os.O_CREATE|os.O_EXCL, 0666, (*mappedTestStruct)(nil))
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(m.Destroy())
+	}()
+	s := m.Interface().(*mappedTestStruct)
+	a.Equal(mappedTestStruct{}, *s)
+	s.Counter = 42
+	s.Flags = 7
+	copy(s.Data[:], "shared")
+	m2, err := NewMappedStruct(defaultObjectName, 0, 0666, (*mappedTestStruct)(nil))
+	if !a.NoError(err) {
+		return
+	}
+	s2 := m2.Interface().(*mappedTestStruct)
+	a.Equal(*s, *s2)
+	s2.Counter++
+	a.Equal(int64(43), s.Counter)
+	a.NoError(m2.Close())
+}
+
+func TestMappedStructOpenConcurrent(t *testing.T) {
+	const jobs = 8
+	a := assert.New(t)
+	if !a.NoError(DestroyMemoryObject(defaultObjectName)) {
+		return
+	}
+	var wg sync.WaitGroup
+	for job := 0; job < jobs; job++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m, err := NewMappedStruct(defaultObjectName, os.O_CREATE, 0666, (*mappedTestStruct)(nil))
+			if a.NoError(err) {
+				atomic.AddInt64(&m.Interface().(*mappedTestStruct).Counter, 1)
+				a.NoError(m.Close())
+			}
+		}()
+	}
+	wg.Wait()
+	m, err := NewMappedStruct(defaultObjectName, 0, 0666, (*mappedTestStruct)(nil))
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(int64(jobs), m.Interface().(*mappedTestStruct).Counter)
+	a.NoError(m.Destroy())
+}
+
+func TestMappedStructLayoutMismatch(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyMemoryObject(defaultObjectName)) {
+		return
+	}
+	m, err := NewMappedStruct(defaultObjectName, os.O_CREATE|os.O_EXCL, 0666, (*mappedTestStruct)(nil))
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(m.Destroy())
+	}()
+	// same size, but different field names.
+	_, err = NewMappedStruct(defaultObjectName, 0, 0666, (*mappedTestStruct2)(nil))
+	a.Error(err)
+	// smaller type.
+	_, err = NewMappedStruct(defaultObjectName, 0, 0666, (*int64)(nil))
+	a.Error(err)
+	// bigger type.
+	_, err = NewMappedStruct(defaultObjectName, 0, 0666, (*[2]mappedTestStruct)(nil))
+	a.Error(err)
+	// the object must be intact after failed attempts.
+	m2, err := NewMappedStruct(defaultObjectName, os.O_CREATE, 0666, (*mappedTestStruct)(nil))
+	if a.NoError(err) {
+		a.NoError(m2.Close())
+	}
+}
+
+func TestTypeFingerprint(t *testing.T) {
+	a := assert.New(t)
+	type local struct {
+		Counter int64
+		Flags   uint32
+		Data    [16]byte
+	}
+	a.Equal(TypeFingerprint(reflect.TypeOf(mappedTestStruct{})), TypeFingerprint(reflect.TypeOf(local{})))
+	a.NotEqual(TypeFingerprint(reflect.TypeOf(mappedTestStruct{})), TypeFingerprint(reflect.TypeOf(mappedTestStruct2{})))
+	a.NotEqual(TypeFingerprint(reflect.TypeOf([2]int32{})), TypeFingerprint(reflect.TypeOf(int64(0))))
+	a.NotEqual(TypeFingerprint(reflect.TypeOf(uint64(0))), TypeFingerprint(reflect.TypeOf(int64(0))))
+}
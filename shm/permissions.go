@@ -0,0 +1,44 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package shm
+
+import (
+	"os"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
+
+	"github.com/pkg/errors"
+)
+
+// SetPermissions changes the mode and the ownership of an existing shm object.
+//	name - object name.
+//	perm - new permissions.
+func SetPermissions(name string, perm ipcperm.Permissions) error {
+	path, err := shmName(name)
+	if err != nil {
+		return errors.Wrap(err, "shm name failed")
+	}
+	if perm.ChangesMode() {
+		if err = chmodShm(path, perm.Mode); err != nil {
+			return errors.Wrap(err, "failed to change shm object mode")
+		}
+	}
+	if perm.ChangesOwner() {
+		uid, gid := perm.IDs()
+		if err = chownShm(path, uid, gid); err != nil {
+			return errors.Wrap(err, "failed to change shm object owner")
+		}
+	}
+	return nil
+}
+
+// Chmod sets the exact mode of an existing shm object.
+func Chmod(name string, mode os.FileMode) error {
+	return SetPermissions(name, ipcperm.Mode(mode))
+}
+
+// Chown changes the owner and the group of an existing shm object.
+// If uid or gid is -1, the corresponding value is not changed.
+func Chown(name string, uid, gid int) error {
+	return SetPermissions(name, ipcperm.Owner(uid, gid))
+}
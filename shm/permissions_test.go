@@ -0,0 +1,71 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux freebsd
+
+package shm
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShmPermissions(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyMemoryObject(defaultObjectName)) {
+		return
+	}
+	obj, err := NewMemoryObject(defaultObjectName, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+	if !a.NoError(err) {
+		return
+	}
+	defer obj.Destroy()
+	a.NoError(Chmod(defaultObjectName, 0666))
+	fi, err := obj.file.Stat()
+	if a.NoError(err) {
+		a.Equal(os.FileMode(0666), fi.Mode().Perm())
+	}
+	a.NoError(Chown(defaultObjectName, os.Getuid(), -1))
+	a.NoError(SetPermissions(defaultObjectName, ipcperm.Exact(0640, os.Getuid(), os.Getgid())))
+	fi, err = obj.file.Stat()
+	if a.NoError(err) {
+		a.Equal(os.FileMode(0640), fi.Mode().Perm())
+	}
+	a.Error(Chmod(defaultObjectName+"-nonexistent", 0666))
+}
+
+func TestShmCreatePermissions(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyMemoryObject(defaultObjectName)) {
+		return
+	}
+	_, err := NewMemoryObjectPermissions(defaultObjectName, os.O_CREATE|os.O_EXCL|os.O_RDWR, ipcperm.Permissions{})
+	a.Error(err)
+	// the mode of the object must not depend on umask.
+	old := syscall.Umask(0077)
+	obj, err := NewMemoryObjectPermissions(defaultObjectName, os.O_CREATE|os.O_EXCL|os.O_RDWR, ipcperm.Exact(0644, -1, os.Getgid()))
+	syscall.Umask(old)
+	if !a.NoError(err) {
+		return
+	}
+	defer obj.Destroy()
+	a.Equal(defaultObjectName, obj.Name())
+	fi, err := obj.file.Stat()
+	if a.NoError(err) {
+		a.Equal(os.FileMode(0644), fi.Mode().Perm())
+	}
+	_, err = NewMemoryObjectPermissions(defaultObjectName, os.O_CREATE|os.O_EXCL|os.O_RDWR, ipcperm.Mode(0644))
+	a.Error(err)
+	obj2, err := NewMemoryObjectPermissions(defaultObjectName, os.O_CREATE|os.O_RDWR, ipcperm.Mode(0600))
+	if a.NoError(err) {
+		fi, err = obj2.file.Stat()
+		if a.NoError(err) {
+			a.Equal(os.FileMode(0644), fi.Mode().Perm())
+		}
+		a.NoError(obj2.Close())
+	}
+}
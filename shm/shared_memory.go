@@ -7,6 +7,7 @@ import (
 	"runtime"
 
 	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 	"bitbucket.org/avd/go-ipc/mmf"
 	"github.com/pkg/errors"
 )
@@ -41,11 +42,44 @@ func NewMemoryObject(name string, flag int, perm os.FileMode) (*MemoryObject, er
 	if err != nil {
 		return nil, err
 	}
+	return wrapMemoryObject(impl), nil
+}
+
+// NewMemoryObjectPermissions creates or opens a shared memory object.
+// Unlike NewMemoryObject, it applies the exact mode and ownership to a created object,
+// so that they are not affected by umask.
+// On linux the object becomes visible to other processes only after the permissions have been applied.
+// On other platforms they are applied right after the object has been created.
+//	name - a name of the object. should not contain '/' and exceed 255 symbols (30 on darwin).
+//	flag - flag is a combination of open flags from 'os' package.
+//	perm - permissions of a created object. The mode must be set.
+func NewMemoryObjectPermissions(name string, flag int, perm ipcperm.Permissions) (*MemoryObject, error) {
+	if !perm.ChangesMode() {
+		return nil, errors.New("the mode of the object is not set")
+	}
+	var impl *memoryObject
+	openFlag := flag &^ (os.O_CREATE | os.O_EXCL)
+	creator := func(create bool) error {
+		var err error
+		if create {
+			impl, err = createMemoryObject(name, openFlag, perm)
+		} else {
+			impl, err = newMemoryObject(name, openFlag, 0)
+		}
+		return errors.Cause(err)
+	}
+	if _, err := common.OpenOrCreate(creator, flag); err != nil {
+		return nil, err
+	}
+	return wrapMemoryObject(impl), nil
+}
+
+func wrapMemoryObject(impl *memoryObject) *MemoryObject {
 	result := &MemoryObject{impl}
 	runtime.SetFinalizer(impl, func(memObject *memoryObject) {
 		memObject.Close()
 	})
-	return result, nil
+	return result
 }
 
 // NewMemoryObjectSize opens or creates a shared memory object with the given name.
@@ -11,7 +11,9 @@ import (
 	"unsafe"
 
 	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 
+	"github.com/pkg/errors"
 	"golang.org/x/sys/unix"
 )
 
@@ -81,3 +83,40 @@ func shm_unlink(name string) error {
 	}
 	return nil
 }
+
+// shm objects on bsd have no paths in the file system, so we use their descriptors.
+func chmodShm(path string, mode os.FileMode) error {
+	file, err := shmOpen(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Chmod(mode)
+}
+
+func chownShm(path string, uid, gid int) error {
+	file, err := shmOpen(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Chown(uid, gid)
+}
+
+// createMemoryObject creates an object, which is not accessible by others, and then applies the permissions to it.
+func createMemoryObject(name string, flag int, perm ipcperm.Permissions) (*memoryObject, error) {
+	path, err := shmName(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "shm name failed")
+	}
+	file, err := shmOpen(path, flag|os.O_CREATE|os.O_EXCL, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "shm open failed")
+	}
+	if err = applyPermissions(file, perm); err != nil {
+		file.Close()
+		doDestroyMemoryObject(path)
+		return nil, err
+	}
+	return &memoryObject{file: file}, nil
+}
@@ -7,11 +7,15 @@ package shm
 import (
 	"bufio"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 
+	"bitbucket.org/avd/go-ipc/ipcperm"
+
 	"github.com/pkg/errors"
 	"golang.org/x/sys/unix"
 )
@@ -173,3 +177,39 @@ func scanMountRecord(record string) (result *mntent) {
 	}
 	return
 }
+
+func chmodShm(path string, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
+func chownShm(path string, uid, gid int) error {
+	return os.Chown(path, uid, gid)
+}
+
+// createMemoryObject creates a temporary object, applies the permissions to it,
+// and then links it under the given name, so that the object is never visible with other permissions.
+func createMemoryObject(name string, flag int, perm ipcperm.Permissions) (*memoryObject, error) {
+	path, err := shmName(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "shm name failed")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create a temporary object")
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	if err = applyPermissions(tmp, perm); err != nil {
+		return nil, err
+	}
+	if err = os.Link(tmp.Name(), path); err != nil {
+		return nil, errors.Wrap(err, "failed to link the object")
+	}
+	file, err := shmOpen(path, flag, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "shm open failed")
+	}
+	return &memoryObject{file: file}, nil
+}
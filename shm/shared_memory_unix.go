@@ -10,6 +10,8 @@ import (
 	"runtime"
 	"strings"
 
+	"bitbucket.org/avd/go-ipc/ipcperm"
+
 	"github.com/pkg/errors"
 )
 
@@ -97,3 +99,17 @@ func destroyMemoryObject(name string) error {
 	}
 	return err
 }
+
+// applyPermissions sets the exact mode and the ownership of an opened object.
+func applyPermissions(file *os.File, perm ipcperm.Permissions) error {
+	if err := file.Chmod(perm.Mode.Perm()); err != nil {
+		return errors.Wrap(err, "failed to change shm object mode")
+	}
+	if perm.ChangesOwner() {
+		uid, gid := perm.IDs()
+		if err := file.Chown(uid, gid); err != nil {
+			return errors.Wrap(err, "failed to change shm object owner")
+		}
+	}
+	return nil
+}
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"runtime"
 
+	"bitbucket.org/avd/go-ipc/ipcperm"
+
 	"github.com/pkg/errors"
 )
 
@@ -16,6 +18,14 @@ type memoryObject struct {
 	file *os.File
 }
 
+// createMemoryObject creates a file with the given mode. The ownership is not supported on windows.
+func createMemoryObject(name string, flag int, perm ipcperm.Permissions) (*memoryObject, error) {
+	if perm.ChangesOwner() {
+		return nil, errors.New("changing the owner is not supported on windows")
+	}
+	return newMemoryObject(name, flag|os.O_CREATE|os.O_EXCL, perm.Mode)
+}
+
 func newMemoryObject(name string, flag int, perm os.FileMode) (impl *memoryObject, err error) {
 	path, err := shmName(name)
 	if err != nil {
@@ -90,3 +100,11 @@ func sharedDirName() (string, error) {
 	}
 	return rootPath, nil
 }
+
+func chmodShm(path string, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
+func chownShm(path string, uid, gid int) error {
+	return os.Chown(path, uid, gid)
+}
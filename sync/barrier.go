@@ -0,0 +1,105 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package sync
+
+import (
+	"os"
+	"time"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxBarrierParties is the maximum number of parties of a barrier.
+	MaxBarrierParties = 0xffff
+)
+
+var (
+	// ErrBarrierBroken is returned by Barrier.Wait, if one of the parties has timed out,
+	// or the barrier was reset, while the caller waited. Call Reset to use a broken barrier again.
+	ErrBarrierBroken = errors.New("the barrier is broken")
+)
+
+// Barrier is a synchronization object, which blocks parties until all of them call Wait.
+// After that all the waiters are released, and the barrier can be used again.
+// If a party times out, the barrier is broken, and all the other parties of the same generation
+// are released with ErrBarrierBroken. A broken barrier stays broken, until it is reset.
+type Barrier barrier
+
+// NewBarrier creates a new barrier with the given name.
+// It uses the default implementation on the current platform.
+//	name - object name.
+//	flag - flag is a combination of open flags from 'os' package.
+//	perm - object's permission bits.
+//	parties - the number of parties, if the barrier was created. must be in [1, MaxBarrierParties].
+func NewBarrier(name string, flag int, perm os.FileMode, parties int) (*Barrier, error) {
+	if err := ensureOpenFlags(flag); err != nil {
+		return nil, err
+	}
+	if parties < 1 || parties > MaxBarrierParties {
+		return nil, errors.Errorf("invalid number of parties %d", parties)
+	}
+	b, err := newBarrier(name, flag, perm, parties)
+	if err != nil {
+		return nil, err
+	}
+	return (*Barrier)(b), nil
+}
+
+// Wait waits until all the parties call Wait.
+// It returns true for the party, which arrived last, and false for the others.
+// If the barrier is broken, ErrBarrierBroken is returned.
+func (b *Barrier) Wait() (bool, error) {
+	return b.WaitTimeout(-1)
+}
+
+// WaitTimeout waits until all the parties call Wait, but for not longer than timeout.
+// It returns true for the party, which arrived last, and false for the others.
+// If the timeout expires, the barrier is broken, and a timeout error is returned.
+// If the barrier is broken by another party, ErrBarrierBroken is returned.
+func (b *Barrier) WaitTimeout(timeout time.Duration) (bool, error) {
+	return (*barrier)(b).lwb.waitTimeout(timeout)
+}
+
+// Reset resets the barrier to its initial state.
+// If some parties are waiting, the barrier is broken, and they are released with ErrBarrierBroken.
+// Reset returns after all of them have been released.
+func (b *Barrier) Reset() {
+	(*barrier)(b).lwb.reset()
+}
+
+// Parties returns the number of parties required to trip the barrier.
+func (b *Barrier) Parties() int {
+	return (*barrier)(b).lwb.parties()
+}
+
+// IsBroken returns true, if the barrier is broken.
+func (b *Barrier) IsBroken() bool {
+	return (*barrier)(b).lwb.isBroken()
+}
+
+// Close closes the barrier.
+func (b *Barrier) Close() error {
+	return (*barrier)(b).close()
+}
+
+// Destroy closes the barrier and removes it permanently.
+func (b *Barrier) Destroy() error {
+	return (*barrier)(b).destroy()
+}
+
+// DestroyBarrier permanently removes barrier with the given name.
+func DestroyBarrier(name string) error {
+	return destroyBarrier(name)
+}
+
+// SetBarrierPermissions changes the mode and the ownership of the barrier with the given name.
+func SetBarrierPermissions(name string, perm ipcperm.Permissions) error {
+	return setBarrierPermissions(name, perm)
+}
+
+func barrierName(name string) string {
+	return name + ".barrier"
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build freebsd linux
+
+package sync
+
+import (
+	"os"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
+	"bitbucket.org/avd/go-ipc/mmf"
+	"bitbucket.org/avd/go-ipc/shm"
+	"github.com/pkg/errors"
+)
+
+type barrier struct {
+	name   string
+	region *mmf.MemoryRegion
+	lwb    *lwBarrier
+}
+
+func newBarrier(name string, flag int, perm os.FileMode, parties int) (*barrier, error) {
+	region, created, err := helper.CreateWritableRegion(barrierName(name), flag, perm, barrierStateSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create shared state")
+	}
+	state := (*barrierState)(allocator.ByteSliceData(region.Data()))
+	result := &barrier{
+		lwb:    newLightweightBarrier(unsafe.Pointer(state), &futex{ptr: unsafe.Pointer(&state.word)}, false),
+		name:   name,
+		region: region,
+	}
+	if created {
+		result.lwb.init(parties)
+	} else if err = result.lwb.open(); err != nil {
+		region.Close()
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *barrier) close() error {
+	return b.region.Close()
+}
+
+func (b *barrier) destroy() error {
+	if err := b.close(); err != nil {
+		return errors.Wrap(err, "failed to close shm region")
+	}
+	return destroyBarrier(b.name)
+}
+
+func destroyBarrier(name string) error {
+	if err := shm.DestroyMemoryObject(barrierName(name)); err != nil {
+		return errors.Wrap(err, "failed to destroy memory object")
+	}
+	return nil
+}
+
+func setBarrierPermissions(name string, perm ipcperm.Permissions) error {
+	if err := shm.SetPermissions(barrierName(name), perm); err != nil {
+		return errors.Wrap(err, "failed to set shared state permissions")
+	}
+	return nil
+}
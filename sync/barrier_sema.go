@@ -0,0 +1,87 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build windows darwin
+
+package sync
+
+import (
+	"os"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
+	"bitbucket.org/avd/go-ipc/mmf"
+	"bitbucket.org/avd/go-ipc/shm"
+	"github.com/pkg/errors"
+)
+
+type barrier struct {
+	s      *Semaphore
+	region *mmf.MemoryRegion
+	name   string
+	lwb    *lwBarrier
+}
+
+func newBarrier(name string, flag int, perm os.FileMode, parties int) (*barrier, error) {
+	region, created, err := helper.CreateWritableRegion(barrierName(name), flag, perm, barrierStateSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create shared state")
+	}
+	s, err := NewSemaphore(barrierName(name), flag, perm, 0)
+	if err != nil {
+		region.Close()
+		if created {
+			shm.DestroyMemoryObject(barrierName(name))
+		}
+		return nil, errors.Wrap(err, "failed to create a semaphore")
+	}
+	result := &barrier{
+		lwb:    newLightweightBarrier(allocator.ByteSliceData(region.Data()), newSemaWaiter(s), true),
+		name:   name,
+		region: region,
+		s:      s,
+	}
+	if created {
+		result.lwb.init(parties)
+	} else if err = result.lwb.open(); err != nil {
+		result.close()
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *barrier) close() error {
+	e1, e2 := b.s.Close(), b.region.Close()
+	if e1 != nil {
+		return errors.Wrap(e1, "failed to close sema")
+	}
+	if e2 != nil {
+		return errors.Wrap(e2, "failed to close shared state")
+	}
+	return nil
+}
+
+func (b *barrier) destroy() error {
+	if err := b.close(); err != nil {
+		return errors.Wrap(err, "failed to close the barrier")
+	}
+	return destroyBarrier(b.name)
+}
+
+func destroyBarrier(name string) error {
+	e1, e2 := shm.DestroyMemoryObject(barrierName(name)), destroySemaphore(barrierName(name))
+	if e1 != nil {
+		return errors.Wrap(e1, "failed to destroy memory object")
+	}
+	if e2 != nil {
+		return errors.Wrap(e2, "failed to destroy semaphore")
+	}
+	return nil
+}
+
+func setBarrierPermissions(name string, perm ipcperm.Permissions) error {
+	if err := shm.SetPermissions(barrierName(name), perm); err != nil {
+		return errors.Wrap(err, "failed to set shared state permissions")
+	}
+	return setSemaphorePermissions(barrierName(name), perm)
+}
@@ -0,0 +1,306 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package sync
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/internal/helper"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testBarrierName   = "testbarrier"
+	barrierTestRounds = 100
+)
+
+// TestBarrierHelper is not a real test. It is run in a child process by TestBarrierMultiProcess.
+func TestBarrierHelper(t *testing.T) {
+	if os.Getenv(testHelperEnv) != "barrier" {
+		return
+	}
+	b, err := NewBarrier(testBarrierName, 0, 0666, 1)
+	if err != nil {
+		os.Exit(1)
+	}
+	for i := 0; i < barrierTestRounds; i++ {
+		if _, err = b.WaitTimeout(time.Second * 10); err != nil {
+			os.Exit(2)
+		}
+	}
+	os.Exit(0)
+}
+
+func TestBarrierOpenMode(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyBarrier(testBarrierName)) {
+		return
+	}
+	_, err := NewBarrier(testBarrierName, os.O_RDWR, 0666, 1)
+	a.Error(err)
+	_, err = NewBarrier(testBarrierName, os.O_CREATE, 0666, 0)
+	a.Error(err)
+	_, err = NewBarrier(testBarrierName, os.O_CREATE, 0666, MaxBarrierParties+1)
+	a.Error(err)
+	_, err = NewBarrier(testBarrierName, 0, 0666, 1)
+	a.Error(err)
+	b, err := NewBarrier(testBarrierName, os.O_CREATE|os.O_EXCL, 0666, 3)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(b.Destroy())
+	}()
+	b2, err := NewBarrier(testBarrierName, 0, 0666, 1)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(3, b2.Parties())
+	a.NoError(b2.Close())
+}
+
+func TestBarrierOpenBeforeInit(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyBarrier(testBarrierName)) {
+		return
+	}
+	// the state has been created, but the number of parties has not been published yet.
+	region, _, err := helper.CreateWritableRegion(barrierName(testBarrierName), os.O_CREATE|os.O_EXCL, 0666, barrierStateSize)
+	if !a.NoError(err) {
+		return
+	}
+	defer region.Close()
+	opened := make(chan *Barrier)
+	go func() {
+		b, err := NewBarrier(testBarrierName, os.O_CREATE, 0666, 1)
+		a.NoError(err)
+		opened <- b
+	}()
+	time.Sleep(time.Millisecond * 50)
+	state := (*barrierState)(allocator.ByteSliceData(region.Data()))
+	atomic.StoreUint32(&state.parties, 2)
+	b := <-opened
+	if b == nil {
+		return
+	}
+	defer func() {
+		a.NoError(b.Destroy())
+	}()
+	a.Equal(2, b.Parties())
+}
+
+func TestBarrierWait(t *testing.T) {
+	const parties = 8
+	a := assert.New(t)
+	if !a.NoError(DestroyBarrier(testBarrierName)) {
+		return
+	}
+	b, err := NewBarrier(testBarrierName, os.O_CREATE|os.O_EXCL, 0666, parties)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(b.Destroy())
+	}()
+	var wg sync.WaitGroup
+	var arrived, lasts [barrierTestRounds]int32
+	for i := 0; i < parties; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b, err := NewBarrier(testBarrierName, 0, 0666, parties)
+			if !a.NoError(err) {
+				return
+			}
+			defer b.Close()
+			for round := 0; round < barrierTestRounds; round++ {
+				atomic.AddInt32(&arrived[round], 1)
+				last, err := b.Wait()
+				if !a.NoError(err) {
+					return
+				}
+				// nobody can pass the barrier, until all the parties arrive.
+				a.Equal(int32(parties), atomic.LoadInt32(&arrived[round]))
+				if last {
+					atomic.AddInt32(&lasts[round], 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for round := 0; round < barrierTestRounds; round++ {
+		a.Equal(int32(1), lasts[round])
+	}
+}
+
+func TestBarrierTimeout(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyBarrier(testBarrierName)) {
+		return
+	}
+	b, err := NewBarrier(testBarrierName, os.O_CREATE|os.O_EXCL, 0666, 3)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(b.Destroy())
+	}()
+	waitErr := make(chan error)
+	go func() {
+		_, err := b.Wait()
+		waitErr <- err
+	}()
+	_, err = b.WaitTimeout(time.Millisecond * 50)
+	a.True(common.IsTimeoutErr(err))
+	a.Equal(ErrBarrierBroken, <-waitErr)
+	a.True(b.IsBroken())
+	_, err = b.WaitTimeout(0)
+	a.Equal(ErrBarrierBroken, err)
+	b.Reset()
+	a.False(b.IsBroken())
+	_, err = b.WaitTimeout(0)
+	a.True(common.IsTimeoutErr(err))
+}
+
+func TestBarrierReset(t *testing.T) {
+	const waiters = 4
+	a := assert.New(t)
+	if !a.NoError(DestroyBarrier(testBarrierName)) {
+		return
+	}
+	b, err := NewBarrier(testBarrierName, os.O_CREATE|os.O_EXCL, 0666, waiters+1)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(b.Destroy())
+	}()
+	waitErr := make(chan error, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			_, err := b.Wait()
+			waitErr <- err
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+	b.Reset()
+	for i := 0; i < waiters; i++ {
+		a.Equal(ErrBarrierBroken, <-waitErr)
+	}
+	a.False(b.IsBroken())
+	// the barrier must be usable after the reset.
+	var wg sync.WaitGroup
+	var lasts int32
+	for i := 0; i < waiters+1; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			last, err := b.Wait()
+			a.NoError(err)
+			if last {
+				atomic.AddInt32(&lasts, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	a.Equal(int32(1), lasts)
+}
+
+func TestBarrierMultiProcess(t *testing.T) {
+	const children = 3
+	a := assert.New(t)
+	if !a.NoError(DestroyBarrier(testBarrierName)) {
+		return
+	}
+	b, err := NewBarrier(testBarrierName, os.O_CREATE|os.O_EXCL, 0666, children+1)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(b.Destroy())
+	}()
+	var cmds []*exec.Cmd
+	for i := 0; i < children; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestBarrierHelper$")
+		cmd.Env = append(os.Environ(), testHelperEnv+"=barrier")
+		if !a.NoError(cmd.Start()) {
+			return
+		}
+		cmds = append(cmds, cmd)
+	}
+	for i := 0; i < barrierTestRounds; i++ {
+		if _, err = b.WaitTimeout(time.Second * 10); !a.NoError(err) {
+			break
+		}
+	}
+	for _, cmd := range cmds {
+		a.NoError(cmd.Wait())
+	}
+}
+
+func TestBarrierSemaPermits(t *testing.T) {
+	const parties = 8
+	a := assert.New(t)
+	if !a.NoError(DestroySemaphore(testSemaName)) {
+		return
+	}
+	s, err := NewSemaphore(testSemaName, os.O_CREATE|os.O_EXCL, 0666, 0)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(s.Close())
+		a.NoError(DestroySemaphore(testSemaName))
+	}()
+	var state barrierState
+	b := newLightweightBarrier(unsafe.Pointer(&state), newSemaWaiter(s), true)
+	b.init(parties)
+	var wg sync.WaitGroup
+	var lasts [barrierTestRounds]int32
+	for i := 0; i < parties; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := 0; round < barrierTestRounds; round++ {
+				last, err := b.waitTimeout(time.Second * 10)
+				if !a.NoError(err) {
+					return
+				}
+				if last {
+					atomic.AddInt32(&lasts[round], 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for round := 0; round < barrierTestRounds; round++ {
+		a.Equal(int32(1), lasts[round])
+	}
+	// the waiters of a broken generation consume their permits.
+	waitErr := make(chan error, parties-2)
+	for i := 0; i < parties-2; i++ {
+		go func() {
+			_, err := b.waitTimeout(-1)
+			waitErr <- err
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+	_, err = b.waitTimeout(time.Millisecond * 50)
+	a.True(common.IsTimeoutErr(err))
+	for i := 0; i < parties-2; i++ {
+		a.Equal(ErrBarrierBroken, <-waitErr)
+	}
+	b.reset()
+	a.False(b.isBroken())
+	// all the permits have been consumed.
+	a.False(s.WaitTimeout(0))
+}
@@ -3,9 +3,14 @@
 package sync
 
 import (
-	"errors"
+	"context"
 	"os"
 	"time"
+
+	"bitbucket.org/avd/go-ipc/internal/attach"
+	"bitbucket.org/avd/go-ipc/ipcperm"
+
+	"github.com/pkg/errors"
 )
 
 var (
@@ -30,6 +35,10 @@ func NewCond(name string, flag int, perm os.FileMode, l IPCLocker) (*Cond, error
 	if err != nil {
 		return nil, err
 	}
+	if c.refs, err = attach.Open(name, perm); err != nil {
+		c.close()
+		return nil, errors.Wrap(err, "failed to attach to the condvar")
+	}
 	return (*Cond)(c), nil
 }
 
@@ -53,17 +62,67 @@ func (c *Cond) WaitTimeout(timeout time.Duration) bool {
 	return (*cond)(c).waitTimeout(timeout)
 }
 
+// WaitContext works like Wait, but it also returns, when the context is done.
+// It returns ctx.Err() in this case. The locker is locked, when WaitContext returns.
+func (c *Cond) WaitContext(ctx context.Context) error {
+	return (*cond)(c).waitContext(ctx)
+}
+
 // Close releases resources of the cond's shared state.
+// If the cond is in destroy-on-close mode, and this was the last user of the cond, it is destroyed.
 func (c *Cond) Close() error {
-	return (*cond)(c).close()
+	err := (*cond)(c).close()
+	last, detachErr := c.refs.Detach()
+	if err != nil {
+		return err
+	}
+	if detachErr != nil {
+		return errors.Wrap(detachErr, "failed to detach from the condvar")
+	}
+	if last {
+		return DestroyCond(c.name)
+	}
+	return nil
 }
 
 // Destroy permanently removes condvar.
 func (c *Cond) Destroy() error {
-	return (*cond)(c).destroy()
+	err := (*cond)(c).destroy()
+	c.refs.Detach()
+	if destroyErr := attach.Destroy(c.name); err == nil && destroyErr != nil {
+		err = errors.Wrap(destroyErr, "failed to destroy attach table")
+	}
+	return err
+}
+
+// SetDestroyOnClose sets whether the cond is destroyed, when the last process closes it.
+// The mode is shared between all processes, which use the cond.
+func (c *Cond) SetDestroyOnClose(enable bool) {
+	c.refs.SetDestroyOnClose(enable)
+}
+
+// Attached returns the number of open instances of the cond in all processes.
+// Instances of crashed processes are not counted.
+func (c *Cond) Attached() int {
+	return c.refs.Count()
 }
 
 // DestroyCond permanently removes condvar with the given name.
 func DestroyCond(name string) error {
-	return destroyCond(name)
+	if err := destroyCond(name); err != nil {
+		return err
+	}
+	if err := attach.Destroy(name); err != nil {
+		return errors.Wrap(err, "failed to destroy attach table")
+	}
+	return nil
+}
+
+// SetCondPermissions changes the mode and the ownership of the condvar with the given name.
+// Permissions of the locker, which is used with the condvar, are not changed.
+func SetCondPermissions(name string, perm ipcperm.Permissions) error {
+	if err := setCondPermissions(name, perm); err != nil {
+		return err
+	}
+	return attach.SetPermissions(name, perm)
 }
@@ -5,12 +5,15 @@
 package sync
 
 import (
+	"context"
 	"os"
 	"time"
 
 	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/attach"
 	"bitbucket.org/avd/go-ipc/internal/common"
 	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 	"bitbucket.org/avd/go-ipc/mmf"
 	"bitbucket.org/avd/go-ipc/shm"
 	"github.com/pkg/errors"
@@ -22,6 +25,7 @@ type cond struct {
 	name   string
 	region *mmf.MemoryRegion
 	ftx    *futex
+	refs   *attach.Table
 }
 
 func newCond(name string, flag int, perm os.FileMode, l IPCLocker) (*cond, error) {
@@ -82,6 +86,24 @@ func (c *cond) waitTimeout(timeout time.Duration) bool {
 	return success
 }
 
+func (c *cond) waitContext(ctx context.Context) error {
+	seq := *c.ftx.addr()
+	c.L.Unlock()
+	// the sequence is read once, so a signal is not missed between the waits.
+	err := waitContext(ctx, func(timeout time.Duration) bool {
+		err := c.ftx.wait(seq, timeout)
+		if err == nil {
+			return true
+		}
+		if !common.IsTimeoutErr(err) {
+			panic(err)
+		}
+		return false
+	})
+	c.L.Lock()
+	return err
+}
+
 func (c *cond) close() error {
 	if err := c.region.Close(); err != nil {
 		return errors.Wrap(err, "failed to close waiters list memory region")
@@ -104,6 +126,10 @@ func destroyCond(name string) error {
 	return shm.DestroyMemoryObject(condSharedStateName(name))
 }
 
+func setCondPermissions(name string, perm ipcperm.Permissions) error {
+	return shm.SetPermissions(condSharedStateName(name), perm)
+}
+
 func condSharedStateName(name string) string {
 	return name + ".st"
 }
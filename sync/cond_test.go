@@ -3,6 +3,7 @@
 package sync
 
 import (
+	"context"
 	"os"
 	"sync"
 	"testing"
@@ -67,6 +68,27 @@ func TestCondWaitTimeout(t *testing.T) {
 	a.False(cond.WaitTimeout(time.Millisecond * 50))
 }
 
+func TestCondWaitContext(t *testing.T) {
+	a := assert.New(t)
+	cond, l, err := makeTestCond(a)
+	if err != nil {
+		return
+	}
+	defer destroyTestCond(a, cond, l)
+	l.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	a.Equal(context.DeadlineExceeded, cond.WaitContext(ctx))
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		l.Lock()
+		cond.Signal()
+		l.Unlock()
+	}()
+	a.NoError(cond.WaitContext(context.Background()))
+	l.Unlock()
+}
+
 func TestCondBroadcast(t *testing.T) {
 	a := assert.New(t)
 	cond, l, err := makeTestCond(a)
@@ -196,3 +218,25 @@ func TestCondWaitAnotherProcess(t *testing.T) {
 		t.Errorf("timeout")
 	}
 }
+
+func TestCondDestroyOnClose(t *testing.T) {
+	a := assert.New(t)
+	cond, l, err := makeTestCond(a)
+	if !a.NoError(err) {
+		return
+	}
+	defer l.Close()
+	defer DestroyMutex(testCondMutName)
+	cond2, err := NewCond(testCondName, 0, 0666, l)
+	if !a.NoError(err) {
+		cond.Destroy()
+		return
+	}
+	a.Equal(2, cond.Attached())
+	cond.SetDestroyOnClose(true)
+	a.NoError(cond.Close())
+	a.Equal(1, cond2.Attached())
+	a.NoError(cond2.Close())
+	_, err = NewCond(testCondName, 0, 0666, l)
+	a.Error(err)
+}
@@ -5,12 +5,15 @@
 package sync
 
 import (
+	"context"
 	"os"
 	"time"
 
 	"bitbucket.org/avd/go-ipc/internal/allocator"
 	"bitbucket.org/avd/go-ipc/internal/array"
+	"bitbucket.org/avd/go-ipc/internal/attach"
 	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 	"bitbucket.org/avd/go-ipc/mmf"
 	"bitbucket.org/avd/go-ipc/shm"
 	"github.com/pkg/errors"
@@ -23,6 +26,7 @@ type cond struct {
 	name          string
 	waitersRegion *mmf.MemoryRegion
 	waiters       *array.SharedArray
+	refs          *attach.Table
 }
 
 func newCond(name string, flag int, perm os.FileMode, l IPCLocker) (*cond, error) {
@@ -106,6 +110,15 @@ func (c *cond) doWait(timeout time.Duration) bool {
 	return result
 }
 
+func (c *cond) waitContext(ctx context.Context) error {
+	w := c.addToWaitersList()
+	c.L.Unlock()
+	err := waitContext(ctx, w.waitTimeout)
+	c.L.Lock()
+	c.cleanupWaiter(w)
+	return err
+}
+
 func (c *cond) cleanupWaiter(w *waiter) {
 	c.listLock.Lock()
 	defer c.listLock.Unlock()
@@ -186,3 +199,13 @@ func destroyCond(name string) error {
 	}
 	return result
 }
+
+func setCondPermissions(name string, perm ipcperm.Permissions) error {
+	if err := SetMutexPermissions(condMutexName(name), perm); err != nil {
+		return errors.Wrap(err, "failed to set cond list mutex permissions")
+	}
+	if err := shm.SetPermissions(condSharedStateName(name), perm); err != nil {
+		return errors.Wrap(err, "failed to set shared cond state permissions")
+	}
+	return nil
+}
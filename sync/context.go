@@ -0,0 +1,59 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package sync
+
+import (
+	"context"
+	"time"
+
+	"bitbucket.org/avd/go-ipc/internal/common"
+)
+
+const (
+	// waits, which can be canceled with a context, are split into the slices of this duration,
+	// so that a cancellation is noticed not later, than after one slice.
+	contextWaitSlice = 10 * time.Millisecond
+)
+
+// ContextLocker is a locker, whose lock operation can be canceled with a context.
+type ContextLocker interface {
+	IPCLocker
+	// LockContext locks the locker, waiting until it is locked, or the context is done.
+	// It returns ctx.Err(), if the locker was not locked.
+	LockContext(ctx context.Context) error
+}
+
+// waitContext calls waiter with timeouts, which do not exceed contextWaitSlice and the context deadline,
+// until it returns true, or the context is done.
+// waiter must not change the shared state of an object, if it returns false.
+func waitContext(ctx context.Context, waiter func(timeout time.Duration) bool) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		timeout := contextWaitSlice
+		if deadline, ok := ctx.Deadline(); ok {
+			if left := time.Until(deadline); left < timeout {
+				timeout = left
+			}
+		}
+		if timeout < 0 {
+			timeout = 0
+		}
+		if waiter(timeout) {
+			return nil
+		}
+	}
+}
+
+// waitTimeout waits on a waitWaker. It returns false, if the timeout expired, and panics on other errors.
+func waitTimeout(ww waitWaker, timeout time.Duration) bool {
+	err := ww.wait(0, timeout)
+	if err == nil {
+		return true
+	}
+	if common.IsTimeoutErr(err) {
+		return false
+	}
+	panic(err)
+}
@@ -3,19 +3,32 @@
 package sync
 
 import (
+	"context"
 	"os"
 	"time"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
+)
+
+const (
+	// O_MANUAL_RESET is a flag for NewEvent, which creates a manual-reset event.
+	// Such event stays signaled, until it is reset with Reset, and Set releases all the waiters.
+	// The mode is stored with the event, and opening the event with another mode fails.
+	// The events, created by the earlier versions, are auto-reset.
+	// Its value was chosen simply not to intersect with the flags from 'os' package.
+	O_MANUAL_RESET = 0x20000000
 )
 
 // Event is a synchronization primitive used for notification.
-// If it is signaled by a call to Set(), it'll stay in this state,
+// By default it is an auto-reset event: if it is signaled by a call to Set(), it'll stay in this state,
 // unless someone calls Wait(). After it the event is reset into non-signaled state.
+// If the event was opened with O_MANUAL_RESET, it stays signaled, until Reset() is called.
 type Event event
 
 // NewEvent creates a new interprocess event.
 // It uses the default implementation on the current platform.
 //	name - object name.
-//	flag - flag is a combination of open flags from 'os' package.
+//	flag - flag is a combination of open flags from 'os' package along with O_MANUAL_RESET.
 //	perm - object's permission bits.
 //	initial - if true, the event will be set after creation.
 func NewEvent(name string, flag int, perm os.FileMode, initial bool) (*Event, error) {
@@ -31,6 +44,22 @@ func (e *Event) Set() {
 	(*event)(e).set()
 }
 
+// Reset sets the event object to the non-signaled state.
+func (e *Event) Reset() {
+	(*event)(e).reset()
+}
+
+// Pulse releases the processes, which are currently waiting for the event, leaving it non-signaled.
+// For an auto-reset event it releases one waiter, if there are any.
+func (e *Event) Pulse() {
+	(*event)(e).pulse()
+}
+
+// IsSet returns true, if the event is in the signaled state.
+func (e *Event) IsSet() bool {
+	return (*event)(e).isSet()
+}
+
 // Wait waits for the event to be signaled.
 func (e *Event) Wait() {
 	(*event)(e).wait()
@@ -41,6 +70,12 @@ func (e *Event) WaitTimeout(timeout time.Duration) bool {
 	return (*event)(e).waitTimeout(timeout)
 }
 
+// WaitContext waits for the event to become signaled, or for the context to be done.
+// It returns ctx.Err(), if the event was not obtained.
+func (e *Event) WaitContext(ctx context.Context) error {
+	return waitContext(ctx, e.WaitTimeout)
+}
+
 // Close closes the event.
 func (e *Event) Close() error {
 	return (*event)(e).close()
@@ -56,6 +91,11 @@ func DestroyEvent(name string) error {
 	return destroyEvent(name)
 }
 
+// SetEventPermissions changes the mode and the ownership of the event with the given name.
+func SetEventPermissions(name string, perm ipcperm.Permissions) error {
+	return setEventPermissions(name, perm)
+}
+
 func eventName(baseName string) string {
 	return baseName + ".ev"
 }
@@ -10,6 +10,7 @@ import (
 
 	"bitbucket.org/avd/go-ipc/internal/allocator"
 	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 	"bitbucket.org/avd/go-ipc/mmf"
 	"bitbucket.org/avd/go-ipc/shm"
 	"github.com/pkg/errors"
@@ -22,22 +23,27 @@ type event struct {
 }
 
 func newEvent(name string, flag int, perm os.FileMode, initial bool) (*event, error) {
+	manual := flag&O_MANUAL_RESET != 0
+	flag &= ^O_MANUAL_RESET
 	if err := ensureOpenFlags(flag); err != nil {
 		return nil, err
 	}
 
-	region, created, err := helper.CreateWritableRegion(eventName(name), flag, perm, lweStateSize)
+	region, created, err := helper.CreateWritableRegionMinSize(eventName(name), flag, perm, lweStateSize, lweLegacyStateSize)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create shared state")
 	}
 	state := allocator.ByteSliceData(region.Data())
 	result := &event{
-		lwe:    newLightweightEvent(state, &futex{ptr: state}),
+		lwe:    newLightweightEvent(state, region.Size(), &futex{ptr: state}, manual),
 		name:   name,
 		region: region,
 	}
 	if created {
 		result.lwe.init(initial)
+	} else if err = result.lwe.open(); err != nil {
+		region.Close()
+		return nil, err
 	}
 	return result, nil
 }
@@ -46,6 +52,18 @@ func (e *event) set() {
 	e.lwe.set()
 }
 
+func (e *event) reset() {
+	e.lwe.reset()
+}
+
+func (e *event) pulse() {
+	e.lwe.pulse()
+}
+
+func (e *event) isSet() bool {
+	return e.lwe.isSet()
+}
+
 func (e *event) wait() {
 	e.waitTimeout(-1)
 }
@@ -72,3 +90,7 @@ func destroyEvent(name string) error {
 	}
 	return nil
 }
+
+func setEventPermissions(name string, perm ipcperm.Permissions) error {
+	return shm.SetPermissions(eventName(name), perm)
+}
@@ -10,6 +10,7 @@ import (
 
 	"bitbucket.org/avd/go-ipc/internal/allocator"
 	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 	"bitbucket.org/avd/go-ipc/mmf"
 	"bitbucket.org/avd/go-ipc/shm"
 	"github.com/pkg/errors"
@@ -23,11 +24,13 @@ type event struct {
 }
 
 func newEvent(name string, flag int, perm os.FileMode, initial bool) (*event, error) {
+	manual := flag&O_MANUAL_RESET != 0
+	flag &= ^O_MANUAL_RESET
 	if err := ensureOpenFlags(flag); err != nil {
 		return nil, err
 	}
 
-	region, created, err := helper.CreateWritableRegion(eventName(name), flag, perm, lweStateSize)
+	region, created, err := helper.CreateWritableRegionMinSize(eventName(name), flag, perm, lweStateSize, lweLegacyStateSize)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create shared state")
 	}
@@ -40,13 +43,16 @@ func newEvent(name string, flag int, perm os.FileMode, initial bool) (*event, er
 		return nil, errors.Wrap(err, "failed to create a semaphore")
 	}
 	result := &event{
-		lwe:    newLightweightEvent(allocator.ByteSliceData(region.Data()), newSemaWaiter(s)),
+		lwe:    newLightweightEvent(allocator.ByteSliceData(region.Data()), region.Size(), newSemaWaiter(s), manual),
 		name:   name,
 		region: region,
 		s:      s,
 	}
 	if created {
 		result.lwe.init(initial)
+	} else if err = result.lwe.open(); err != nil {
+		result.close()
+		return nil, err
 	}
 	return result, nil
 }
@@ -55,6 +61,18 @@ func (e *event) set() {
 	e.lwe.set()
 }
 
+func (e *event) reset() {
+	e.lwe.reset()
+}
+
+func (e *event) pulse() {
+	e.lwe.pulse()
+}
+
+func (e *event) isSet() bool {
+	return e.lwe.isSet()
+}
+
 func (e *event) wait() {
 	e.waitTimeout(-1)
 }
@@ -91,3 +109,10 @@ func destroyEvent(name string) error {
 	}
 	return nil
 }
+
+func setEventPermissions(name string, perm ipcperm.Permissions) error {
+	if err := shm.SetPermissions(eventName(name), perm); err != nil {
+		return errors.Wrap(err, "failed to set shared state permissions")
+	}
+	return setSemaphorePermissions(name, perm)
+}
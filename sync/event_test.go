@@ -3,12 +3,15 @@
 package sync
 
 import (
+	"context"
 	"os"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/helper"
 	"bitbucket.org/avd/go-ipc/internal/test"
 
 	"github.com/stretchr/testify/assert"
@@ -242,6 +245,246 @@ func TestEventWait6(t *testing.T) {
 	a.True(ev.WaitTimeout(0))
 }
 
+func TestEventWaitContext(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyEvent(testEventName)) {
+		return
+	}
+	ev, err := NewEvent(testEventName, os.O_CREATE|os.O_EXCL, 0666, false)
+	if !a.NoError(err) || !a.NotNil(ev) {
+		return
+	}
+	defer func() {
+		a.NoError(ev.Destroy())
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	a.Equal(context.DeadlineExceeded, ev.WaitContext(ctx))
+	time.AfterFunc(time.Millisecond*50, ev.Set)
+	a.NoError(ev.WaitContext(context.Background()))
+	ev.Set()
+	a.True(ev.WaitTimeout(0))
+}
+
+func TestEventResetAndIsSet(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyEvent(testEventName)) {
+		return
+	}
+	ev, err := NewEvent(testEventName, os.O_CREATE|os.O_EXCL, 0666, true)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(ev.Destroy())
+	}()
+	a.True(ev.IsSet())
+	ev.Reset()
+	a.False(ev.IsSet())
+	a.False(ev.WaitTimeout(0))
+	ev.Set()
+	a.True(ev.IsSet())
+	a.True(ev.WaitTimeout(0))
+	a.False(ev.IsSet())
+}
+
+func TestEventPulse(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyEvent(testEventName)) {
+		return
+	}
+	ev, err := NewEvent(testEventName, os.O_CREATE|os.O_EXCL, 0666, false)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(ev.Destroy())
+	}()
+	// without waiters pulse is a no-op.
+	ev.Pulse()
+	a.False(ev.IsSet())
+	a.False(ev.WaitTimeout(0))
+	ch := make(chan bool)
+	go func() {
+		ch <- ev.WaitTimeout(time.Second * 5)
+	}()
+	time.Sleep(time.Millisecond * 50)
+	ev.Pulse()
+	a.True(<-ch)
+	a.False(ev.IsSet())
+}
+
+func TestEventPulseAfterWait(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyEvent(testEventName)) {
+		return
+	}
+	ev, err := NewEvent(testEventName, os.O_CREATE|os.O_EXCL, 0666, false)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(ev.Destroy())
+	}()
+	ch := make(chan bool)
+	go func() {
+		ch <- ev.WaitTimeout(time.Second * 5)
+	}()
+	time.Sleep(time.Millisecond * 50)
+	ev.Set()
+	a.True(<-ch)
+	// the waiter has gone, so pulse must not leave the event set.
+	ev.Pulse()
+	a.False(ev.IsSet())
+	a.False(ev.WaitTimeout(0))
+}
+
+func TestManualResetEvent(t *testing.T) {
+	const waiters = 4
+	a := assert.New(t)
+	if !a.NoError(DestroyEvent(testEventName)) {
+		return
+	}
+	ev, err := NewEvent(testEventName, os.O_CREATE|os.O_EXCL|O_MANUAL_RESET, 0666, false)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(ev.Destroy())
+	}()
+	a.False(ev.WaitTimeout(time.Millisecond * 10))
+	ch := make(chan bool, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			ch <- ev.WaitTimeout(time.Second * 5)
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+	ev.Set()
+	for i := 0; i < waiters; i++ {
+		a.True(<-ch)
+	}
+	// the event stays signaled.
+	a.True(ev.IsSet())
+	a.True(ev.WaitTimeout(0))
+	a.True(ev.WaitTimeout(0))
+	ev.Reset()
+	a.False(ev.IsSet())
+	a.False(ev.WaitTimeout(0))
+}
+
+func TestManualResetEventPulse(t *testing.T) {
+	const waiters = 4
+	a := assert.New(t)
+	if !a.NoError(DestroyEvent(testEventName)) {
+		return
+	}
+	ev, err := NewEvent(testEventName, os.O_CREATE|os.O_EXCL|O_MANUAL_RESET, 0666, false)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(ev.Destroy())
+	}()
+	ch := make(chan bool, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			ch <- ev.WaitTimeout(time.Second * 5)
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+	ev.Pulse()
+	for i := 0; i < waiters; i++ {
+		a.True(<-ch)
+	}
+	a.False(ev.IsSet())
+	a.False(ev.WaitTimeout(time.Millisecond * 10))
+	// timed out waiters must not consume the next release.
+	go func() {
+		ch <- ev.WaitTimeout(time.Second * 5)
+	}()
+	time.Sleep(time.Millisecond * 50)
+	ev.Set()
+	a.True(<-ch)
+}
+
+func TestEventResetModeMismatch(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyEvent(testEventName)) {
+		return
+	}
+	ev, err := NewEvent(testEventName, os.O_CREATE|os.O_EXCL|O_MANUAL_RESET, 0666, false)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(ev.Destroy())
+	}()
+	_, err = NewEvent(testEventName, 0, 0666, false)
+	a.Error(err)
+	ev2, err := NewEvent(testEventName, O_MANUAL_RESET, 0666, false)
+	if a.NoError(err) {
+		a.NoError(ev2.Close())
+	}
+}
+
+func TestEventOpenBeforeInit(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyEvent(testEventName)) {
+		return
+	}
+	// the state has been created, but the mode has not been published yet.
+	region, _, err := helper.CreateWritableRegion(eventName(testEventName), os.O_CREATE|os.O_EXCL, 0666, lweStateSize)
+	if !a.NoError(err) {
+		return
+	}
+	defer region.Close()
+	opened := make(chan *Event)
+	go func() {
+		ev, err := NewEvent(testEventName, os.O_CREATE|O_MANUAL_RESET, 0666, false)
+		a.NoError(err)
+		opened <- ev
+	}()
+	time.Sleep(time.Millisecond * 50)
+	newLightweightEvent(allocator.ByteSliceData(region.Data()), region.Size(), nil, true).init(true)
+	ev := <-opened
+	if ev == nil {
+		return
+	}
+	defer func() {
+		a.NoError(ev.Destroy())
+	}()
+	a.True(ev.IsSet())
+	a.True(ev.WaitTimeout(0))
+	a.True(ev.IsSet())
+}
+
+func TestEventLegacyState(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyEvent(testEventName)) {
+		return
+	}
+	// the state of an event, created by an earlier version, has no mode.
+	region, _, err := helper.CreateWritableRegion(eventName(testEventName), os.O_CREATE|os.O_EXCL, 0666, lweLegacyStateSize)
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(region.Close())
+	_, err = NewEvent(testEventName, os.O_CREATE|O_MANUAL_RESET, 0666, false)
+	a.Error(err)
+	ev, err := NewEvent(testEventName, os.O_CREATE, 0666, false)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(ev.Destroy())
+	}()
+	a.Equal(lweLegacyStateSize, ev.region.Size())
+	ev.Set()
+	a.True(ev.WaitTimeout(0))
+	a.False(ev.IsSet())
+}
+
 func TestEventSetAnotherProcess(t *testing.T) {
 	a := assert.New(t)
 	if !a.NoError(DestroyEvent(testEventName)) {
@@ -19,6 +19,9 @@ const (
 	cFUTEX_REQUEUE     = 3
 	cFUTEX_CMP_REQUEUE = 4
 	cFUTEX_WAKE_OP     = 5
+	cFUTEX_LOCK_PI     = 6
+	cFUTEX_UNLOCK_PI   = 7
+	cFUTEX_TRYLOCK_PI  = 8
 
 	// FUTEX_PRIVATE_FLAG is used to optimize futex usage for process-private futexes.
 	FUTEX_PRIVATE_FLAG = 128
@@ -62,6 +65,36 @@ func FutexWake(addr unsafe.Pointer, count int32, flags int32) (int, error) {
 	return 0, err
 }
 
+// FutexLockPI locks a priority-inheritance futex, waiting for not longer, than timeout.
+// The futex value must be 0 for an unlocked futex, or a tid of the owner thread.
+// If the futex is locked, the kernel boosts the priority of the owner thread up to
+// the priority of the highest-priority waiter.
+func FutexLockPI(addr unsafe.Pointer, timeout time.Duration, flags int32) error {
+	return common.UninterruptedSyscallTimeout(func(tm time.Duration) error {
+		// FUTEX_LOCK_PI treats the timeout as an absolute time based on CLOCK_REALTIME.
+		_, err := sys_futex(addr, cFUTEX_LOCK_PI|flags, 0, unsafe.Pointer(common.AbsTimeoutToTimeSpec(tm)), nil, 0)
+		return err
+	}, timeout)
+}
+
+// FutexTryLockPI makes one attempt to lock a priority-inheritance futex.
+// If the futex is locked, EWOULDBLOCK is returned.
+func FutexTryLockPI(addr unsafe.Pointer, flags int32) error {
+	return common.UninterruptedSyscall(func() error {
+		_, err := sys_futex(addr, cFUTEX_TRYLOCK_PI|flags, 0, nil, nil, 0)
+		return err
+	})
+}
+
+// FutexUnlockPI unlocks a priority-inheritance futex, which is owned by the calling thread,
+// and wakes the highest-priority waiter.
+func FutexUnlockPI(addr unsafe.Pointer, flags int32) error {
+	return common.UninterruptedSyscall(func() error {
+		_, err := sys_futex(addr, cFUTEX_UNLOCK_PI|flags, 0, nil, nil, 0)
+		return err
+	})
+}
+
 func sys_futex(addr unsafe.Pointer, op int32, val int32, ts, addr2 unsafe.Pointer, val3 uint32) (int32, error) {
 	r1, _, err := unix.Syscall6(unix.SYS_FUTEX,
 		uintptr(addr),
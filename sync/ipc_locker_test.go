@@ -3,6 +3,7 @@
 package sync
 
 import (
+	"context"
 	"math/rand"
 	"os"
 	"runtime"
@@ -389,6 +390,54 @@ func testLockerLockTimeout2(t *testing.T, typ string, ctor lockerCtor, dtor lock
 	}
 }
 
+func testLockerLockContext(t *testing.T, typ string, ctor lockerCtor, dtor lockerDtor) {
+	a := assert.New(t)
+	if !a.NoError(dtor(testLockerName)) {
+		return
+	}
+	m, err := ctor(testLockerName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) || !a.NotNil(m) {
+		return
+	}
+	defer func() {
+		a.NoError(m.Close())
+	}()
+	defer dtor(testLockerName)
+	cl, ok := m.(ContextLocker)
+	if !ok {
+		t.Skipf("context locker of type %q is not supported on %s(%s)", typ, runtime.GOOS, runtime.GOARCH)
+		return
+	}
+	result := make(chan error, 1)
+	lockAsync := func(ctx context.Context) {
+		go func() {
+			err := cl.LockContext(ctx)
+			if err == nil {
+				cl.Unlock()
+			}
+			result <- err
+		}()
+	}
+	cl.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	lockAsync(ctx)
+	a.Equal(context.DeadlineExceeded, <-result)
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*20, cancel)
+	lockAsync(ctx)
+	a.Equal(context.Canceled, <-result)
+	lockAsync(context.Background())
+	time.Sleep(time.Millisecond * 50)
+	cl.Unlock()
+	select {
+	case err := <-result:
+		a.NoError(err)
+	case <-time.After(time.Second):
+		t.Error("failed to lock the locker")
+	}
+}
+
 func testLockerTwiceUnlock(t *testing.T, ctor lockerCtor, dtor lockerDtor) {
 	a := assert.New(t)
 	if !a.NoError(dtor(testLockerName)) {
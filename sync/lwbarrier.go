@@ -0,0 +1,219 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package sync
+
+import (
+	"math"
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/common"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	barrierStateSize = int(unsafe.Sizeof(barrierState{}))
+
+	barrierCountMask  = 0xffff
+	barrierGenShift   = 16
+	barrierGenMask    = 0x7fff
+	barrierBrokenFlag = 0x80000000
+
+	// Reset checks, whether the parties of a broken generation have left, with this interval,
+	// if the waiters can't be woken without posting permits.
+	barrierResetInterval = time.Millisecond
+)
+
+// barrierState is the shared state of a barrier.
+// word is a futex word, which consists of:
+//	the highest bit is a broken flag
+//	the next 15 bits are the generation, which is incremented every time the barrier trips
+//	the lowest 16 bits define the number of parties, which have arrived in this generation.
+// parties is set by the creator after the word is initialized, so it is also a ready flag for the openers.
+type barrierState struct {
+	word    uint32
+	parties uint32
+}
+
+// lwBarrier is a lightweight barrier implementation.
+// actual wait/wake must be implemented by a waitWaker object.
+// the waitWaker must be able to wake exactly 'count' waiters, as semaphores do,
+// or wake all the waiters, which wait for the value of the word.
+// if permits is true, every wake is a permit, which must be consumed by a waiter,
+// that had arrived before the barrier was tripped or broken.
+type lwBarrier struct {
+	state   *barrierState
+	ww      waitWaker
+	permits bool
+}
+
+func newLightweightBarrier(state unsafe.Pointer, ww waitWaker, permits bool) *lwBarrier {
+	return &lwBarrier{state: (*barrierState)(state), ww: ww, permits: permits}
+}
+
+// init writes initial value into barrier's memory location, and then publishes the number of parties.
+func (b *lwBarrier) init(parties int) {
+	atomic.StoreUint32(&b.state.word, 0)
+	atomic.StoreUint32(&b.state.parties, uint32(parties))
+}
+
+// open waits for the creator to publish the number of parties.
+func (b *lwBarrier) open() error {
+	if !common.WaitReady(func() bool { return atomic.LoadUint32(&b.state.parties) != 0 }) {
+		return errors.New("the barrier was not initialized")
+	}
+	return nil
+}
+
+func (b *lwBarrier) waitTimeout(timeout time.Duration) (bool, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	gen, last, err := b.arrive()
+	if last || err != nil {
+		return last, err
+	}
+	// woken is true, if the caller has consumed a permit.
+	var woken bool
+	for {
+		word := atomic.LoadUint32(&b.state.word)
+		released := barrierGen(word) != gen || word&barrierBrokenFlag != 0
+		if released && b.permits && !woken {
+			// a permit has been posted for every party, which waited, when the barrier was tripped or broken.
+			if err = b.ww.wait(int32(word), -1); err != nil {
+				return false, err
+			}
+			woken = true
+		}
+		if barrierGen(word) != gen {
+			return false, nil
+		}
+		if word&barrierBrokenFlag != 0 {
+			if b.leave(word, word) {
+				return false, ErrBarrierBroken
+			}
+			continue
+		}
+		if woken {
+			// we have taken a permit posted for a party of another generation.
+			// give it back, so that the party is not left blocked forever.
+			b.wake(1)
+			woken = false
+			runtime.Gosched()
+			continue
+		}
+		wait := timeout
+		if timeout > 0 {
+			if wait = time.Until(deadline); wait < 0 {
+				wait = 0
+			}
+		}
+		if wait != 0 {
+			err = b.ww.wait(int32(word), wait)
+			if err == nil {
+				woken = b.permits
+				continue
+			}
+			if !common.IsTimeoutErr(err) {
+				return false, err
+			}
+		}
+		// the timeout expired, break the barrier, unless it has tripped.
+		if b.leave(word, word|barrierBrokenFlag) {
+			b.wake(word&barrierCountMask - 1)
+			return false, common.NewTimeoutError("BARRIER")
+		}
+	}
+}
+
+func (b *lwBarrier) reset() {
+	for {
+		word := atomic.LoadUint32(&b.state.word)
+		if word&barrierCountMask == 0 {
+			if atomic.CompareAndSwapUint32(&b.state.word, word, barrierNextGen(word)) {
+				return
+			}
+			continue
+		}
+		if word&barrierBrokenFlag == 0 {
+			if atomic.CompareAndSwapUint32(&b.state.word, word, word|barrierBrokenFlag) {
+				b.wake(word & barrierCountMask)
+			}
+			continue
+		}
+		// wait for the parties of the broken generation to leave.
+		if b.permits {
+			time.Sleep(barrierResetInterval)
+		} else if err := b.ww.wait(int32(word), -1); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (b *lwBarrier) parties() int {
+	return int(atomic.LoadUint32(&b.state.parties))
+}
+
+func (b *lwBarrier) isBroken() bool {
+	return atomic.LoadUint32(&b.state.word)&barrierBrokenFlag != 0
+}
+
+// arrive registers the caller as an arrived party.
+// It returns the generation, the caller belongs to, and true, if the caller has tripped the barrier.
+func (b *lwBarrier) arrive() (uint32, bool, error) {
+	parties := atomic.LoadUint32(&b.state.parties)
+	for {
+		word := atomic.LoadUint32(&b.state.word)
+		if word&barrierBrokenFlag != 0 {
+			return 0, false, ErrBarrierBroken
+		}
+		if word&barrierCountMask+1 < parties {
+			if atomic.CompareAndSwapUint32(&b.state.word, word, word+1) {
+				return barrierGen(word), false, nil
+			}
+			continue
+		}
+		if atomic.CompareAndSwapUint32(&b.state.word, word, barrierNextGen(word)) {
+			b.wake(word & barrierCountMask)
+			return barrierGen(word), true, nil
+		}
+	}
+}
+
+// leave removes the caller from the parties, which are waiting in the generation of the old state.
+// The parties of a broken generation leave it one by one, and the last of them wakes Reset, if it waits.
+func (b *lwBarrier) leave(old, new uint32) bool {
+	if !atomic.CompareAndSwapUint32(&b.state.word, old, new-1) {
+		return false
+	}
+	if !b.permits && old&barrierBrokenFlag != 0 && (new-1)&barrierCountMask == 0 {
+		b.wake(math.MaxInt32)
+	}
+	return true
+}
+
+// wake wakes 'count' waiters, or all of them, if the waitWaker does not post permits.
+func (b *lwBarrier) wake(count uint32) {
+	if !b.permits {
+		count = math.MaxInt32
+	}
+	if count == 0 {
+		return
+	}
+	if _, err := b.ww.wake(int32(count)); err != nil {
+		panic(err)
+	}
+}
+
+// barrierNextGen returns the state of the next generation with no parties and without the broken flag.
+func barrierNextGen(word uint32) uint32 {
+	return ((barrierGen(word) + 1) & barrierGenMask) << barrierGenShift
+}
+
+func barrierGen(word uint32) uint32 {
+	return (word >> barrierGenShift) & barrierGenMask
+}
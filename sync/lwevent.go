@@ -8,11 +8,29 @@ import (
 	"time"
 	"unsafe"
 
+	"bitbucket.org/avd/go-ipc/internal/allocator"
 	"bitbucket.org/avd/go-ipc/internal/common"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// the state is followed by the mode.
+	lweStateSize  = 8
+	lweModeOffset = 4
+	// the events, created by the earlier versions, have no mode after the state, and are auto-reset.
+	lweLegacyStateSize = 4
+
+	lweManualWaitersMask = 0xffff
+	lweManualGenMask     = 0x7fff0000
+	lweManualGenInc      = 1 << 16
 )
 
+// event modes. the mode is published by the creator after the state is initialized,
+// so zero means, that the event is not ready yet.
 const (
-	lweStateSize = 4
+	lweModeAuto = int32(iota + 1)
+	lweModeManual
 )
 
 // lwEvent is a lightweight event implementation operating on a uint32 memory cell.
@@ -21,24 +39,66 @@ const (
 // state is a shared variable, that contains event state:
 //	the highest bit is a signal bit
 //	all other bits define the number of waiters.
+// for a manual-reset event the bits after the signal bit are split into:
+//	15 bits of the generation, which is incremented every time the waiters are released
+//	16 bits, which define the number of waiters.
+// mode is a shared variable, which tells, whether the event is a manual-reset one.
+// it is nil, if the state was created by an earlier version.
 type lwEvent struct {
-	state *int32
-	ww    waitWaker
+	state  *int32
+	mode   *int32
+	ww     waitWaker
+	manual bool
 }
 
-func newLightweightEvent(state unsafe.Pointer, ww waitWaker) *lwEvent {
-	return &lwEvent{state: (*int32)(state), ww: ww}
+// newLightweightEvent returns an event over a state of the given size.
+func newLightweightEvent(state unsafe.Pointer, size int, ww waitWaker, manual bool) *lwEvent {
+	result := &lwEvent{state: (*int32)(state), ww: ww, manual: manual}
+	if size >= lweStateSize {
+		result.mode = (*int32)(allocator.AdvancePointer(state, lweModeOffset))
+	}
+	return result
 }
 
+// init writes initial value into event's memory location, and then publishes the mode.
 func (e *lwEvent) init(set bool) {
 	val := int32(0)
 	if set {
 		val = math.MinInt32
 	}
-	*e.state = val
+	atomic.StoreInt32(e.state, val)
+	if e.mode != nil {
+		atomic.StoreInt32(e.mode, e.modeValue())
+	}
+}
+
+// open waits for the creator to publish the mode, and checks, that it is the same, as the one of the event.
+func (e *lwEvent) open() error {
+	mode := lweModeAuto
+	if e.mode != nil {
+		if !common.WaitReady(func() bool { return atomic.LoadInt32(e.mode) != 0 }) {
+			return errors.New("the event was not initialized")
+		}
+		mode = atomic.LoadInt32(e.mode)
+	}
+	if mode != e.modeValue() {
+		return errors.New("the event was created with another reset mode")
+	}
+	return nil
+}
+
+func (e *lwEvent) modeValue() int32 {
+	if e.manual {
+		return lweModeManual
+	}
+	return lweModeAuto
 }
 
 func (e *lwEvent) set() {
+	if e.manual {
+		e.release(true)
+		return
+	}
 	var old int32
 	for {
 		old = atomic.LoadInt32(e.state)
@@ -55,15 +115,49 @@ func (e *lwEvent) set() {
 	}
 }
 
-func (e *lwEvent) obtainOrChange(inc int32) (new int32, obtained bool) {
+// reset resets the signal bit.
+func (e *lwEvent) reset() {
+	for {
+		old := atomic.LoadInt32(e.state)
+		if old >= 0 || atomic.CompareAndSwapInt32(e.state, old, old&^math.MinInt32) {
+			return
+		}
+	}
+}
+
+// pulse releases current waiters, leaving the event reset.
+// for an auto-reset event it releases one waiter, if there are any.
+func (e *lwEvent) pulse() {
+	if e.manual {
+		e.release(false)
+		return
+	}
+	for {
+		old := atomic.LoadInt32(e.state)
+		if old <= 0 {
+			return
+		}
+		if atomic.CompareAndSwapInt32(e.state, old, old|math.MinInt32) {
+			e.ww.wake(1)
+			return
+		}
+	}
+}
+
+func (e *lwEvent) isSet() bool {
+	return atomic.LoadInt32(e.state) < 0
+}
+
+// obtainOrChange tries to reset the signal bit. if it was set, the number of waiters is changed by onObtain.
+// otherwise, the number of waiters is changed by inc.
+func (e *lwEvent) obtainOrChange(inc, onObtain int32) (new int32, obtained bool) {
 	for {
 		old := atomic.LoadInt32(e.state)
-		new = old
 		if old < 0 { // reset 'set' bit
-			new = old & ^math.MinInt32
+			new = (old & ^math.MinInt32) + onObtain
 		} else { // change the value
 			if inc == 0 {
-				return
+				return old, false
 			}
 			new = old + inc
 		}
@@ -77,24 +171,92 @@ func (e *lwEvent) obtainOrChange(inc int32) (new int32, obtained bool) {
 }
 
 func (e *lwEvent) waitTimeout(timeout time.Duration) bool {
+	if e.manual {
+		return e.waitManual(timeout)
+	}
 	// first, we are trying to catch the event, or add us as a waiter.
-	new, obtained := e.obtainOrChange(1)
+	new, obtained := e.obtainOrChange(1, 0)
 	if obtained {
 		return true
 	}
 	// in the loop we wait for the value to change and then observe new value:
 	//	if it is still not set, wait again
-	//	otherwise, try to obtain the event.
+	//	otherwise, try to obtain the event and remove us from the waiters.
 	for {
 		if err := e.ww.wait(new, timeout); err != nil {
 			if common.IsTimeoutErr(err) {
-				_, obtained = e.obtainOrChange(-1)
+				_, obtained = e.obtainOrChange(-1, -1)
 				return obtained
 			}
 		}
-		new, obtained = e.obtainOrChange(0)
+		new, obtained = e.obtainOrChange(0, -1)
 		if obtained {
 			return true
 		}
 	}
 }
+
+// release releases all the waiters of a manual-reset event and starts a new generation.
+// if set is true, the event stays signaled.
+func (e *lwEvent) release(set bool) {
+	for {
+		old := atomic.LoadInt32(e.state)
+		if old < 0 {
+			return
+		}
+		waiters := old & lweManualWaitersMask
+		if waiters == 0 && !set {
+			return
+		}
+		new := (old + lweManualGenInc) & lweManualGenMask
+		if set {
+			new |= math.MinInt32
+		}
+		if atomic.CompareAndSwapInt32(e.state, old, new) {
+			if waiters > 0 {
+				e.ww.wake(waiters)
+			}
+			return
+		}
+	}
+}
+
+func (e *lwEvent) waitManual(timeout time.Duration) bool {
+	var value int32
+	for {
+		old := atomic.LoadInt32(e.state)
+		if old < 0 {
+			return true
+		}
+		if old&lweManualWaitersMask == lweManualWaitersMask {
+			panic("too many event waiters")
+		}
+		if value = old + 1; atomic.CompareAndSwapInt32(e.state, old, value) {
+			break
+		}
+	}
+	gen := value & lweManualGenMask
+	for {
+		err := e.ww.wait(value, timeout)
+		if err != nil && !common.IsTimeoutErr(err) {
+			panic(err)
+		}
+		for {
+			cur := atomic.LoadInt32(e.state)
+			if cur&lweManualGenMask != gen {
+				if err != nil {
+					// we were released after the timeout, so we must consume the wakeup.
+					e.ww.wait(value, -1)
+				}
+				return true
+			}
+			if err == nil {
+				value = cur
+				break
+			}
+			if atomic.CompareAndSwapInt32(e.state, cur, cur-1) {
+				return false
+			}
+		}
+	}
+}
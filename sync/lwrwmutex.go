@@ -3,17 +3,36 @@
 package sync
 
 import (
+	"context"
 	"sync/atomic"
+	"time"
 	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
 )
 
 const (
-	lwRWMStateSize          = 8
+	// the state is followed by the policy.
+	lwRWMStateSize    = 12
+	lwRWMPolicyOffset = 8
+	// the mutexes, created by the earlier versions, have no policy after the state.
+	lwRWMLegacyStateSize    = 8
 	lwRWMMask               = 0x1FFFFF
 	lwRWMWaitingReaderShift = 21
 	lwRWMWriterShift        = 42
 )
 
+// rwmutex policies, which define, whether readers or writers go first.
+const (
+	// readers, which arrived, while a writer was holding or waiting for the mutex,
+	// are let in before the next writer.
+	lwRWMPhaseFair = int32(iota)
+	// readers can join active readers, even if there are waiting writers.
+	lwRWMReaderPreference
+	// waiting writers go before waiting readers.
+	lwRWMWriterPreference
+)
+
 // wRWState is a shared rwmutex state with the following bits distribution:
 //  ...63...|62.................42|41.................21|20.................0|
 //  --------|---------------------|---------------------|--------------------|
@@ -45,6 +64,16 @@ func (s *lwRWState) addWriters(count int64) {
 	*(*int64)(s) += count << lwRWMWriterShift
 }
 
+// wakeWaitingReaders turns all waiting readers into readers and returns their number.
+func (s *lwRWState) wakeWaitingReaders() int64 {
+	wr := s.waitingReaders()
+	if wr > 0 {
+		s.addWaitingReaders(-wr)
+		s.addReaders(wr)
+	}
+	return wr
+}
+
 // lwRWMutex is an optimized low-level rwmutex implementation,
 // that doesn't have internal lock for its state.
 // this implementation is inspired by Jeff Preshing and his article at
@@ -54,32 +83,161 @@ type lwRWMutex struct {
 	rWaiter waitWaker
 	wWaiter waitWaker
 	state   *int64
+	policy  *int32
 }
 
-func newRWLightweightMutex(state unsafe.Pointer, rWaiter, wWaiter waitWaker) *lwRWMutex {
-	return &lwRWMutex{state: (*int64)(state), rWaiter: rWaiter, wWaiter: wWaiter}
+// newRWLightweightMutex returns a mutex over a state of the given size.
+// if the state has no policy, the mutex uses the phase-fair policy, which was the only one before.
+func newRWLightweightMutex(state unsafe.Pointer, size int, rWaiter, wWaiter waitWaker) *lwRWMutex {
+	result := &lwRWMutex{
+		state:   (*int64)(state),
+		policy:  new(int32),
+		rWaiter: rWaiter,
+		wWaiter: wWaiter,
+	}
+	if size >= lwRWMStateSize {
+		result.policy = (*int32)(allocator.AdvancePointer(state, lwRWMPolicyOffset))
+	}
+	return result
 }
 
-// init writes initial value into mutex's memory location.
-func (lwrw *lwRWMutex) init() {
+// init writes initial value and the policy into mutex's memory location.
+func (lwrw *lwRWMutex) init(policy int32) {
 	*lwrw.state = 0
+	atomic.StoreInt32(lwrw.policy, policy)
+}
+
+// readerCanEnter returns true, if a new reader can take the mutex in the given state.
+func (lwrw *lwRWMutex) readerCanEnter(s lwRWState) bool {
+	if s.writers() == 0 {
+		return true
+	}
+	// if there are active readers, no writer holds the mutex, or has been woken.
+	return s.readers() > 0 && atomic.LoadInt32(lwrw.policy) == lwRWMReaderPreference
 }
 
 func (lwrw *lwRWMutex) lock() {
+	lwrw.doLock(func(ww waitWaker) bool {
+		return waitTimeout(ww, -1)
+	})
+}
+
+func (lwrw *lwRWMutex) tryLock() bool {
+	return atomic.CompareAndSwapInt64(lwrw.state, 0, 1<<lwRWMWriterShift)
+}
+
+func (lwrw *lwRWMutex) lockTimeout(timeout time.Duration) bool {
+	return lwrw.doLock(func(ww waitWaker) bool {
+		return waitTimeout(ww, timeout)
+	})
+}
+
+func (lwrw *lwRWMutex) lockContext(ctx context.Context) error {
+	var err error
+	if lwrw.doLock(func(ww waitWaker) bool {
+		err = waitContext(ctx, func(timeout time.Duration) bool {
+			return waitTimeout(ww, timeout)
+		})
+		return err == nil
+	}) {
+		return nil
+	}
+	return err
+}
+
+func (lwrw *lwRWMutex) rlock() {
+	lwrw.doRLock(func(ww waitWaker) bool {
+		return waitTimeout(ww, -1)
+	})
+}
+
+func (lwrw *lwRWMutex) tryRLock() bool {
+	for {
+		old := (lwRWState)(atomic.LoadInt64(lwrw.state))
+		if !lwrw.readerCanEnter(old) {
+			return false
+		}
+		new := old
+		new.addReaders(1)
+		if atomic.CompareAndSwapInt64(lwrw.state, (int64)(old), (int64)(new)) {
+			return true
+		}
+	}
+}
+
+func (lwrw *lwRWMutex) rlockTimeout(timeout time.Duration) bool {
+	return lwrw.doRLock(func(ww waitWaker) bool {
+		return waitTimeout(ww, timeout)
+	})
+}
+
+func (lwrw *lwRWMutex) rlockContext(ctx context.Context) error {
+	var err error
+	if lwrw.doRLock(func(ww waitWaker) bool {
+		err = waitContext(ctx, func(timeout time.Duration) bool {
+			return waitTimeout(ww, timeout)
+		})
+		return err == nil
+	}) {
+		return nil
+	}
+	return err
+}
+
+// doLock adds a writer and, if the mutex is locked, waits using the given func.
+// if the wait fails, it removes the writer.
+func (lwrw *lwRWMutex) doLock(wait func(ww waitWaker) bool) bool {
 	new := (lwRWState)(atomic.AddInt64(lwrw.state, 1<<lwRWMWriterShift))
 	if new.readers() > 0 || new.writers() > 1 {
-		if err := lwrw.wWaiter.wait(0, -1); err != nil {
-			panic(err)
+		if !wait(lwrw.wWaiter) {
+			return lwrw.cancelLock()
 		}
 	}
+	return true
 }
 
-func (lwrw *lwRWMutex) rlock() {
+// cancelLock removes a waiting writer from the state.
+// if the writer has already been woken, it can't be removed, so it takes the mutex and returns true.
+func (lwrw *lwRWMutex) cancelLock() bool {
 	var new lwRWState
+	var wr int64
 	for {
 		old := (lwRWState)(atomic.LoadInt64(lwrw.state))
+		if old.readers() == 0 && old.writers() == 1 {
+			// we are the only writer, and there are no readers, so the mutex belongs to us.
+			// the wake has already been done, or is about to be done.
+			if !waitTimeout(lwrw.wWaiter, -1) {
+				panic("failed to obtain the mutex")
+			}
+			return true
+		}
+		// if there are other writers, and the wake for a writer is pending, one of them will consume it.
 		new = old
+		new.addWriters(-1)
+		wr = 0
 		if new.writers() == 0 {
+			// there is no writer to wake the readers, which were waiting for us, so do it now.
+			wr = new.wakeWaitingReaders()
+		}
+		if atomic.CompareAndSwapInt64(lwrw.state, (int64)(old), (int64)(new)) {
+			break
+		}
+	}
+	if wr > 0 {
+		lwrw.rWaiter.wake(int32(wr))
+	}
+	return false
+}
+
+// doRLock adds a reader and, if the mutex is locked by a writer, waits using the given func.
+// if the wait fails, it removes the reader.
+func (lwrw *lwRWMutex) doRLock(wait func(ww waitWaker) bool) bool {
+	var new lwRWState
+	var entered bool
+	for {
+		old := (lwRWState)(atomic.LoadInt64(lwrw.state))
+		new = old
+		if entered = lwrw.readerCanEnter(old); entered {
 			new.addReaders(1)
 		} else {
 			new.addWaitingReaders(1)
@@ -88,9 +246,32 @@ func (lwrw *lwRWMutex) rlock() {
 			break
 		}
 	}
-	if new.writers() > 0 {
-		if err := lwrw.rWaiter.wait(0, -1); err != nil {
-			panic(err)
+	if !entered {
+		if !wait(lwrw.rWaiter) {
+			return lwrw.cancelRLock()
+		}
+	}
+	return true
+}
+
+// cancelRLock removes a waiting reader from the state.
+// waiting readers are indistinguishable, so if the reader has already been turned into an active one,
+// it removes another waiting reader, which will consume the wake intended for this one.
+// if there are no waiting readers, the reader has been turned into an active one,
+// so it consumes its wake, takes the mutex and returns true.
+func (lwrw *lwRWMutex) cancelRLock() bool {
+	for {
+		old := (lwRWState)(atomic.LoadInt64(lwrw.state))
+		if old.waitingReaders() == 0 {
+			if !waitTimeout(lwrw.rWaiter, -1) {
+				panic("failed to obtain the mutex")
+			}
+			return true
+		}
+		new := old
+		new.addWaitingReaders(-1)
+		if atomic.CompareAndSwapInt64(lwrw.state, (int64)(old), (int64)(new)) {
+			return false
 		}
 	}
 }
@@ -114,9 +295,9 @@ func (lwrw *lwRWMutex) unlock() {
 		}
 		new = old
 		new.addWriters(-1)
-		if wr := new.waitingReaders(); wr > 0 {
-			new.addWaitingReaders(-wr)
-			new.addReaders(wr)
+		// with writer preference the readers wait, until there are no writers.
+		if new.writers() == 0 || atomic.LoadInt32(lwrw.policy) != lwRWMWriterPreference {
+			new.wakeWaitingReaders()
 		}
 		if atomic.CompareAndSwapInt64(lwrw.state, (int64)(old), (int64)(new)) {
 			break
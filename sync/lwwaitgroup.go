@@ -0,0 +1,155 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package sync
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/common"
+)
+
+const (
+	lwwgStateSize = int(unsafe.Sizeof(lwwgState{}))
+
+	lwwgGenMask     = 0xffff
+	lwwgWaitersMask = 0xffff0000
+	lwwgWaiterInc   = 1 << 16
+)
+
+// lwwgState is the shared state of a lightweight wait group.
+// word consists of:
+//	the highest 32 bits are the counter
+//	the next 16 bits define the number of waiters
+//	the lowest 16 bits are the generation, which is incremented every time the counter drops to zero with waiters.
+// seq is a copy of the generation, which is used as a futex word.
+type lwwgState struct {
+	word uint64
+	seq  int32
+}
+
+// lwWaitGroup is a lightweight wait group implementation.
+// It makes a syscall only if there are waiters, when the counter drops to zero.
+// actual wait/wake must be implemented by a waitWaker object.
+// the waitWaker must be able to wake exactly 'count' waiters, as semaphores do,
+// or wake all the waiters, which wait for the value of seq.
+// if permits is true, every wake is a permit, which must be consumed by a waiter of the released generation.
+type lwWaitGroup struct {
+	state   *lwwgState
+	ww      waitWaker
+	permits bool
+}
+
+func newLightweightWaitGroup(state unsafe.Pointer, ww waitWaker, permits bool) *lwWaitGroup {
+	return &lwWaitGroup{state: (*lwwgState)(state), ww: ww, permits: permits}
+}
+
+// init writes initial value into wait group's memory location.
+func (wg *lwWaitGroup) init() {
+	*wg.state = lwwgState{}
+}
+
+func (wg *lwWaitGroup) add(delta int) {
+	for {
+		old := atomic.LoadUint64(&wg.state.word)
+		counter := int64(int32(old>>32)) + int64(delta)
+		if counter < 0 {
+			panic("negative wait group counter")
+		}
+		if int64(int32(counter)) != counter {
+			panic("wait group counter overflow")
+		}
+		new := uint64(uint32(counter))<<32 | old&(lwwgWaitersMask|lwwgGenMask)
+		waiters := (old & lwwgWaitersMask) >> 16
+		if counter == 0 && waiters > 0 {
+			// release the waiters and start a new generation.
+			new = (old + 1) & lwwgGenMask
+		}
+		if !atomic.CompareAndSwapUint64(&wg.state.word, old, new) {
+			continue
+		}
+		if new&lwwgGenMask != old&lwwgGenMask {
+			atomic.StoreInt32(&wg.state.seq, int32(new&lwwgGenMask))
+			if _, err := wg.ww.wake(int32(waiters)); err != nil {
+				panic(err)
+			}
+		}
+		return
+	}
+}
+
+func (wg *lwWaitGroup) waitTimeout(timeout time.Duration) bool {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	var gen uint64
+	for {
+		old := atomic.LoadUint64(&wg.state.word)
+		if old>>32 == 0 {
+			return true
+		}
+		if old&lwwgWaitersMask == lwwgWaitersMask {
+			panic("too many wait group waiters")
+		}
+		if atomic.CompareAndSwapUint64(&wg.state.word, old, old+lwwgWaiterInc) {
+			gen = old & lwwgGenMask
+			break
+		}
+	}
+	for {
+		wait := timeout
+		if timeout > 0 {
+			if wait = time.Until(deadline); wait < 0 {
+				wait = 0
+			}
+		}
+		var err error
+		if wait == 0 {
+			err = common.NewTimeoutError("WAITGROUP")
+		} else {
+			err = wg.ww.wait(int32(gen), wait)
+		}
+		if err == nil {
+			if atomic.LoadUint64(&wg.state.word)&lwwgGenMask != gen {
+				return true
+			}
+			if wg.permits {
+				// we have taken a permit posted for a waiter of a previous generation.
+				// give it back, so that the waiter is not left blocked forever.
+				if _, err = wg.ww.wake(1); err != nil {
+					panic(err)
+				}
+				runtime.Gosched()
+			}
+			continue
+		}
+		if !common.IsTimeoutErr(err) {
+			panic(err)
+		}
+		if wg.cancelWait(gen) {
+			return false
+		}
+		// the waiters have been released after the timeout, so we must consume the wakeup.
+		if err = wg.ww.wait(int32(gen), -1); err != nil {
+			panic(err)
+		}
+		return true
+	}
+}
+
+// cancelWait removes the caller from the waiters of the given generation.
+// It returns false, if the generation has already been released.
+func (wg *lwWaitGroup) cancelWait(gen uint64) bool {
+	for {
+		old := atomic.LoadUint64(&wg.state.word)
+		if old&lwwgGenMask != gen {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(&wg.state.word, old, old-lwwgWaiterInc) {
+			return true
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"os"
 	"sync"
 	"time"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
 )
 
 // IPCLocker is a minimal interface, which must be satisfied by any synchronization primitive on any platform.
@@ -36,6 +38,14 @@ func DestroyMutex(name string) error {
 	return destroyMutex(name)
 }
 
+// SetMutexPermissions changes the mode and the ownership of the mutex with the given name.
+// It uses the default implementation on the current platform.
+//	name - object name.
+//	perm - new permissions.
+func SetMutexPermissions(name string, perm ipcperm.Permissions) error {
+	return setMutexPermissions(name, perm)
+}
+
 func mutexSharedStateName(name, typ string) string {
 	return name + ".s" + typ
 }
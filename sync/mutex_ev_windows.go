@@ -3,12 +3,14 @@
 package sync
 
 import (
+	"context"
 	"os"
 	"time"
 
 	"bitbucket.org/avd/go-ipc/internal/allocator"
 	"bitbucket.org/avd/go-ipc/internal/common"
 	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 	"bitbucket.org/avd/go-ipc/mmf"
 	"bitbucket.org/avd/go-ipc/shm"
 
@@ -18,7 +20,8 @@ import (
 
 // all implementations must satisfy IPCLocker interface.
 var (
-	_          IPCLocker = (*EventMutex)(nil)
+	_          IPCLocker     = (*EventMutex)(nil)
+	_          ContextLocker = (*EventMutex)(nil)
 	timeoutErr           = common.NewTimeoutError("WaitForSingleObject")
 )
 
@@ -80,6 +83,12 @@ func (m *EventMutex) LockTimeout(timeout time.Duration) bool {
 	return m.lwm.lockTimeout(timeout)
 }
 
+// LockContext locks the mutex, waiting until it is locked, or the context is done.
+// It returns ctx.Err(), if the mutex was not locked.
+func (m *EventMutex) LockContext(ctx context.Context) error {
+	return waitContext(ctx, m.lwm.lockTimeout)
+}
+
 // Unlock releases the mutex. It panics on an error.
 func (m *EventMutex) Unlock() {
 	m.lwm.unlock()
@@ -97,6 +106,12 @@ func DestroyEventMutex(name string) error {
 	return shm.DestroyMemoryObject(mutexSharedStateName(name, "e"))
 }
 
+// SetEventMutexPermissions changes the mode and the ownership of the mutex's shared state.
+// Permissions of the event object are not changed.
+func SetEventMutexPermissions(name string, perm ipcperm.Permissions) error {
+	return shm.SetPermissions(mutexSharedStateName(name, "e"), perm)
+}
+
 type eventWaiter struct {
 	handle windows.Handle
 }
@@ -5,11 +5,13 @@
 package sync
 
 import (
+	"context"
 	"os"
 	"time"
 
 	"bitbucket.org/avd/go-ipc/internal/allocator"
 	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 	"bitbucket.org/avd/go-ipc/mmf"
 	"bitbucket.org/avd/go-ipc/shm"
 
@@ -19,6 +21,7 @@ import (
 // all implementations must satisfy at least IPCLocker interface.
 var (
 	_ TimedIPCLocker = (*FutexMutex)(nil)
+	_ ContextLocker  = (*FutexMutex)(nil)
 )
 
 // FutexMutex is a mutex based on linux/freebsd futex object.
@@ -70,6 +73,12 @@ func (f *FutexMutex) LockTimeout(timeout time.Duration) bool {
 	return f.lwm.lockTimeout(timeout)
 }
 
+// LockContext locks the mutex, waiting until it is locked, or the context is done.
+// It returns ctx.Err(), if the mutex was not locked.
+func (f *FutexMutex) LockContext(ctx context.Context) error {
+	return waitContext(ctx, f.lwm.lockTimeout)
+}
+
 // Unlock releases the mutex. It panics on an error, or if the mutex is not locked.
 func (f *FutexMutex) Unlock() {
 	f.lwm.unlock()
@@ -96,3 +105,11 @@ func DestroyFutexMutex(name string) error {
 	}
 	return nil
 }
+
+// SetFutexMutexPermissions changes the mode and the ownership of the mutex with the given name.
+func SetFutexMutexPermissions(name string, perm ipcperm.Permissions) error {
+	if err := shm.SetPermissions(mutexSharedStateName(name, "f"), perm); err != nil {
+		return errors.Wrap(err, "failed to set shared state permissions")
+	}
+	return nil
+}
@@ -4,7 +4,11 @@
 
 package sync
 
-import "os"
+import (
+	"os"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
+)
 
 // this is to ensure, that all implementations of ipc mutex satisfy the same minimal interface.
 var (
@@ -22,3 +26,7 @@ func newMutex(name string, flag int, perm os.FileMode) (TimedIPCLocker, error) {
 func destroyMutex(name string) error {
 	return DestroyFutexMutex(name)
 }
+
+func setMutexPermissions(name string, perm ipcperm.Permissions) error {
+	return SetFutexMutexPermissions(name, perm)
+}
@@ -2,7 +2,11 @@
 
 package sync
 
-import "os"
+import (
+	"os"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
+)
 
 // this is to ensure, that all implementations of ipc mutex satisfy the same minimal interface.
 var (
@@ -20,3 +24,7 @@ func newMutex(name string, flag int, perm os.FileMode) (TimedIPCLocker, error) {
 func destroyMutex(name string) error {
 	return DestroyEventMutex(name)
 }
+
+func setMutexPermissions(name string, perm ipcperm.Permissions) error {
+	return SetEventMutexPermissions(name, perm)
+}
@@ -0,0 +1,180 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package sync
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
+	"bitbucket.org/avd/go-ipc/mmf"
+	"bitbucket.org/avd/go-ipc/shm"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	piStateSize = 4
+)
+
+// all implementations must satisfy at least IPCLocker interface.
+var (
+	_ TimedIPCLocker = (*PIMutex)(nil)
+	_ ContextLocker  = (*PIMutex)(nil)
+)
+
+// PIMutex is a priority-inheritance mutex based on linux PI futexes.
+// If a high-priority thread waits for the mutex, the kernel boosts
+// the priority of the owner thread, so that the lock is released sooner.
+// PI ownership belongs to a thread, so the goroutine, which locked the mutex,
+// is wired to its OS thread until it unlocks the mutex.
+// The mutex must be unlocked by the same goroutine, which locked it,
+// Unlock panics, if it is called on another thread.
+// The mutex is not recursive: if a goroutine tries to lock it twice,
+// Lock panics, and TryLock and LockTimeout return false.
+type PIMutex struct {
+	ptr    unsafe.Pointer
+	region *mmf.MemoryRegion
+	name   string
+}
+
+// NewPIMutex creates a new priority-inheritance mutex.
+//	name - object name.
+//	flag - flag is a combination of open flags from 'os' package.
+//	perm - object's permission bits.
+func NewPIMutex(name string, flag int, perm os.FileMode) (*PIMutex, error) {
+	if err := ensureOpenFlags(flag); err != nil {
+		return nil, err
+	}
+	region, created, err := helper.CreateWritableRegion(mutexSharedStateName(name, "p"), flag, perm, piStateSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create shared state")
+	}
+	result := &PIMutex{
+		ptr:    allocator.ByteSliceData(region.Data()),
+		region: region,
+		name:   name,
+	}
+	if created {
+		atomic.StoreUint32(result.word(), 0)
+	}
+	return result, nil
+}
+
+// Lock locks the mutex. It panics on an error.
+func (m *PIMutex) Lock() {
+	if err := m.lock(-1); err != nil {
+		panic(err)
+	}
+}
+
+// TryLock makes one attempt to lock the mutex. It return true on succeess and false otherwise.
+func (m *PIMutex) TryLock() bool {
+	runtime.LockOSThread()
+	if atomic.CompareAndSwapUint32(m.word(), 0, uint32(unix.Gettid())) {
+		return true
+	}
+	err := FutexTryLockPI(m.ptr, 0)
+	if err == nil {
+		return true
+	}
+	runtime.UnlockOSThread()
+	if common.SyscallErrHasCode(err, unix.EWOULDBLOCK) || common.SyscallErrHasCode(err, unix.EDEADLK) {
+		return false
+	}
+	panic(err)
+}
+
+// LockTimeout tries to lock the locker, waiting for not more, than timeout.
+func (m *PIMutex) LockTimeout(timeout time.Duration) bool {
+	err := m.lock(timeout)
+	if err == nil {
+		return true
+	}
+	if common.IsTimeoutErr(err) || common.SyscallErrHasCode(err, unix.EDEADLK) {
+		return false
+	}
+	panic(err)
+}
+
+// LockContext locks the mutex, waiting until it is locked, or the context is done.
+// It returns ctx.Err(), if the mutex was not locked.
+func (m *PIMutex) LockContext(ctx context.Context) error {
+	return waitContext(ctx, m.LockTimeout)
+}
+
+// Unlock releases the mutex. It panics on an error, or if the mutex is not locked by the current thread.
+func (m *PIMutex) Unlock() {
+	tid := uint32(unix.Gettid())
+	value := atomic.LoadUint32(m.word())
+	if value&cFUTEX_TID_MASK != tid {
+		if value&cFUTEX_TID_MASK == 0 {
+			panic("unlock of unlocked mutex")
+		}
+		panic("unlock of a mutex, which is locked by another thread")
+	}
+	if !atomic.CompareAndSwapUint32(m.word(), tid, 0) {
+		// there are waiters, so the kernel must choose the next owner.
+		if err := FutexUnlockPI(m.ptr, 0); err != nil {
+			panic(err)
+		}
+	}
+	runtime.UnlockOSThread()
+}
+
+// Close indicates, that the object is no longer in use,
+// and that the underlying resources can be freed.
+func (m *PIMutex) Close() error {
+	return m.region.Close()
+}
+
+// Destroy removes the mutex object.
+func (m *PIMutex) Destroy() error {
+	if err := m.Close(); err != nil {
+		return errors.Wrap(err, "failed to close shm region")
+	}
+	return DestroyPIMutex(m.name)
+}
+
+// DestroyPIMutex permanently removes mutex with the given name.
+func DestroyPIMutex(name string) error {
+	if err := shm.DestroyMemoryObject(mutexSharedStateName(name, "p")); err != nil {
+		return errors.Wrap(err, "failed to destroy memory object")
+	}
+	return nil
+}
+
+// SetPIMutexPermissions changes the mode and the ownership of the mutex with the given name.
+func SetPIMutexPermissions(name string, perm ipcperm.Permissions) error {
+	if err := shm.SetPermissions(mutexSharedStateName(name, "p"), perm); err != nil {
+		return errors.Wrap(err, "failed to set shared state permissions")
+	}
+	return nil
+}
+
+// lock wires the goroutine to its thread and locks the mutex.
+// if the mutex was not locked, the goroutine is unwired.
+func (m *PIMutex) lock(timeout time.Duration) error {
+	runtime.LockOSThread()
+	if atomic.CompareAndSwapUint32(m.word(), 0, uint32(unix.Gettid())) {
+		return nil
+	}
+	if err := FutexLockPI(m.ptr, timeout, 0); err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	return nil
+}
+
+func (m *PIMutex) word() *uint32 {
+	return (*uint32)(m.ptr)
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package sync
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func piMutexCtor(name string, flag int, perm os.FileMode) (IPCLocker, error) {
+	return NewPIMutex(name, flag, perm)
+}
+
+func piMutexDtor(name string) error {
+	return DestroyPIMutex(name)
+}
+
+func TestPIMutexOpenMode(t *testing.T) {
+	testLockerOpenMode(t, piMutexCtor, piMutexDtor)
+}
+
+func TestPIMutexOpenMode2(t *testing.T) {
+	testLockerOpenMode2(t, piMutexCtor, piMutexDtor)
+}
+
+func TestPIMutexLock(t *testing.T) {
+	testLockerLock(t, piMutexCtor, piMutexDtor)
+}
+
+func TestPIMutexLockTimeout(t *testing.T) {
+	testLockerLockTimeout(t, "pi", piMutexCtor, piMutexDtor)
+}
+
+func TestPIMutexLockTimeout2(t *testing.T) {
+	testLockerLockTimeout2(t, "pi", piMutexCtor, piMutexDtor)
+}
+
+func TestPIMutexPanicsOnDoubleUnlock(t *testing.T) {
+	testLockerTwiceUnlock(t, piMutexCtor, piMutexDtor)
+}
+
+func TestPIMutexTryLock(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyPIMutex(testLockerName)) {
+		return
+	}
+	m, err := NewPIMutex(testLockerName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer m.Destroy()
+	a.True(m.TryLock())
+	a.False(m.TryLock())
+	ch := make(chan bool)
+	go func() {
+		ch <- m.TryLock()
+	}()
+	a.False(<-ch)
+	m.Unlock()
+	go func() {
+		locked := m.LockTimeout(time.Millisecond * 50)
+		if locked {
+			m.Unlock()
+		}
+		ch <- locked
+	}()
+	a.True(<-ch)
+}
+
+func TestPIMutexUnlockFromAnotherThread(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyPIMutex(testLockerName)) {
+		return
+	}
+	m, err := NewPIMutex(testLockerName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer m.Destroy()
+	m.Lock()
+	ch := make(chan struct{})
+	go func() {
+		a.Panics(func() {
+			m.Unlock()
+		})
+		close(ch)
+	}()
+	<-ch
+	a.NotPanics(func() {
+		m.Unlock()
+	})
+}
+
+func TestPIMutexLockContext(t *testing.T) {
+	testLockerLockContext(t, "pi", piMutexCtor, piMutexDtor)
+}
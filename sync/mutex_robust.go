@@ -0,0 +1,305 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux freebsd
+
+package sync
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
+	"bitbucket.org/avd/go-ipc/mmf"
+	"bitbucket.org/avd/go-ipc/shm"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	robustStateSize = int(unsafe.Sizeof(robustState{}))
+
+	// the layout of the futex word follows the one of linux robust futexes.
+	cFUTEX_TID_MASK = 0x3fffffff
+	cFUTEX_WAITERS  = 0x80000000
+
+	robustConsistent     = 0
+	robustInconsistent   = 1
+	robustNotRecoverable = 2
+
+	// waiters check, whether the owner is alive, with this interval.
+	robustCheckInterval = 100 * time.Millisecond
+)
+
+var (
+	// ErrOwnerDied is returned, when the mutex was acquired, but its previous owner died, holding it.
+	// The data, protected by the mutex, may be inconsistent.
+	// After restoring it, call MarkConsistent before unlocking the mutex.
+	ErrOwnerDied = errors.New("the owner of the mutex died, the state may be inconsistent")
+	// ErrNotRecoverable is returned, when the mutex was unlocked without being marked consistent
+	// after its owner had died. Such a mutex can't be locked anymore.
+	ErrNotRecoverable = errors.New("the mutex is not recoverable")
+)
+
+// all implementations must satisfy at least IPCLocker interface.
+var (
+	_ TimedIPCLocker = (*RobustMutex)(nil)
+	_ ContextLocker  = (*RobustMutex)(nil)
+)
+
+// robustState is the shared state of a robust mutex.
+// word is the pid of the owner with the waiters bit.
+// ownerStart is the start time of the owner, or 0, if it is unknown.
+// it is set after the word, and is reset before the word is released.
+type robustState struct {
+	word        uint32
+	consistency uint32
+	ownerStart  uint64
+}
+
+// RobustMutex is a futex-based mutex, which can be recovered, if its owner dies.
+// The futex word contains the pid of the owner process, so, if a process dies holding the mutex,
+// the next locker takes it over and is notified, that the protected data may be inconsistent.
+// As goroutines are not bound to threads, the owner is the process, and not a thread.
+// The death of the owner is not reported by the kernel, instead, the waiters check, whether it is alive,
+// every 100ms, so the mutex is taken over with this delay. Other limitations are:
+//	- on linux the owner is identified by its pid and start time, so the reuse of its pid is detected.
+//	On other platforms only the pid is used, and, if it has been reused, the mutex is not recovered,
+//	until the new process with this pid exits.
+//	- all the processes, using the mutex, must be in the same pid namespace.
+type RobustMutex struct {
+	state  *robustState
+	ww     *futex
+	region *mmf.MemoryRegion
+	name   string
+	pid    uint32
+	start  uint64
+}
+
+// NewRobustMutex creates a new robust futex-based mutex.
+//	name - object name.
+//	flag - flag is a combination of open flags from 'os' package.
+//	perm - object's permission bits.
+func NewRobustMutex(name string, flag int, perm os.FileMode) (*RobustMutex, error) {
+	if err := ensureOpenFlags(flag); err != nil {
+		return nil, err
+	}
+	region, created, err := helper.CreateWritableRegion(mutexSharedStateName(name, "r"), flag, perm, robustStateSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create shared state")
+	}
+	data := allocator.ByteSliceData(region.Data())
+	result := &RobustMutex{
+		state:  (*robustState)(data),
+		ww:     &futex{ptr: data},
+		region: region,
+		name:   name,
+		pid:    uint32(os.Getpid()),
+	}
+	result.start, _ = common.ProcessStartTime(os.Getpid())
+	if created {
+		*result.state = robustState{}
+	}
+	return result, nil
+}
+
+// LockRobust locks the mutex.
+// If the previous owner died holding the mutex, the mutex is locked, and ErrOwnerDied is returned.
+// If the mutex is not recoverable, ErrNotRecoverable is returned.
+func (m *RobustMutex) LockRobust() error {
+	return m.doLock(-1)
+}
+
+// LockRobustTimeout locks the mutex, waiting for not longer, than timeout.
+// It returns the same errors as LockRobust, or a timeout error, if the timeout expired.
+func (m *RobustMutex) LockRobustTimeout(timeout time.Duration) error {
+	return m.doLock(timeout)
+}
+
+// Lock locks the mutex. It panics on an error.
+// If the previous owner died holding the mutex, the mutex is marked consistent automatically.
+// Use LockRobust to handle this case.
+func (m *RobustMutex) Lock() {
+	if err := m.lock(-1); err != nil {
+		panic(err)
+	}
+}
+
+// TryLock makes one attempt to lock the mutex. It return true on succeess and false otherwise.
+// If the previous owner died holding the mutex, the mutex is marked consistent automatically.
+func (m *RobustMutex) TryLock() bool {
+	if atomic.LoadUint32(&m.state.consistency) == robustNotRecoverable {
+		return false
+	}
+	acquired, err := m.tryAcquire(0)
+	if err == ErrOwnerDied {
+		m.MarkConsistent()
+	}
+	return acquired
+}
+
+// LockTimeout tries to lock the locker, waiting for not more, than timeout.
+// If the previous owner died holding the mutex, the mutex is marked consistent automatically.
+func (m *RobustMutex) LockTimeout(timeout time.Duration) bool {
+	err := m.lock(timeout)
+	if err == nil {
+		return true
+	}
+	if common.IsTimeoutErr(err) {
+		return false
+	}
+	panic(err)
+}
+
+// LockContext locks the mutex, waiting until it is locked, or the context is done.
+// It returns ctx.Err(), if the mutex was not locked.
+// If the previous owner died holding the mutex, the mutex is marked consistent automatically.
+func (m *RobustMutex) LockContext(ctx context.Context) error {
+	return waitContext(ctx, m.LockTimeout)
+}
+
+// Unlock releases the mutex. It panics, if the mutex is not locked by the current process.
+// If the mutex was not marked consistent after its owner had died, it becomes not recoverable.
+func (m *RobustMutex) Unlock() {
+	if atomic.LoadUint32(&m.state.word)&cFUTEX_TID_MASK != m.pid {
+		panic("unlock of unlocked mutex")
+	}
+	wakeAll := atomic.CompareAndSwapUint32(&m.state.consistency, robustInconsistent, robustNotRecoverable)
+	atomic.StoreUint64(&m.state.ownerStart, 0)
+	old := atomic.SwapUint32(&m.state.word, 0)
+	if wakeAll {
+		m.ww.wakeAll()
+	} else if old&cFUTEX_WAITERS != 0 {
+		m.ww.wake(1)
+	}
+}
+
+// MarkConsistent marks the state, protected by the mutex, as consistent after its owner had died.
+// It must be called by the process, which holds the mutex.
+func (m *RobustMutex) MarkConsistent() error {
+	if atomic.LoadUint32(&m.state.word)&cFUTEX_TID_MASK != m.pid {
+		return errors.New("the mutex is not locked by the current process")
+	}
+	if !atomic.CompareAndSwapUint32(&m.state.consistency, robustInconsistent, robustConsistent) {
+		return errors.New("the mutex is not inconsistent")
+	}
+	return nil
+}
+
+// Close indicates, that the object is no longer in use,
+// and that the underlying resources can be freed.
+func (m *RobustMutex) Close() error {
+	return m.region.Close()
+}
+
+// Destroy removes the mutex object.
+func (m *RobustMutex) Destroy() error {
+	if err := m.Close(); err != nil {
+		return errors.Wrap(err, "failed to close shm region")
+	}
+	return DestroyRobustMutex(m.name)
+}
+
+// DestroyRobustMutex permanently removes mutex with the given name.
+func DestroyRobustMutex(name string) error {
+	if err := shm.DestroyMemoryObject(mutexSharedStateName(name, "r")); err != nil {
+		return errors.Wrap(err, "failed to destroy memory object")
+	}
+	return nil
+}
+
+// SetRobustMutexPermissions changes the mode and the ownership of the mutex with the given name.
+func SetRobustMutexPermissions(name string, perm ipcperm.Permissions) error {
+	if err := shm.SetPermissions(mutexSharedStateName(name, "r"), perm); err != nil {
+		return errors.Wrap(err, "failed to set shared state permissions")
+	}
+	return nil
+}
+
+// lock locks the mutex, marking it consistent, if the owner died.
+func (m *RobustMutex) lock(timeout time.Duration) error {
+	err := m.doLock(timeout)
+	if err == ErrOwnerDied {
+		return m.MarkConsistent()
+	}
+	return err
+}
+
+func (m *RobustMutex) doLock(timeout time.Duration) error {
+	var deadline time.Time
+	if timeout >= 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	// after we have slept, there may be other waiters, which were not woken,
+	// so the lock is taken with the waiters bit set, and the next unlock wakes one of them.
+	var waiters uint32
+	for {
+		if atomic.LoadUint32(&m.state.consistency) == robustNotRecoverable {
+			return ErrNotRecoverable
+		}
+		if acquired, err := m.tryAcquire(waiters); acquired {
+			return err
+		}
+		value := atomic.LoadUint32(&m.state.word)
+		if value&cFUTEX_TID_MASK == 0 {
+			continue
+		}
+		if value&cFUTEX_WAITERS == 0 {
+			if !atomic.CompareAndSwapUint32(&m.state.word, value, value|cFUTEX_WAITERS) {
+				continue
+			}
+			value |= cFUTEX_WAITERS
+		}
+		// the owner can die without waking us, so check it periodically.
+		wait := robustCheckInterval
+		if timeout >= 0 {
+			left := time.Until(deadline)
+			if left <= 0 {
+				return common.NewTimeoutError("FUTEX")
+			}
+			if left < wait {
+				wait = left
+			}
+		}
+		if err := m.ww.wait(int32(value), wait); err != nil && !common.IsTimeoutErr(err) {
+			return err
+		}
+		waiters = cFUTEX_WAITERS
+	}
+}
+
+// tryAcquire makes one attempt to lock the mutex. If its owner is dead, the mutex is taken over.
+// waiters is cFUTEX_WAITERS, if the waiters bit must be set for the new owner, or 0.
+func (m *RobustMutex) tryAcquire(waiters uint32) (bool, error) {
+	value := atomic.LoadUint32(&m.state.word)
+	owner := value & cFUTEX_TID_MASK
+	if owner == 0 {
+		if !atomic.CompareAndSwapUint32(&m.state.word, value, m.pid|value&cFUTEX_WAITERS|waiters) {
+			return false, nil
+		}
+		atomic.StoreUint64(&m.state.ownerStart, m.start)
+		return true, nil
+	}
+	if owner == m.pid {
+		return false, nil
+	}
+	start := atomic.LoadUint64(&m.state.ownerStart)
+	if atomic.LoadUint32(&m.state.word) != value || common.ProcessAlive(int(owner), start) {
+		return false, nil
+	}
+	// reset the start time of the dead owner first, so that no one compares it with the pid of the new owner.
+	if !atomic.CompareAndSwapUint64(&m.state.ownerStart, start, 0) {
+		return false, nil
+	}
+	if !atomic.CompareAndSwapUint32(&m.state.word, value, m.pid|value&cFUTEX_WAITERS|waiters) {
+		return false, nil
+	}
+	atomic.StoreUint64(&m.state.ownerStart, m.start)
+	atomic.StoreUint32(&m.state.consistency, robustInconsistent)
+	return true, ErrOwnerDied
+}
@@ -0,0 +1,197 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux freebsd
+
+package sync
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"bitbucket.org/avd/go-ipc/internal/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func robustMutexCtor(name string, flag int, perm os.FileMode) (IPCLocker, error) {
+	return NewRobustMutex(name, flag, perm)
+}
+
+func robustMutexDtor(name string) error {
+	return DestroyRobustMutex(name)
+}
+
+// deadPid returns a pid of a process, which has already exited.
+func deadPid(t *testing.T) uint32 {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return uint32(cmd.Process.Pid)
+}
+
+func TestRobustMutexOpenMode(t *testing.T) {
+	testLockerOpenMode(t, robustMutexCtor, robustMutexDtor)
+}
+
+func TestRobustMutexLock(t *testing.T) {
+	testLockerLock(t, robustMutexCtor, robustMutexDtor)
+}
+
+func TestRobustMutexLockTimeout(t *testing.T) {
+	testLockerLockTimeout(t, "robust", robustMutexCtor, robustMutexDtor)
+}
+
+func TestRobustMutexLockTimeout2(t *testing.T) {
+	testLockerLockTimeout2(t, "robust", robustMutexCtor, robustMutexDtor)
+}
+
+func TestRobustMutexPanicsOnDoubleUnlock(t *testing.T) {
+	testLockerTwiceUnlock(t, robustMutexCtor, robustMutexDtor)
+}
+
+func TestRobustMutexOwnerDied(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRobustMutex(testLockerName)) {
+		return
+	}
+	m, err := NewRobustMutex(testLockerName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer m.Destroy()
+	atomic.StoreUint32(&m.state.word, deadPid(t))
+	a.Equal(ErrOwnerDied, m.LockRobust())
+	a.NoError(m.MarkConsistent())
+	a.Error(m.MarkConsistent())
+	m.Unlock()
+	a.NoError(m.LockRobust())
+	m.Unlock()
+}
+
+func TestRobustMutexOwnerPidReused(t *testing.T) {
+	a := assert.New(t)
+	owner := os.Getppid()
+	start, ok := common.ProcessStartTime(owner)
+	if !ok {
+		t.Skip("process start time is not supported")
+	}
+	if !a.NoError(DestroyRobustMutex(testLockerName)) {
+		return
+	}
+	m, err := NewRobustMutex(testLockerName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer m.Destroy()
+	// the owner is alive.
+	atomic.StoreUint32(&m.state.word, uint32(owner))
+	atomic.StoreUint64(&m.state.ownerStart, start)
+	a.True(common.IsTimeoutErr(m.LockRobustTimeout(time.Millisecond * 50)))
+	// the owner has died, and its pid has been reused by another process.
+	atomic.StoreUint64(&m.state.ownerStart, start+1)
+	a.Equal(ErrOwnerDied, m.LockRobustTimeout(time.Second))
+	a.NoError(m.MarkConsistent())
+	m.Unlock()
+}
+
+func TestRobustMutexNotRecoverable(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRobustMutex(testLockerName)) {
+		return
+	}
+	m, err := NewRobustMutex(testLockerName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer m.Destroy()
+	atomic.StoreUint32(&m.state.word, deadPid(t))
+	a.Equal(ErrOwnerDied, m.LockRobust())
+	m.Unlock()
+	a.Equal(ErrNotRecoverable, m.LockRobust())
+	a.False(m.TryLock())
+}
+
+func TestRobustMutexWaiterRecovers(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRobustMutex(testLockerName)) {
+		return
+	}
+	m, err := NewRobustMutex(testLockerName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer m.Destroy()
+	m.Lock()
+	ch := make(chan error, 1)
+	go func() {
+		ch <- m.LockRobustTimeout(time.Second * 5)
+	}()
+	time.Sleep(time.Millisecond * 50)
+	// pretend, that the owner has died.
+	pid := deadPid(t)
+	for {
+		value := atomic.LoadUint32(&m.state.word)
+		if atomic.CompareAndSwapUint32(&m.state.word, value, value&cFUTEX_WAITERS|pid) {
+			break
+		}
+	}
+	select {
+	case err = <-ch:
+		a.Equal(ErrOwnerDied, err)
+		a.NoError(m.MarkConsistent())
+		m.Unlock()
+	case <-time.After(time.Second * 5):
+		t.Error("the waiter did not recover the mutex")
+	}
+}
+
+func TestRobustMutexLockContext(t *testing.T) {
+	testLockerLockContext(t, "robust", robustMutexCtor, robustMutexDtor)
+}
+
+func TestRobustMutexHandoff(t *testing.T) {
+	const (
+		lockers    = 4
+		iterations = 25
+		hold       = time.Millisecond
+	)
+	a := assert.New(t)
+	if !a.NoError(DestroyRobustMutex(testLockerName)) {
+		return
+	}
+	m, err := NewRobustMutex(testLockerName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer m.Destroy()
+	var wg sync.WaitGroup
+	// both are accessed under the mutex.
+	var unlocked time.Time
+	var maxHandoff time.Duration
+	for i := 0; i < lockers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				m.Lock()
+				if !unlocked.IsZero() {
+					if handoff := time.Since(unlocked); handoff > maxHandoff {
+						maxHandoff = handoff
+					}
+				}
+				time.Sleep(hold)
+				unlocked = time.Now()
+				m.Unlock()
+				time.Sleep(hold)
+			}
+		}()
+	}
+	wg.Wait()
+	// if a waiter was not woken, the mutex stays unlocked until it checks the owner.
+	a.True(maxHandoff < robustCheckInterval/4, "the longest handoff was %v", maxHandoff)
+}
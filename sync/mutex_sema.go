@@ -3,11 +3,13 @@
 package sync
 
 import (
+	"context"
 	"os"
 	"time"
 
 	"bitbucket.org/avd/go-ipc/internal/allocator"
 	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 	"bitbucket.org/avd/go-ipc/mmf"
 	"bitbucket.org/avd/go-ipc/shm"
 
@@ -16,22 +18,30 @@ import (
 
 // all implementations must satisfy IPCLocker interface.
 var (
-	_ IPCLocker = (*SemaMutex)(nil)
+	_ IPCLocker     = (*SemaMutex)(nil)
+	_ ContextLocker = (*SemaMutex)(nil)
 )
 
 // SemaMutex is a semaphore-based mutex for unix.
+// If it was opened with O_SEM_UNDO, the mutex is a binary semaphore,
+// which is unlocked by the kernel, if the process, holding it, exits.
+// In this mode the mutex must be unlocked by the process, which locked it,
+// and all the processes must open it with O_SEM_UNDO.
 type SemaMutex struct {
 	s      *Semaphore
 	region *mmf.MemoryRegion
 	name   string
 	lwm    *lwMutex
+	undo   bool
 }
 
 // NewSemaMutex creates a new semaphore-based mutex.
 //	name - object name.
-//	flag - flag is a combination of open flags from 'os' package.
+//	flag - flag is a combination of open flags from 'os' package along with O_SEM_UNDO.
 //	perm - object's permission bits.
 func NewSemaMutex(name string, flag int, perm os.FileMode) (*SemaMutex, error) {
+	undo := flag&O_SEM_UNDO != 0
+	flag &= ^O_SEM_UNDO
 	if err := ensureOpenFlags(flag); err != nil {
 		return nil, err
 	}
@@ -39,7 +49,11 @@ func NewSemaMutex(name string, flag int, perm os.FileMode) (*SemaMutex, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create shared state")
 	}
-	s, err := NewSemaphore(name, flag, perm, 1)
+	semaFlag := flag
+	if undo {
+		semaFlag |= O_SEM_UNDO
+	}
+	s, err := NewSemaphore(name, semaFlag, perm, 1)
 	if err != nil {
 		region.Close()
 		if created {
@@ -52,6 +66,7 @@ func NewSemaMutex(name string, flag int, perm os.FileMode) (*SemaMutex, error) {
 		region: region,
 		name:   name,
 		lwm:    newLightweightMutex(allocator.ByteSliceData(region.Data()), newSemaWaiter(s)),
+		undo:   undo,
 	}
 	if created {
 		result.lwm.init()
@@ -61,21 +76,48 @@ func NewSemaMutex(name string, flag int, perm os.FileMode) (*SemaMutex, error) {
 
 // Lock locks the mutex. It panics on an error.
 func (m *SemaMutex) Lock() {
+	if m.undo {
+		m.s.Wait()
+		return
+	}
 	m.lwm.lock()
 }
 
 // LockTimeout tries to lock the locker, waiting for not more, than timeout.
 func (m *SemaMutex) LockTimeout(timeout time.Duration) bool {
+	if m.undo {
+		return m.s.WaitTimeout(timeout)
+	}
 	return m.lwm.lockTimeout(timeout)
 }
 
+// LockContext locks the mutex, waiting until it is locked, or the context is done.
+// It returns ctx.Err(), if the mutex was not locked.
+func (m *SemaMutex) LockContext(ctx context.Context) error {
+	return waitContext(ctx, m.LockTimeout)
+}
+
 // TryLock makes one attempt to lock the mutex. It returns true on succeess and false otherwise.
 func (m *SemaMutex) TryLock() bool {
+	if m.undo {
+		return m.s.WaitTimeout(0)
+	}
 	return m.lwm.tryLock()
 }
 
 // Unlock releases the mutex. It panics on an error, or if the mutex is not locked.
 func (m *SemaMutex) Unlock() {
+	if m.undo {
+		value, err := (*semaphore)(m.s).value()
+		if err != nil {
+			panic(err)
+		}
+		if value > 0 {
+			panic("unlock of unlocked mutex")
+		}
+		m.s.Signal(1)
+		return
+	}
 	m.lwm.unlock()
 }
 
@@ -109,3 +151,11 @@ func DestroySemaMutex(name string) error {
 	}
 	return nil
 }
+
+// SetSemaMutexPermissions changes the mode and the ownership of the mutex with the given name.
+func SetSemaMutexPermissions(name string, perm ipcperm.Permissions) error {
+	if err := shm.SetPermissions(mutexSharedStateName(name, "s"), perm); err != nil {
+		return errors.Wrap(err, "failed to set shared state permissions")
+	}
+	return SetSemaphorePermissions(name, perm)
+}
@@ -3,12 +3,14 @@
 package sync
 
 import (
+	"context"
 	"os"
 	"runtime"
 	"time"
 
 	"bitbucket.org/avd/go-ipc/internal/allocator"
 	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 	"bitbucket.org/avd/go-ipc/mmf"
 	"bitbucket.org/avd/go-ipc/shm"
 
@@ -17,7 +19,8 @@ import (
 
 // all implementations must satisfy IPCLocker interface.
 var (
-	_ IPCLocker = (*SpinMutex)(nil)
+	_ IPCLocker     = (*SpinMutex)(nil)
+	_ ContextLocker = (*SpinMutex)(nil)
 )
 
 // SpinMutex is a synchronization object which performs busy wait loop.
@@ -72,6 +75,20 @@ func (spin *SpinMutex) LockTimeout(timeout time.Duration) bool {
 	return spin.lwm.lockTimeout(timeout)
 }
 
+// LockContext locks the mutex waiting in a busy loop, until it is locked, or the context is done.
+// It returns ctx.Err(), if the mutex was not locked.
+func (spin *SpinMutex) LockContext(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if spin.lwm.tryLock() {
+			return nil
+		}
+		runtime.Gosched()
+	}
+}
+
 // Unlock releases the mutex. It panics, if the mutex is not locked.
 func (spin *SpinMutex) Unlock() {
 	spin.lwm.unlock()
@@ -107,6 +124,11 @@ func DestroySpinMutex(name string) error {
 	return shm.DestroyMemoryObject(spinName(name))
 }
 
+// SetSpinMutexPermissions changes the mode and the ownership of the mutex with the given name.
+func SetSpinMutexPermissions(name string, perm ipcperm.Permissions) error {
+	return shm.SetPermissions(spinName(name), perm)
+}
+
 func spinName(name string) string {
 	return "go-ipc.spin." + name
 }
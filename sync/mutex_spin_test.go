@@ -50,3 +50,7 @@ func TestSpinMutexValueInc(t *testing.T) {
 func TestSpinMutexPanicsOnDoubleUnlock(t *testing.T) {
 	testLockerTwiceUnlock(t, spinCtor, spinDtor)
 }
+
+func TestSpinMutexLockContext(t *testing.T) {
+	testLockerLockContext(t, "spin", spinCtor, spinDtor)
+}
@@ -7,6 +7,8 @@ package sync
 import (
 	"os"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func sysvMutexCtor(name string, flag int, perm os.FileMode) (IPCLocker, error) {
@@ -60,3 +62,51 @@ func TestSysvMutexLockTimeout2(t *testing.T) {
 func TestSysvMutexPanicsOnDoubleUnlock(t *testing.T) {
 	testLockerTwiceUnlock(t, sysvMutexCtor, sysvMutexDtor)
 }
+
+func TestSysvMutexLockContext(t *testing.T) {
+	testLockerLockContext(t, "sysv", sysvMutexCtor, sysvMutexDtor)
+}
+
+func sysvUndoMutexCtor(name string, flag int, perm os.FileMode) (IPCLocker, error) {
+	return NewSemaMutex(name, flag|O_SEM_UNDO, perm)
+}
+
+func TestSysvUndoMutexOpenMode(t *testing.T) {
+	testLockerOpenMode(t, sysvUndoMutexCtor, sysvMutexDtor)
+}
+
+func TestSysvUndoMutexLock(t *testing.T) {
+	testLockerLock(t, sysvUndoMutexCtor, sysvMutexDtor)
+}
+
+func TestSysvUndoMutexLockTimeout(t *testing.T) {
+	testLockerLockTimeout(t, "msysv", sysvUndoMutexCtor, sysvMutexDtor)
+}
+
+func TestSysvUndoMutexPanicsOnDoubleUnlock(t *testing.T) {
+	testLockerTwiceUnlock(t, sysvUndoMutexCtor, sysvMutexDtor)
+}
+
+func TestSysvUndoMutexLockContext(t *testing.T) {
+	testLockerLockContext(t, "sysv", sysvUndoMutexCtor, sysvMutexDtor)
+}
+
+func TestSysvUndoMutexOwnerExit(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySemaMutex(testLockerName)) {
+		return
+	}
+	m, err := NewSemaMutex(testLockerName, os.O_CREATE|os.O_EXCL|O_SEM_UNDO, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(m.Destroy())
+	}()
+	if !a.NoError(runSemaUndoHelper("msysv")) {
+		return
+	}
+	if a.True(m.TryLock()) {
+		m.Unlock()
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux
+
+package sync
+
+import (
+	"os"
+	"testing"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/ipcperm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSemaphorePermissions(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySemaphore(testSemaName)) {
+		return
+	}
+	s, err := NewSemaphore(testSemaName, os.O_CREATE|os.O_EXCL, 0600, 0)
+	if !a.NoError(err) {
+		return
+	}
+	defer DestroySemaphore(testSemaName)
+	defer s.Close()
+	a.NoError(SetSemaphorePermissions(testSemaName, ipcperm.Exact(0666, os.Getuid(), os.Getgid())))
+	ctl := func(cmd int, ds unsafe.Pointer) error {
+		return semctlDs(s.id, cmd, ds)
+	}
+	mode, uid, gid, err := common.GetIpcPermissions(ctl)
+	if a.NoError(err) {
+		a.Equal(os.FileMode(0666), mode)
+		a.Equal(os.Getuid(), uid)
+		a.Equal(os.Getgid(), gid)
+	}
+	fi, err := os.Stat(common.TmpFilename(testSemaName))
+	if a.NoError(err) {
+		a.Equal(os.FileMode(0666), fi.Mode().Perm())
+	}
+}
+
+func TestMutexPermissions(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyMutex(testLockerName)) {
+		return
+	}
+	m, err := NewMutex(testLockerName, os.O_CREATE|os.O_EXCL, 0600)
+	if !a.NoError(err) {
+		return
+	}
+	defer DestroyMutex(testLockerName)
+	defer m.Close()
+	a.NoError(SetMutexPermissions(testLockerName, ipcperm.Mode(0660)))
+	a.Error(SetMutexPermissions(testLockerName+"-nonexistent", ipcperm.Mode(0660)))
+}
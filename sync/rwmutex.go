@@ -3,22 +3,41 @@
 package sync
 
 import (
+	"context"
 	"os"
+	"time"
 
 	"bitbucket.org/avd/go-ipc/internal/allocator"
 	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 	"bitbucket.org/avd/go-ipc/mmf"
 	"bitbucket.org/avd/go-ipc/shm"
 
 	"github.com/pkg/errors"
 )
 
+const (
+	// O_READER_PREFERENCE is a flag for NewRWMutex, which makes new readers join active readers,
+	// even if there are waiting writers. Writers may starve under constant reads.
+	// Its value was chosen simply not to intersect with the flags from 'os' package.
+	O_READER_PREFERENCE = 0x08000000
+	// O_WRITER_PREFERENCE is a flag for NewRWMutex, which makes waiting writers go before waiting readers.
+	// Readers may starve under constant writes.
+	O_WRITER_PREFERENCE = 0x10000000
+)
+
 // all implementations must satisfy at least IPCLocker interface.
 var (
-	_ IPCLocker = (*RWMutex)(nil)
+	_ TimedIPCLocker = (*RWMutex)(nil)
+	_ ContextLocker  = (*RWMutex)(nil)
 )
 
 // RWMutex is a mutex, that can be held by any number of readers or one writer.
+// By default it uses phase-fair policy: new readers wait, if there is a waiting writer,
+// and the readers, which were waiting for a writer, go before the next writer.
+// Other policies can be chosen with O_READER_PREFERENCE and O_WRITER_PREFERENCE flags.
+// The policy is stored in the shared state, so the processes, which open an existing mutex, use it as well.
+// The mutexes, created by the earlier versions of the package, have no policy in their state, and are phase-fair.
 type RWMutex struct {
 	lwm    *lwRWMutex
 	region *mmf.MemoryRegion
@@ -28,13 +47,21 @@ type RWMutex struct {
 
 // NewRWMutex returns new RWMutex
 //	name - object name.
-//	flag - flag is a combination of open flags from 'os' package.
+//	flag - flag is a combination of open flags from 'os' package
+//		along with O_READER_PREFERENCE or O_WRITER_PREFERENCE, which are used, if the mutex was created.
 //	perm - object's permission bits.
 func NewRWMutex(name string, flag int, perm os.FileMode) (*RWMutex, error) {
+	policy, err := rwPolicyFromFlag(flag)
+	if err != nil {
+		return nil, err
+	}
+	flag &= ^(O_READER_PREFERENCE | O_WRITER_PREFERENCE)
 	if err := ensureOpenFlags(flag); err != nil {
 		return nil, err
 	}
-	region, created, err := helper.CreateWritableRegion(mutexSharedStateName(name, "rw"), flag, perm, lwRWMStateSize)
+	// the mutexes, created by the earlier versions, have a smaller state without the policy.
+	// they are opened as well, and use the phase-fair policy.
+	region, created, err := helper.CreateWritableRegionMinSize(mutexSharedStateName(name, "rw"), flag, perm, lwRWMStateSize, lwRWMLegacyStateSize)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create shared state")
 	}
@@ -46,9 +73,9 @@ func NewRWMutex(name string, flag int, perm os.FileMode) (*RWMutex, error) {
 		}
 		return nil, err
 	}
-	result.lwm = newRWLightweightMutex(allocator.ByteSliceData(region.Data()), result.wR, result.wW)
+	result.lwm = newRWLightweightMutex(allocator.ByteSliceData(region.Data()), region.Size(), result.wR, result.wW)
 	if created {
-		result.lwm.init()
+		result.lwm.init(policy)
 	}
 	return result, nil
 }
@@ -58,6 +85,24 @@ func (rw *RWMutex) Lock() {
 	rw.lwm.lock()
 }
 
+// TryLock makes one attempt to lock the mutex exclusively. It returns true on succeess and false otherwise.
+func (rw *RWMutex) TryLock() bool {
+	return rw.lwm.tryLock()
+}
+
+// LockTimeout tries to lock the mutex exclusively, waiting for not more, than timeout.
+// If the timeout expires, the writer is removed from the waiting queue, and the readers,
+// which were waiting for it, can proceed.
+func (rw *RWMutex) LockTimeout(timeout time.Duration) bool {
+	return rw.lwm.lockTimeout(timeout)
+}
+
+// LockContext locks the mutex exclusively, waiting until it is locked, or the context is done.
+// It returns ctx.Err(), if the mutex was not locked.
+func (rw *RWMutex) LockContext(ctx context.Context) error {
+	return rw.lwm.lockContext(ctx)
+}
+
 // Unlock releases the mutex. It panics on an error, or if the mutex is not locked.
 func (rw *RWMutex) Unlock() {
 	rw.lwm.unlock()
@@ -68,6 +113,22 @@ func (rw *RWMutex) RLock() {
 	rw.lwm.rlock()
 }
 
+// TryRLock makes one attempt to lock the mutex for reading. It returns true on succeess and false otherwise.
+func (rw *RWMutex) TryRLock() bool {
+	return rw.lwm.tryRLock()
+}
+
+// RLockTimeout tries to lock the mutex for reading, waiting for not more, than timeout.
+func (rw *RWMutex) RLockTimeout(timeout time.Duration) bool {
+	return rw.lwm.rlockTimeout(timeout)
+}
+
+// RLockContext locks the mutex for reading, waiting until it is locked, or the context is done.
+// It returns ctx.Err(), if the mutex was not locked.
+func (rw *RWMutex) RLockContext(ctx context.Context) error {
+	return rw.lwm.rlockContext(ctx)
+}
+
 // RUnlock desceases the number of mutex's readers. If it becomes 0, writers (if any) can proceed.
 // It panics on an error, or if the mutex is not locked.
 func (rw *RWMutex) RUnlock() {
@@ -107,17 +168,47 @@ func DestroyRWMutex(name string) error {
 	return nil
 }
 
+// SetRWMutexPermissions changes the mode and the ownership of the mutex with the given name.
+func SetRWMutexPermissions(name string, perm ipcperm.Permissions) error {
+	if err := shm.SetPermissions(mutexSharedStateName(name, "rw"), perm); err != nil {
+		return errors.Wrap(err, "failed to set shared state permissions")
+	}
+	if err := SetSemaphorePermissions(name+".rs", perm); err != nil {
+		return errors.Wrap(err, "failed to set r/sema permissions")
+	}
+	if err := SetSemaphorePermissions(name+".ws", perm); err != nil {
+		return errors.Wrap(err, "failed to set w/sema permissions")
+	}
+	return nil
+}
+
 // RLocker returns a Locker interface that implements
 // the Lock and Unlock methods by calling rw.RLock and rw.RUnlock.
+// It also implements TimedIPCLocker and ContextLocker.
 func (rw *RWMutex) RLocker() IPCLocker {
 	return (*rlocker)(rw)
 }
 
 type rlocker RWMutex
 
-func (r *rlocker) Lock()        { (*RWMutex)(r).RLock() }
-func (r *rlocker) Unlock()      { (*RWMutex)(r).RUnlock() }
-func (r *rlocker) Close() error { return (*RWMutex)(r).Close() }
+func (r *rlocker) Lock()                                  { (*RWMutex)(r).RLock() }
+func (r *rlocker) LockTimeout(timeout time.Duration) bool { return (*RWMutex)(r).RLockTimeout(timeout) }
+func (r *rlocker) LockContext(ctx context.Context) error  { return (*RWMutex)(r).RLockContext(ctx) }
+func (r *rlocker) Unlock()                                { (*RWMutex)(r).RUnlock() }
+func (r *rlocker) Close() error                           { return (*RWMutex)(r).Close() }
+
+func rwPolicyFromFlag(flag int) (int32, error) {
+	switch flag & (O_READER_PREFERENCE | O_WRITER_PREFERENCE) {
+	case 0:
+		return lwRWMPhaseFair, nil
+	case O_READER_PREFERENCE:
+		return lwRWMReaderPreference, nil
+	case O_WRITER_PREFERENCE:
+		return lwRWMWriterPreference, nil
+	default:
+		return 0, errors.New("only one of O_READER_PREFERENCE and O_WRITER_PREFERENCE can be used")
+	}
+}
 
 func makeRWMWaiters(name string, flag int, perm os.FileMode) (waitWaker, waitWaker, error) {
 	rSema, err := NewSemaphore(name+".rs", flag, perm, 0)
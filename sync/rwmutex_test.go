@@ -3,11 +3,25 @@
 package sync
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
+	"os/exec"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/shm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	rwPolicyTestOps = 200
 )
 
 func rwMutexCtor(name string, flag int, perm os.FileMode) (IPCLocker, error) {
@@ -70,6 +84,517 @@ func TestRWMutexPanicsOnDoubleRUnlock(t *testing.T) {
 	testLockerTwiceUnlock(t, rwRMutexCtor, rwMutexDtor)
 }
 
+func TestRWMutexLockTimeout(t *testing.T) {
+	testLockerLockTimeout(t, "rw", rwMutexCtor, rwMutexDtor)
+}
+
+func TestRWMutexLockTimeout2(t *testing.T) {
+	testLockerLockTimeout2(t, "rw", rwMutexCtor, rwMutexDtor)
+}
+
+func TestRWMutexTryLock(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRWMutex(testLockerName)) {
+		return
+	}
+	rw, err := NewRWMutex(testLockerName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(rw.Destroy())
+	}()
+	a.True(rw.TryRLock())
+	a.True(rw.TryRLock())
+	a.False(rw.TryLock())
+	rw.RUnlock()
+	rw.RUnlock()
+	a.True(rw.TryLock())
+	a.False(rw.TryLock())
+	a.False(rw.TryRLock())
+	rw.Unlock()
+	a.True(rw.TryRLock())
+	rw.RUnlock()
+}
+
+func TestRWMutexRLockTimeout(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRWMutex(testLockerName)) {
+		return
+	}
+	rw, err := NewRWMutex(testLockerName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(rw.Destroy())
+	}()
+	rw.Lock()
+	a.False(rw.RLockTimeout(time.Millisecond * 50))
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		rw.Unlock()
+	}()
+	a.True(rw.RLockTimeout(time.Second))
+	a.True(rw.RLockTimeout(0))
+	rw.RUnlock()
+	rw.RUnlock()
+	a.True(rw.TryLock())
+	rw.Unlock()
+}
+
+func TestRWMutexTimedOutWriterDoesNotBlockReaders(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRWMutex(testLockerName)) {
+		return
+	}
+	rw, err := NewRWMutex(testLockerName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(rw.Destroy())
+	}()
+	rw.RLock()
+	ch := make(chan bool, 1)
+	go func() {
+		// this reader waits for the pending writer.
+		time.Sleep(time.Millisecond * 10)
+		locked := rw.RLockTimeout(time.Second)
+		if locked {
+			rw.RUnlock()
+		}
+		ch <- locked
+	}()
+	a.False(rw.LockTimeout(time.Millisecond * 50))
+	a.True(<-ch)
+	// new readers must not wait for the writer, which has gone.
+	a.True(rw.TryRLock())
+	rw.RUnlock()
+	rw.RUnlock()
+	a.True(rw.TryLock())
+	rw.Unlock()
+}
+
+func TestRWMutexLockContext(t *testing.T) {
+	testLockerLockContext(t, "rw", rwMutexCtor, rwMutexDtor)
+}
+
+func TestRWMutexRLockContext(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRWMutex(testLockerName)) {
+		return
+	}
+	rw, err := NewRWMutex(testLockerName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(rw.Destroy())
+	}()
+	rw.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	a.Equal(context.DeadlineExceeded, rw.RLockContext(ctx))
+	rw.Unlock()
+	// the canceled reader must not stay in the state.
+	a.NoError(rw.LockContext(context.Background()))
+	rw.Unlock()
+	a.NoError(rw.RLockContext(context.Background()))
+	rw.RUnlock()
+}
+
+func TestRWMutexCanceledWriterDoesNotBlockReaders(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRWMutex(testLockerName)) {
+		return
+	}
+	rw, err := NewRWMutex(testLockerName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(rw.Destroy())
+	}()
+	rw.RLock()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*50, cancel)
+	ch := make(chan error, 1)
+	go func() {
+		// this reader waits for the pending writer.
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		time.Sleep(time.Millisecond * 10)
+		err := rw.RLockContext(ctx)
+		if err == nil {
+			rw.RUnlock()
+		}
+		ch <- err
+	}()
+	a.Equal(context.Canceled, rw.LockContext(ctx))
+	a.NoError(<-ch)
+	rw.RUnlock()
+	a.NoError(rw.LockContext(context.Background()))
+	rw.Unlock()
+}
+
+func TestRWMutexContextStress(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRWMutex(testLockerName)) {
+		return
+	}
+	rw, err := NewRWMutex(testLockerName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(rw.Destroy())
+	}()
+	var readers, writers int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for j := 0; j < 300; j++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(rnd.Intn(1000))*time.Microsecond)
+				if rnd.Intn(2) == 0 {
+					if rw.LockContext(ctx) == nil {
+						if atomic.AddInt32(&writers, 1) != 1 || atomic.LoadInt32(&readers) != 0 {
+							t.Error("writer is not exclusive")
+						}
+						time.Sleep(time.Duration(rnd.Intn(200)) * time.Microsecond)
+						atomic.AddInt32(&writers, -1)
+						rw.Unlock()
+					}
+				} else {
+					if rw.RLockContext(ctx) == nil {
+						atomic.AddInt32(&readers, 1)
+						if atomic.LoadInt32(&writers) != 0 {
+							t.Error("reader and writer hold the mutex")
+						}
+						time.Sleep(time.Duration(rnd.Intn(200)) * time.Microsecond)
+						atomic.AddInt32(&readers, -1)
+						rw.RUnlock()
+					}
+				}
+				cancel()
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+	a.Equal(int64(0), *rw.lwm.state)
+}
+
+// TestRWMutexPolicyHelper is not a real test. It is run in a child process by testRWMutexPolicyMultiProcess.
+// It locks the mutex for reading or writing and checks, that writers are exclusive.
+// Readers and writers ("r" and "w") make rwPolicyTestOps operations, while the load processes
+// ("R" and "W") keep doing them, until the stop flag is set. All of them count the operations.
+func TestRWMutexPolicyHelper(t *testing.T) {
+	var role string
+	var policy int32
+	if _, err := fmt.Sscanf(os.Getenv(testHelperEnv), "rwpolicy %s %d", &role, &policy); err != nil {
+		return
+	}
+	rw, err := NewRWMutex(testLockerName, 0, 0666)
+	if err != nil {
+		os.Exit(1)
+	}
+	// the policy must be taken from the shared state.
+	if atomic.LoadInt32(rw.lwm.policy) != policy {
+		os.Exit(2)
+	}
+	region, _, err := helper.CreateWritableRegion(testMemObj, 0, 0666, 24)
+	if err != nil {
+		os.Exit(1)
+	}
+	data := (*int64)(allocator.ByteSliceData(region.Data()))
+	stop := (*int64)(allocator.AdvancePointer(allocator.ByteSliceData(region.Data()), 8))
+	ops := (*int64)(allocator.AdvancePointer(allocator.ByteSliceData(region.Data()), 16))
+	load := role == "R" || role == "W"
+	done := func(i int) bool {
+		if load {
+			return atomic.LoadInt64(stop) != 0
+		}
+		return i == rwPolicyTestOps
+	}
+	for i := 0; !done(i); i++ {
+		if role == "w" || role == "W" {
+			rw.Lock()
+			value := atomic.LoadInt64(data)
+			if value%2 != 0 {
+				os.Exit(3)
+			}
+			atomic.StoreInt64(data, value+1)
+			time.Sleep(time.Microsecond * 20)
+			atomic.StoreInt64(data, value+2)
+			rw.Unlock()
+		} else {
+			rw.RLock()
+			if atomic.LoadInt64(data)%2 != 0 {
+				os.Exit(3)
+			}
+			time.Sleep(time.Microsecond * 20)
+			if atomic.LoadInt64(data)%2 != 0 {
+				os.Exit(3)
+			}
+			rw.RUnlock()
+		}
+		atomic.AddInt64(ops, 1)
+	}
+	os.Exit(0)
+}
+
+// testRWMutexPolicyMultiProcess checks, that the processes of one role make their operations in bounded time,
+// while the processes of the other role ("R" for readers, "W" for writers) keep the mutex under continuous load.
+func testRWMutexPolicyMultiProcess(t *testing.T, flag int, policy int32, load string) {
+	const (
+		processes = 2
+	)
+	a := assert.New(t)
+	if !a.NoError(DestroyRWMutex(testLockerName)) {
+		return
+	}
+	rw, err := NewRWMutex(testLockerName, os.O_CREATE|os.O_EXCL|flag, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(rw.Destroy())
+	}()
+	shm.DestroyMemoryObject(testMemObj)
+	region, _, err := helper.CreateWritableRegion(testMemObj, os.O_CREATE|os.O_EXCL, 0666, 24)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(region.Close())
+		a.NoError(shm.DestroyMemoryObject(testMemObj))
+	}()
+	data := (*int64)(allocator.ByteSliceData(region.Data()))
+	stop := (*int64)(allocator.AdvancePointer(allocator.ByteSliceData(region.Data()), 8))
+	ops := (*int64)(allocator.AdvancePointer(allocator.ByteSliceData(region.Data()), 16))
+	role := "r"
+	if load == "R" {
+		role = "w"
+	}
+	start := func(role string) chan error {
+		done := make(chan error, processes)
+		for i := 0; i < processes; i++ {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestRWMutexPolicyHelper$")
+			cmd.Env = append(os.Environ(), fmt.Sprintf("%s=rwpolicy %s %d", testHelperEnv, role, policy))
+			if err := cmd.Start(); err != nil {
+				done <- err
+				continue
+			}
+			go func() {
+				done <- cmd.Wait()
+			}()
+		}
+		return done
+	}
+	// the load processes exit, when the stop flag is set, so they must be stopped on any result.
+	loadDone := start(load)
+	defer func() {
+		atomic.StoreInt64(stop, 1)
+		for i := 0; i < processes; i++ {
+			a.NoError(<-loadDone)
+		}
+	}()
+	// let the load processes take the mutex first.
+	if !a.True(waitForValue(ops, 10, time.Second*5)) {
+		return
+	}
+	// the processes of the other role must finish, while the load continues.
+	done := start(role)
+	timeout := time.After(time.Second * 30)
+	for i := 0; i < processes; i++ {
+		select {
+		case err = <-done:
+			a.NoError(err)
+		case <-timeout:
+			atomic.StoreInt64(stop, 1)
+			t.Fatal("starvation detected")
+		}
+	}
+	if load == "R" {
+		a.Equal(int64(processes*rwPolicyTestOps*2), atomic.LoadInt64(data))
+	}
+}
+
+// waitForValue waits, until the value is at least min.
+func waitForValue(value *int64, min int64, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadInt64(value) < min {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
+func TestRWMutexPhaseFairMultiProcess(t *testing.T) {
+	// neither readers, nor writers starve.
+	testRWMutexPolicyMultiProcess(t, 0, lwRWMPhaseFair, "R")
+	testRWMutexPolicyMultiProcess(t, 0, lwRWMPhaseFair, "W")
+}
+
+func TestRWMutexReaderPreferenceMultiProcess(t *testing.T) {
+	// readers do not starve under continuous writes.
+	testRWMutexPolicyMultiProcess(t, O_READER_PREFERENCE, lwRWMReaderPreference, "W")
+}
+
+func TestRWMutexWriterPreferenceMultiProcess(t *testing.T) {
+	// writers do not starve under continuous reads.
+	testRWMutexPolicyMultiProcess(t, O_WRITER_PREFERENCE, lwRWMWriterPreference, "R")
+}
+
+func TestRWMutexPolicyFlags(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRWMutex(testLockerName)) {
+		return
+	}
+	_, err := NewRWMutex(testLockerName, os.O_CREATE|O_READER_PREFERENCE|O_WRITER_PREFERENCE, 0666)
+	a.Error(err)
+	rw, err := NewRWMutex(testLockerName, os.O_CREATE|os.O_EXCL|O_WRITER_PREFERENCE, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(rw.Destroy())
+	}()
+	// the policy of an existing mutex does not change.
+	rw2, err := NewRWMutex(testLockerName, O_READER_PREFERENCE, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(lwRWMWriterPreference, atomic.LoadInt32(rw2.lwm.policy))
+	a.NoError(rw2.Close())
+}
+
+func TestRWMutexLegacyState(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRWMutex(testLockerName)) {
+		return
+	}
+	// the state of a mutex, created by an earlier version, has no policy.
+	region, _, err := helper.CreateWritableRegion(mutexSharedStateName(testLockerName, "rw"), os.O_CREATE|os.O_EXCL, 0666, lwRWMLegacyStateSize)
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(region.Close())
+	rw, err := NewRWMutex(testLockerName, os.O_CREATE|O_WRITER_PREFERENCE, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(rw.Destroy())
+	}()
+	a.Equal(lwRWMLegacyStateSize, rw.region.Size())
+	a.Equal(lwRWMPhaseFair, atomic.LoadInt32(rw.lwm.policy))
+	rw.Lock()
+	a.False(rw.TryRLock())
+	rw.Unlock()
+	rw.RLock()
+	a.False(rw.TryLock())
+	rw.RUnlock()
+}
+
+// testRWMutexPendingWriter checks, whether a new reader can join an active reader, while a writer is waiting.
+func testRWMutexPendingWriter(t *testing.T, flag int, readerEnters bool) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRWMutex(testLockerName)) {
+		return
+	}
+	rw, err := NewRWMutex(testLockerName, os.O_CREATE|os.O_EXCL|flag, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(rw.Destroy())
+	}()
+	rw.RLock()
+	locked := make(chan struct{})
+	go func() {
+		rw.Lock()
+		close(locked)
+		rw.Unlock()
+	}()
+	for (lwRWState)(atomic.LoadInt64(rw.lwm.state)).writers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if a.Equal(readerEnters, rw.TryRLock()) && readerEnters {
+		rw.RUnlock()
+	}
+	rw.RUnlock()
+	<-locked
+}
+
+// testRWMutexWriterUnlock checks, who goes first after a writer unlocks the mutex,
+// when both a reader and a writer are waiting.
+func testRWMutexWriterUnlock(t *testing.T, flag int, writerFirst bool) {
+	a := assert.New(t)
+	if !a.NoError(DestroyRWMutex(testLockerName)) {
+		return
+	}
+	rw, err := NewRWMutex(testLockerName, os.O_CREATE|os.O_EXCL|flag, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(rw.Destroy())
+	}()
+	rw.Lock()
+	order := make(chan string, 2)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		rw.RLock()
+		order <- "r"
+		time.Sleep(time.Millisecond * 20)
+		rw.RUnlock()
+	}()
+	go func() {
+		defer wg.Done()
+		rw.Lock()
+		order <- "w"
+		time.Sleep(time.Millisecond * 20)
+		rw.Unlock()
+	}()
+	for {
+		state := (lwRWState)(atomic.LoadInt64(rw.lwm.state))
+		if state.waitingReaders() == 1 && state.writers() == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	rw.Unlock()
+	wg.Wait()
+	first := "r"
+	if writerFirst {
+		first = "w"
+	}
+	a.Equal(first, <-order)
+}
+
+func TestRWMutexPhaseFairPolicy(t *testing.T) {
+	testRWMutexPendingWriter(t, 0, false)
+	testRWMutexWriterUnlock(t, 0, false)
+}
+
+func TestRWMutexReaderPreferencePolicy(t *testing.T) {
+	testRWMutexPendingWriter(t, O_READER_PREFERENCE, true)
+	testRWMutexWriterUnlock(t, O_READER_PREFERENCE, false)
+}
+
+func TestRWMutexWriterPreferencePolicy(t *testing.T) {
+	testRWMutexPendingWriter(t, O_WRITER_PREFERENCE, false)
+	testRWMutexWriterUnlock(t, O_WRITER_PREFERENCE, true)
+}
+
 func ExampleRWMutex() {
 	const (
 		writers = 4
@@ -32,8 +32,22 @@ func semget(k common.Key, nsems, semflg int) (int, error) {
 	return int(id), nil
 }
 
-func semctl(id, num, cmd int) error {
-	_, _, err := unix.Syscall(sysSemCtl, uintptr(id), uintptr(num), uintptr(cmd))
+func semctl(id, num, cmd int) (int, error) {
+	result, _, err := unix.Syscall(sysSemCtl, uintptr(id), uintptr(num), uintptr(cmd))
+	if err != syscall.Errno(0) {
+		return 0, os.NewSyscallError("SEMCTL", err)
+	}
+	return int(result), nil
+}
+
+// semctlDs calls semctl with a pointer to semid_ds.
+func semctlDs(id, cmd int, ds unsafe.Pointer) error {
+	arg := uintptr(ds)
+	if semunByPointer {
+		arg = uintptr(unsafe.Pointer(&ds))
+	}
+	_, _, err := unix.Syscall6(sysSemCtl, uintptr(id), 0, uintptr(cmd), arg, 0, 0)
+	allocator.Use(ds)
 	if err != syscall.Errno(0) {
 		return os.NewSyscallError("SEMCTL", err)
 	}
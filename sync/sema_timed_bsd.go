@@ -56,11 +56,11 @@ func (ti *threadInterrupter) done() {
 	atomic.StoreInt32(&ti.state, 1)
 }
 
-func doSemaTimedWait(id int, timeout time.Duration) bool {
+func doSemaTimedWait(id int, timeout time.Duration, flags int16) bool {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 	ti := threadInterrupter{}
-	b := sembuf{semnum: 0, semop: int16(-1), semflg: 0}
+	b := sembuf{semnum: 0, semop: int16(-1), semflg: flags}
 	if err := ti.start(timeout); err != nil {
 		panic(errors.Wrap(err, "failed to setup timeout"))
 	}
@@ -8,9 +8,9 @@ import (
 	"bitbucket.org/avd/go-ipc/internal/common"
 )
 
-func doSemaTimedWait(id int, timeout time.Duration) bool {
+func doSemaTimedWait(id int, timeout time.Duration, flags int16) bool {
 	err := common.UninterruptedSyscallTimeout(func(curTimeout time.Duration) error {
-		b := sembuf{semnum: 0, semop: int16(-1), semflg: 0}
+		b := sembuf{semnum: 0, semop: int16(-1), semflg: flags}
 		return semtimedop(id, []sembuf{b}, common.TimeoutToTimeSpec(curTimeout))
 	}, timeout)
 	if err == nil {
@@ -7,9 +7,12 @@ package sync
 import (
 	"os"
 	"time"
+	"unsafe"
 
 	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -24,8 +27,9 @@ type sembuf struct {
 
 // semaphore is a sysV semaphore.
 type semaphore struct {
-	name string
-	id   int
+	name  string
+	id    int
+	flags int16
 }
 
 // newSemaphore creates a new sysV semaphore with the given name.
@@ -66,6 +70,10 @@ func newSemaphoreKey(key uint64, flag int, perm os.FileMode, initial int) (*sema
 			return nil, errors.Wrap(err, "failed to add initial semaphore value")
 		}
 	}
+	// the initial value must not be undone, when the creator exits.
+	if flag&O_SEM_UNDO != 0 {
+		result.flags = cSemUndo
+	}
 	return result, nil
 }
 
@@ -86,7 +94,42 @@ func (s *semaphore) waitTimeout(timeout time.Duration) bool {
 		s.wait()
 		return true
 	}
-	return doSemaTimedWait(s.id, timeout)
+	if timeout == 0 {
+		return s.tryWait()
+	}
+	return doSemaTimedWait(s.id, timeout, s.flags)
+}
+
+func (s *semaphore) tryWait() bool {
+	b := sembuf{semnum: 0, semop: -1, semflg: s.flags | common.IpcNoWait}
+	err := common.UninterruptedSyscall(func() error { return semop(s.id, []sembuf{b}) })
+	if err == nil {
+		return true
+	}
+	if common.SyscallErrHasCode(err, unix.EAGAIN) {
+		return false
+	}
+	panic(err)
+}
+
+func (s *semaphore) value() (int, error) {
+	return semctl(s.id, 0, cGETVAL)
+}
+
+func (s *semaphore) waiters() (int, int, error) {
+	ncnt, err := semctl(s.id, 0, cGETNCNT)
+	if err != nil {
+		return 0, 0, err
+	}
+	zcnt, err := semctl(s.id, 0, cGETZCNT)
+	if err != nil {
+		return 0, 0, err
+	}
+	return ncnt, zcnt, nil
+}
+
+func (s *semaphore) lastPID() (int, error) {
+	return semctl(s.id, 0, cGETPID)
 }
 
 func (s *semaphore) close() error {
@@ -98,7 +141,7 @@ func (s *semaphore) Destroy() error {
 }
 
 func (s *semaphore) add(value int) error {
-	return common.UninterruptedSyscall(func() error { return semAdd(s.id, value) })
+	return common.UninterruptedSyscall(func() error { return semAdd(s.id, value, s.flags) })
 }
 
 // destroySemaphore permanently removes semaphore with the given name.
@@ -117,8 +160,24 @@ func destroySemaphore(name string) error {
 	return removeSysVSemaByID(id, name)
 }
 
+func setSemaphorePermissions(name string, perm ipcperm.Permissions) error {
+	k, err := common.KeyForName(name)
+	if err != nil {
+		return errors.Wrap(err, "failed to get a key for the name")
+	}
+	id, err := semget(k, 1, 0)
+	if err != nil {
+		return errors.Wrap(err, "failed to get semaphore id")
+	}
+	ctl := func(cmd int, ds unsafe.Pointer) error {
+		return semctlDs(id, cmd, ds)
+	}
+	uid, gid := perm.IDs()
+	return common.SetIpcPermissions(name, ctl, perm.Mode, uid, gid)
+}
+
 func removeSysVSemaByID(id int, name string) error {
-	err := semctl(id, 0, common.IpcRmid)
+	_, err := semctl(id, 0, common.IpcRmid)
 	if err == nil && len(name) > 0 {
 		if err = os.Remove(common.TmpFilename(name)); os.IsNotExist(err) {
 			err = nil
@@ -133,7 +192,7 @@ func removeSysVSemaByID(id int, name string) error {
 	return err
 }
 
-func semAdd(id, value int) error {
-	b := sembuf{semnum: 0, semop: int16(value), semflg: 0}
+func semAdd(id, value int, flags int16) error {
+	b := sembuf{semnum: 0, semop: int16(value), semflg: flags}
 	return semop(id, []sembuf{b})
 }
@@ -9,6 +9,8 @@ import (
 	"github.com/pkg/errors"
 
 	"golang.org/x/sys/windows"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
 )
 
 // semaphore is a platform specific semaphore implementation.
@@ -18,6 +20,9 @@ type semaphore struct {
 }
 
 func newSemaphore(name string, flag int, perm os.FileMode, initial int) (*semaphore, error) {
+	if flag&O_SEM_UNDO != 0 {
+		return nil, errors.New("O_SEM_UNDO is not supported on windows")
+	}
 	if err := ensureOpenFlags(flag); err != nil {
 		return nil, err
 	}
@@ -65,7 +70,17 @@ func (s *semaphore) waitTimeout(timeout time.Duration) bool {
 	}
 }
 
+// value is not supported, as windows does not provide a way to get the value of a semaphore.
+func (s *semaphore) value() (int, error) {
+	return 0, errors.New("not supported on windows")
+}
+
 // destroySemaphore is a no-op on windows.
 func destroySemaphore(name string) error {
 	return nil
 }
+
+// setSemaphorePermissions is a no-op on windows.
+func setSemaphorePermissions(name string, perm ipcperm.Permissions) error {
+	return nil
+}
@@ -3,16 +3,26 @@
 package sync
 
 import (
+	"context"
 	"os"
 	"time"
 
 	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/ipcperm"
 )
 
 const (
 	// CSemMaxVal is the maximum semaphore value,
 	// which is guaranteed to be supported on all platforms.
 	CSemMaxVal = 32767
+
+	// O_SEM_UNDO is a flag for NewSemaphore and NewSemaMutex.
+	// All the operations on such semaphore are undone by the kernel, when the process exits,
+	// so that the permits, taken by a crashed process, are returned back.
+	// It is applied to the operations of the current process only.
+	// Its value was chosen simply not to intersect with the flags from 'os' package.
+	// It is not supported on windows.
+	O_SEM_UNDO = 0x40000000
 )
 
 // Semaphore is a synchronization object with a resource counter,
@@ -24,9 +34,10 @@ type Semaphore semaphore
 
 // NewSemaphore creates new semaphore with the given name.
 //	name - object name.
-//	flag - flag is a combination of open flags from 'os' package.
+//	flag - flag is a combination of open flags from 'os' package along with O_SEM_UNDO.
 //	perm - object's permission bits.
 //	initial - this value will be added to the semaphore's value, if it was created.
+//		it is not undone, when the creator exits.
 func NewSemaphore(name string, flag int, perm os.FileMode, initial int) (*Semaphore, error) {
 	result, err := newSemaphore(name, flag, perm, initial)
 	if err != nil {
@@ -57,11 +68,24 @@ func (s *Semaphore) WaitTimeout(timeout time.Duration) bool {
 	return (*semaphore)(s).waitTimeout(timeout)
 }
 
+// WaitContext decrements the value of semaphore variable by 1.
+// If the value becomes negative, it waits until the context is done.
+// It returns ctx.Err(), if the value was not decremented.
+func (s *Semaphore) WaitContext(ctx context.Context) error {
+	return waitContext(ctx, s.WaitTimeout)
+}
+
 // DestroySemaphore removes the semaphore permanently.
 func DestroySemaphore(name string) error {
 	return destroySemaphore(name)
 }
 
+// SetSemaphorePermissions changes the mode and the ownership of the semaphore with the given name.
+// On windows it is a no-op.
+func SetSemaphorePermissions(name string, perm ipcperm.Permissions) error {
+	return setSemaphorePermissions(name, perm)
+}
+
 type semaWaiter struct {
 	s *Semaphore
 }
@@ -0,0 +1,213 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux freebsd
+
+package sync
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/common"
+	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
+	"bitbucket.org/avd/go-ipc/mmf"
+	"bitbucket.org/avd/go-ipc/shm"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	futexSemaStateSize = int(unsafe.Sizeof(futexSemaState{}))
+)
+
+// futexSemaState is the shared state of a futex semaphore.
+// seq is a futex word, which is changed on every signal, if there are waiters.
+type futexSemaState struct {
+	value   int64
+	waiters int32
+	seq     int32
+}
+
+// FutexSemaphore is a counting semaphore based on linux/freebsd futex object.
+// Unlike Semaphore, which is a System V semaphore, it does not make a syscall,
+// if the value is large enough, and supports 64-bit counts.
+type FutexSemaphore struct {
+	state  *futexSemaState
+	ftx    *futex
+	region *mmf.MemoryRegion
+	name   string
+}
+
+// NewFutexSemaphore creates new futex-based semaphore with the given name.
+//	name - object name.
+//	flag - flag is a combination of open flags from 'os' package.
+//	perm - object's permission bits.
+//	initial - initial value of the semaphore, if it was created. must not be negative.
+func NewFutexSemaphore(name string, flag int, perm os.FileMode, initial int64) (*FutexSemaphore, error) {
+	if err := ensureOpenFlags(flag); err != nil {
+		return nil, err
+	}
+	if initial < 0 {
+		return nil, errors.New("initial value must not be negative")
+	}
+	region, created, err := helper.CreateWritableRegion(futexSemaName(name), flag, perm, futexSemaStateSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create shared state")
+	}
+	state := (*futexSemaState)(allocator.ByteSliceData(region.Data()))
+	result := &FutexSemaphore{
+		state:  state,
+		ftx:    &futex{ptr: unsafe.Pointer(&state.seq)},
+		region: region,
+		name:   name,
+	}
+	if created {
+		*state = futexSemaState{value: initial}
+	}
+	return result, nil
+}
+
+// Signal increments the value of the semaphore by count, waking waiting processes (if any).
+func (s *FutexSemaphore) Signal(count int) {
+	s.SignalN(int64(count))
+}
+
+// SignalN increments the value of the semaphore by n, waking waiting processes (if any).
+// It panics, if n is negative.
+func (s *FutexSemaphore) SignalN(n int64) {
+	if n < 0 {
+		panic("negative semaphore increment")
+	}
+	atomic.AddInt64(&s.state.value, n)
+	if atomic.LoadInt32(&s.state.waiters) > 0 {
+		atomic.AddInt32(&s.state.seq, 1)
+		// waiters may wait for different amounts, so all of them must recheck the value.
+		if _, err := s.ftx.wakeAll(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Wait decrements the value of the semaphore by 1, waiting, while the value is 0.
+func (s *FutexSemaphore) Wait() {
+	s.WaitNTimeout(1, -1)
+}
+
+// WaitTimeout decrements the value of the semaphore by 1.
+// If the value is 0, it waits for not longer than timeout.
+func (s *FutexSemaphore) WaitTimeout(timeout time.Duration) bool {
+	return s.WaitNTimeout(1, timeout)
+}
+
+// WaitContext decrements the value of the semaphore by 1.
+// If the value is 0, it waits until the context is done.
+// It returns ctx.Err(), if the value was not decremented.
+func (s *FutexSemaphore) WaitContext(ctx context.Context) error {
+	return waitContext(ctx, s.WaitTimeout)
+}
+
+// TryWait decrements the value of the semaphore by 1, if it is positive.
+// It returns true on success.
+func (s *FutexSemaphore) TryWait() bool {
+	return s.tryWaitN(1)
+}
+
+// WaitN decrements the value of the semaphore by n, waiting, while the value is less than n.
+func (s *FutexSemaphore) WaitN(n int64) {
+	s.WaitNTimeout(n, -1)
+}
+
+// WaitNTimeout decrements the value of the semaphore by n.
+// If the value is less than n, it waits for not longer than timeout.
+// It panics, if n is not positive.
+func (s *FutexSemaphore) WaitNTimeout(n int64, timeout time.Duration) bool {
+	if n <= 0 {
+		panic("semaphore decrement must be positive")
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		if s.tryWaitN(n) {
+			return true
+		}
+		if timeout == 0 {
+			return false
+		}
+		atomic.AddInt32(&s.state.waiters, 1)
+		seq := atomic.LoadInt32(&s.state.seq)
+		// the value could have been changed before we became a waiter.
+		if atomic.LoadInt64(&s.state.value) >= n {
+			atomic.AddInt32(&s.state.waiters, -1)
+			continue
+		}
+		wait := timeout
+		if timeout > 0 {
+			if wait = time.Until(deadline); wait <= 0 {
+				atomic.AddInt32(&s.state.waiters, -1)
+				return false
+			}
+		}
+		err := s.ftx.wait(seq, wait)
+		atomic.AddInt32(&s.state.waiters, -1)
+		if err != nil && !common.IsTimeoutErr(err) {
+			panic(err)
+		}
+	}
+}
+
+// Value returns current value of the semaphore.
+func (s *FutexSemaphore) Value() int64 {
+	return atomic.LoadInt64(&s.state.value)
+}
+
+// Close closes the semaphore.
+func (s *FutexSemaphore) Close() error {
+	return s.region.Close()
+}
+
+// Destroy closes the semaphore and removes it permanently.
+func (s *FutexSemaphore) Destroy() error {
+	if err := s.Close(); err != nil {
+		return errors.Wrap(err, "failed to close shm region")
+	}
+	return DestroyFutexSemaphore(s.name)
+}
+
+// DestroyFutexSemaphore permanently removes semaphore with the given name.
+func DestroyFutexSemaphore(name string) error {
+	if err := shm.DestroyMemoryObject(futexSemaName(name)); err != nil {
+		return errors.Wrap(err, "failed to destroy memory object")
+	}
+	return nil
+}
+
+// SetFutexSemaphorePermissions changes the mode and the ownership of the semaphore with the given name.
+func SetFutexSemaphorePermissions(name string, perm ipcperm.Permissions) error {
+	if err := shm.SetPermissions(futexSemaName(name), perm); err != nil {
+		return errors.Wrap(err, "failed to set shared state permissions")
+	}
+	return nil
+}
+
+func (s *FutexSemaphore) tryWaitN(n int64) bool {
+	for {
+		value := atomic.LoadInt64(&s.state.value)
+		if value < n {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&s.state.value, value, value-n) {
+			return true
+		}
+	}
+}
+
+func futexSemaName(name string) string {
+	return name + ".fsema"
+}
@@ -0,0 +1,142 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build linux freebsd
+
+package sync
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testFutexSemaName = "ipcfsema"
+)
+
+func TestFutexSemaOpenMode(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyFutexSemaphore(testFutexSemaName)) {
+		return
+	}
+	_, err := NewFutexSemaphore(testFutexSemaName, 0, 0666, 0)
+	a.Error(err)
+	_, err = NewFutexSemaphore(testFutexSemaName, os.O_CREATE, 0666, -1)
+	a.Error(err)
+	s, err := NewFutexSemaphore(testFutexSemaName, os.O_CREATE|os.O_EXCL, 0666, 1)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(s.Destroy())
+	}()
+	_, err = NewFutexSemaphore(testFutexSemaName, os.O_CREATE|os.O_EXCL, 0666, 1)
+	a.Error(err)
+	s2, err := NewFutexSemaphore(testFutexSemaName, os.O_CREATE, 0666, 10)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(int64(1), s2.Value())
+	a.NoError(s2.Close())
+}
+
+func TestFutexSemaCount(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyFutexSemaphore(testFutexSemaName)) {
+		return
+	}
+	s, err := NewFutexSemaphore(testFutexSemaName, os.O_CREATE|os.O_EXCL, 0666, 3)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(s.Destroy())
+	}()
+	for i := 0; i < 3; i++ {
+		a.True(s.TryWait())
+	}
+	a.False(s.TryWait())
+	a.False(s.WaitTimeout(time.Millisecond * 50))
+	const big = int64(1) << 40
+	s.SignalN(big)
+	a.Equal(big, s.Value())
+	a.False(s.WaitNTimeout(big+1, 0))
+	s.WaitN(big - 1)
+	a.Equal(int64(1), s.Value())
+	s.Wait()
+	a.Equal(int64(0), s.Value())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	a.Equal(context.DeadlineExceeded, s.WaitContext(ctx))
+	a.Panics(func() {
+		s.WaitN(0)
+	})
+	a.Panics(func() {
+		s.SignalN(-1)
+	})
+}
+
+func TestFutexSemaWaitN(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyFutexSemaphore(testFutexSemaName)) {
+		return
+	}
+	s, err := NewFutexSemaphore(testFutexSemaName, os.O_CREATE|os.O_EXCL, 0666, 0)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(s.Destroy())
+	}()
+	ch := make(chan bool, 2)
+	go func() {
+		ch <- s.WaitNTimeout(5, time.Second)
+	}()
+	go func() {
+		ch <- s.WaitNTimeout(1, time.Second)
+	}()
+	time.Sleep(time.Millisecond * 50)
+	// the waiter for 5 must not prevent the waiter for 1 from proceeding.
+	s.Signal(1)
+	a.True(<-ch)
+	s.Signal(5)
+	a.True(<-ch)
+	a.Equal(int64(0), s.Value())
+}
+
+func TestFutexSemaProducerConsumer(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyFutexSemaphore(testFutexSemaName)) {
+		return
+	}
+	s, err := NewFutexSemaphore(testFutexSemaName, os.O_CREATE|os.O_EXCL, 0666, 0)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(s.Destroy())
+	}()
+	const routines, iters = 8, 10000
+	var wg sync.WaitGroup
+	for i := 0; i < routines; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iters; j++ {
+				s.Signal(1)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iters; j++ {
+				s.Wait()
+			}
+		}()
+	}
+	wg.Wait()
+	a.Equal(int64(0), s.Value())
+}
@@ -3,6 +3,7 @@
 package sync
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -203,6 +204,32 @@ func TestTimedSema(t *testing.T) {
 	a.False(s.WaitTimeout(time.Millisecond * 50))
 }
 
+func TestSemaWaitContext(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySemaphore(testSemaName)) {
+		return
+	}
+	s, err := NewSemaphore(testSemaName, os.O_CREATE|os.O_EXCL, 0666, 1)
+	if !a.NoError(err) {
+		return
+	}
+	defer func(s *Semaphore) {
+		a.NoError(s.Close())
+		a.NoError(DestroySemaphore(testSemaName))
+	}(s)
+	a.NoError(s.WaitContext(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	a.Equal(context.DeadlineExceeded, s.WaitContext(ctx))
+	time.AfterFunc(time.Millisecond*50, func() {
+		s.Signal(1)
+	})
+	a.NoError(s.WaitContext(context.Background()))
+	// the canceled wait must not have consumed the value.
+	s.Signal(1)
+	a.True(s.WaitTimeout(0))
+}
+
 func TestSemaSignalAnotherProcess(t *testing.T) {
 	a := assert.New(t)
 	if !a.NoError(DestroySemaphore(testSemaName)) {
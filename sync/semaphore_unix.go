@@ -0,0 +1,36 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build darwin freebsd linux
+
+package sync
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Value returns current value of the semaphore.
+func (s *Semaphore) Value() (int, error) {
+	result, err := (*semaphore)(s).value()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get semaphore value")
+	}
+	return result, nil
+}
+
+// WaitersCount returns the number of processes, waiting for the semaphore's value to increase (ncnt),
+// and the number of processes, waiting for it to become zero (zcnt).
+func (s *Semaphore) WaitersCount() (ncnt, zcnt int, err error) {
+	if ncnt, zcnt, err = (*semaphore)(s).waiters(); err != nil {
+		return 0, 0, errors.Wrap(err, "failed to get semaphore waiters count")
+	}
+	return ncnt, zcnt, nil
+}
+
+// LastPID returns the pid of the process, which performed the last operation on the semaphore.
+func (s *Semaphore) LastPID() (int, error) {
+	result, err := (*semaphore)(s).lastPID()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get semaphore last pid")
+	}
+	return result, nil
+}
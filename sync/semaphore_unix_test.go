@@ -0,0 +1,153 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build darwin freebsd linux
+
+package sync
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	semaHelperEnv = "GO_IPC_SEMA_HELPER"
+)
+
+// TestSemaUndoHelper is not a real test. It is run in a child process by runSemaUndoHelper.
+// It opens an object with O_SEM_UNDO, takes a permit and exits without returning it.
+func TestSemaUndoHelper(t *testing.T) {
+	typ := os.Getenv(semaHelperEnv)
+	if len(typ) == 0 {
+		return
+	}
+	switch typ {
+	case "sema":
+		s, err := NewSemaphore(testSemaName, O_SEM_UNDO, 0666, 0)
+		if err != nil {
+			os.Exit(1)
+		}
+		s.Wait()
+	case "msysv":
+		m, err := NewSemaMutex(testLockerName, O_SEM_UNDO, 0666)
+		if err != nil {
+			os.Exit(1)
+		}
+		m.Lock()
+	default:
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+func runSemaUndoHelper(typ string) error {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSemaUndoHelper$")
+	cmd.Env = append(os.Environ(), semaHelperEnv+"="+typ)
+	return cmd.Run()
+}
+
+func TestSemaValue(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySemaphore(testSemaName)) {
+		return
+	}
+	s, err := NewSemaphore(testSemaName, os.O_CREATE|os.O_EXCL, 0666, 2)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(s.Close())
+		a.NoError(DestroySemaphore(testSemaName))
+	}()
+	value, err := s.Value()
+	a.NoError(err)
+	a.Equal(2, value)
+	s.Wait()
+	value, err = s.Value()
+	a.NoError(err)
+	a.Equal(1, value)
+	pid, err := s.LastPID()
+	a.NoError(err)
+	a.Equal(os.Getpid(), pid)
+}
+
+func TestSemaWaitersCount(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySemaphore(testSemaName)) {
+		return
+	}
+	s, err := NewSemaphore(testSemaName, os.O_CREATE|os.O_EXCL, 0666, 0)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(s.Close())
+		a.NoError(DestroySemaphore(testSemaName))
+	}()
+	ncnt, zcnt, err := s.WaitersCount()
+	a.NoError(err)
+	a.Equal(0, ncnt)
+	a.Equal(0, zcnt)
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+	deadline := time.Now().Add(time.Second * 5)
+	for ncnt == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+		ncnt, _, err = s.WaitersCount()
+		a.NoError(err)
+	}
+	a.Equal(1, ncnt)
+	s.Signal(1)
+	<-done
+	ncnt, _, err = s.WaitersCount()
+	a.NoError(err)
+	a.Equal(0, ncnt)
+}
+
+func TestSemaUndo(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySemaphore(testSemaName)) {
+		return
+	}
+	s, err := NewSemaphore(testSemaName, os.O_CREATE|os.O_EXCL, 0666, 1)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(s.Close())
+		a.NoError(DestroySemaphore(testSemaName))
+	}()
+	if !a.NoError(runSemaUndoHelper("sema")) {
+		return
+	}
+	value, err := s.Value()
+	a.NoError(err)
+	a.Equal(1, value)
+}
+
+func TestSemaUndoTryWait(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySemaphore(testSemaName)) {
+		return
+	}
+	s, err := NewSemaphore(testSemaName, os.O_CREATE|os.O_EXCL|O_SEM_UNDO, 0666, 1)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(s.Close())
+		a.NoError(DestroySemaphore(testSemaName))
+	}()
+	a.True(s.WaitTimeout(0))
+	a.False(s.WaitTimeout(0))
+	s.Signal(1)
+	value, err := s.Value()
+	a.NoError(err)
+	a.Equal(1, value)
+}
@@ -0,0 +1,225 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package sync
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"runtime"
+	"sync/atomic"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
+	"bitbucket.org/avd/go-ipc/mmf"
+	"bitbucket.org/avd/go-ipc/shm"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	seqLockStateSize = 4
+	seqLockSpinCount = 100
+)
+
+// SeqLock is a sequence lock for one writer and many readers.
+// Readers do not modify the shared state, so they don't contend with each other.
+// Instead, they retry reading, if the writer has changed the data meanwhile.
+// SeqLock doesn't serialize writers, if there are several of them,
+// they must be synchronized by other means.
+// If the writer dies between WriteBegin and WriteEnd, the write never finishes,
+// and Read and ReadObject never return. Use ReadContext and ReadObjectContext to limit the wait.
+type SeqLock struct {
+	seq    *uint32
+	region *mmf.MemoryRegion
+	name   string
+}
+
+// NewSeqLock creates a new sequence lock.
+//	name - object name.
+//	flag - flag is a combination of open flags from 'os' package.
+//	perm - object's permission bits.
+func NewSeqLock(name string, flag int, perm os.FileMode) (*SeqLock, error) {
+	if err := ensureOpenFlags(flag); err != nil {
+		return nil, err
+	}
+	region, created, err := helper.CreateWritableRegion(seqLockName(name), flag, perm, seqLockStateSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create shared state")
+	}
+	result := &SeqLock{
+		seq:    (*uint32)(allocator.ByteSliceData(region.Data())),
+		region: region,
+		name:   name,
+	}
+	if created {
+		*result.seq = 0
+	}
+	return result, nil
+}
+
+// WriteBegin starts modification of the protected data.
+// It panics, if another write is in progress.
+func (sl *SeqLock) WriteBegin() {
+	seq := atomic.LoadUint32(sl.seq)
+	if seq&1 != 0 || !atomic.CompareAndSwapUint32(sl.seq, seq, seq+1) {
+		panic("seqlock: concurrent writers")
+	}
+}
+
+// WriteEnd finishes modification of the protected data.
+// It panics, if there was no matching WriteBegin.
+func (sl *SeqLock) WriteEnd() {
+	seq := atomic.LoadUint32(sl.seq)
+	if seq&1 == 0 || !atomic.CompareAndSwapUint32(sl.seq, seq, seq+1) {
+		panic("seqlock: WriteEnd without WriteBegin")
+	}
+}
+
+// Read calls f until it runs without a concurrent write.
+// f can observe inconsistent data, so it must not act upon it,
+// it should only copy the data, which is used after Read returns.
+func (sl *SeqLock) Read(f func()) {
+	sl.read(nil, f)
+}
+
+// ReadContext works like Read, but it also returns, when the context is done,
+// while a write is in progress. It returns ctx.Err() in this case.
+func (sl *SeqLock) ReadContext(ctx context.Context, f func()) error {
+	if !sl.read(ctx.Done(), f) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// ReadObject consistently copies a fixed-layout object from the region at the given offset.
+// object must be a pointer to a value, or a slice, which do not contain any references.
+func (sl *SeqLock) ReadObject(region *mmf.MemoryRegion, offset int, object interface{}) error {
+	_, err := sl.readObject(nil, region, offset, object)
+	return err
+}
+
+// ReadObjectContext works like ReadObject, but it also returns, when the context is done,
+// while a write is in progress. It returns ctx.Err() in this case.
+func (sl *SeqLock) ReadObjectContext(ctx context.Context, region *mmf.MemoryRegion, offset int, object interface{}) error {
+	ok, err := sl.readObject(ctx.Done(), region, offset, object)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// WriteObject copies a fixed-layout object into the region at the given offset,
+// so that readers never see a partially written object.
+// object must be a pointer to a value, or a slice, which do not contain any references.
+func (sl *SeqLock) WriteObject(region *mmf.MemoryRegion, offset int, object interface{}) error {
+	data, err := objectDataInRegion(region, offset, object)
+	if err != nil {
+		return err
+	}
+	sl.WriteBegin()
+	copy(region.Data()[offset:], data)
+	sl.WriteEnd()
+	mmf.UseMemoryRegion(region)
+	return nil
+}
+
+// Close closes shared state of the seqlock.
+func (sl *SeqLock) Close() error {
+	return sl.region.Close()
+}
+
+// Destroy closes the seqlock and removes it permanently.
+func (sl *SeqLock) Destroy() error {
+	if err := sl.Close(); err != nil {
+		return errors.Wrap(err, "failed to close shm region")
+	}
+	return DestroySeqLock(sl.name)
+}
+
+// DestroySeqLock permanently removes seqlock with the given name.
+func DestroySeqLock(name string) error {
+	if err := shm.DestroyMemoryObject(seqLockName(name)); err != nil {
+		return errors.Wrap(err, "failed to destroy memory object")
+	}
+	return nil
+}
+
+// SetSeqLockPermissions changes the mode and the ownership of the seqlock with the given name.
+func SetSeqLockPermissions(name string, perm ipcperm.Permissions) error {
+	return shm.SetPermissions(seqLockName(name), perm)
+}
+
+// read calls f until it runs without a concurrent write.
+// it returns false, if done was closed, while a write was in progress. a nil done is never closed.
+func (sl *SeqLock) read(done <-chan struct{}, f func()) bool {
+	for {
+		seq, ok := sl.readBegin(done)
+		if !ok {
+			return false
+		}
+		f()
+		if atomic.LoadUint32(sl.seq) == seq {
+			return true
+		}
+	}
+}
+
+// readObject copies an object from the region. it returns false, if done was closed, while a write was in progress.
+func (sl *SeqLock) readObject(done <-chan struct{}, region *mmf.MemoryRegion, offset int, object interface{}) (bool, error) {
+	data, err := objectDataInRegion(region, offset, object)
+	if err != nil {
+		return false, err
+	}
+	ok := sl.read(done, func() {
+		copy(data, region.Data()[offset:])
+	})
+	mmf.UseMemoryRegion(region)
+	return ok, nil
+}
+
+// readBegin waits until there is no write in progress and returns the sequence number.
+// it returns false, if done was closed before that.
+func (sl *SeqLock) readBegin(done <-chan struct{}) (uint32, bool) {
+	for i := 0; ; i++ {
+		if seq := atomic.LoadUint32(sl.seq); seq&1 == 0 {
+			return seq, true
+		}
+		if i >= seqLockSpinCount {
+			select {
+			case <-done:
+				return 0, false
+			default:
+			}
+			runtime.Gosched()
+		}
+	}
+}
+
+func objectDataInRegion(region *mmf.MemoryRegion, offset int, object interface{}) ([]byte, error) {
+	if !allocator.IsReferenceType(object) {
+		return nil, errors.New("object must be a pointer or a slice")
+	}
+	if err := allocator.CheckObjectReferences(object); err != nil {
+		return nil, errors.Wrap(err, "invalid object type")
+	}
+	if reflect.ValueOf(object).IsNil() {
+		return nil, errors.New("nil object")
+	}
+	data, err := allocator.ObjectData(object)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get object data")
+	}
+	if offset < 0 || offset+len(data) > region.Size() {
+		return nil, errors.New("object is out of region bounds")
+	}
+	return data, nil
+}
+
+func seqLockName(name string) string {
+	return name + ".sq"
+}
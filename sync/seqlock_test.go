@@ -0,0 +1,200 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package sync
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/mmf"
+	"bitbucket.org/avd/go-ipc/shm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testSeqLockName = "testseqlock"
+)
+
+type seqLockTestData struct {
+	Version int64
+	Values  [16]int64
+	Sum     int64
+}
+
+func TestSeqLockOpenMode(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySeqLock(testSeqLockName)) {
+		return
+	}
+	_, err := NewSeqLock(testSeqLockName, os.O_RDWR, 0666)
+	a.Error(err)
+	_, err = NewSeqLock(testSeqLockName, 0, 0666)
+	a.Error(err)
+	sl, err := NewSeqLock(testSeqLockName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(sl.Destroy())
+	}()
+	_, err = NewSeqLock(testSeqLockName, os.O_CREATE|os.O_EXCL, 0666)
+	a.Error(err)
+	sl2, err := NewSeqLock(testSeqLockName, 0, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(sl2.Close())
+}
+
+func TestSeqLockWritePanics(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySeqLock(testSeqLockName)) {
+		return
+	}
+	sl, err := NewSeqLock(testSeqLockName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(sl.Destroy())
+	}()
+	a.Panics(sl.WriteEnd)
+	sl.WriteBegin()
+	a.Panics(sl.WriteBegin)
+}
+
+func TestSeqLockObjectChecks(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySeqLock(testSeqLockName)) {
+		return
+	}
+	sl, err := NewSeqLock(testSeqLockName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(sl.Destroy())
+	}()
+	a.NoError(shm.DestroyMemoryObject(testMemObj))
+	region, err := createMemoryRegionSimple(os.O_CREATE|os.O_RDWR, mmf.MEM_READWRITE, 256, 0)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(region.Close())
+		a.NoError(shm.DestroyMemoryObject(testMemObj))
+	}()
+	var data seqLockTestData
+	a.NoError(sl.ReadObject(region, 0, &data))
+	a.NoError(sl.ReadObject(region, 256-int(unsafe.Sizeof(data)), &data))
+	a.Error(sl.ReadObject(region, 257-int(unsafe.Sizeof(data)), &data))
+	a.Error(sl.ReadObject(region, -1, &data))
+	a.Error(sl.ReadObject(region, 0, data))
+	a.Error(sl.ReadObject(region, 0, (*seqLockTestData)(nil)))
+	a.Error(sl.ReadObject(region, 0, &struct{ s string }{}))
+	a.Error(sl.WriteObject(region, 0, &struct{ m map[int]int }{}))
+}
+
+func TestSeqLockReadContext(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySeqLock(testSeqLockName)) {
+		return
+	}
+	sl, err := NewSeqLock(testSeqLockName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(sl.Destroy())
+	}()
+	a.NoError(shm.DestroyMemoryObject(testMemObj))
+	region, err := createMemoryRegionSimple(os.O_CREATE|os.O_RDWR, mmf.MEM_READWRITE, 256, 0)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(region.Close())
+		a.NoError(shm.DestroyMemoryObject(testMemObj))
+	}()
+	var data seqLockTestData
+	a.NoError(sl.ReadContext(context.Background(), func() {}))
+	a.NoError(sl.ReadObjectContext(context.Background(), region, 0, &data))
+	// the writer has died in the middle of a write.
+	sl.WriteBegin()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	a.Equal(context.DeadlineExceeded, sl.ReadContext(ctx, func() {}))
+	a.Equal(context.DeadlineExceeded, sl.ReadObjectContext(ctx, region, 0, &data))
+	a.Error(sl.ReadObjectContext(ctx, region, -1, &data))
+}
+
+func TestSeqLockReadWrite(t *testing.T) {
+	const iterations = 20000
+	a := assert.New(t)
+	if !a.NoError(DestroySeqLock(testSeqLockName)) {
+		return
+	}
+	sl, err := NewSeqLock(testSeqLockName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(sl.Destroy())
+	}()
+	a.NoError(shm.DestroyMemoryObject(testMemObj))
+	region, err := createMemoryRegionSimple(os.O_CREATE|os.O_RDWR, mmf.MEM_READWRITE, 256, 0)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(region.Close())
+		a.NoError(shm.DestroyMemoryObject(testMemObj))
+	}()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var data seqLockTestData
+		for i := 1; i <= iterations; i++ {
+			data.Version = int64(i)
+			data.Sum = 0
+			for j := range data.Values {
+				data.Values[j] = int64(i * j)
+				data.Sum += data.Values[j]
+			}
+			if !a.NoError(sl.WriteObject(region, 8, &data)) {
+				return
+			}
+		}
+	}()
+	for reader := 0; reader < 4; reader++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			other, err := NewSeqLock(testSeqLockName, 0, 0666)
+			if !a.NoError(err) {
+				return
+			}
+			defer other.Close()
+			var data seqLockTestData
+			for data.Version < iterations {
+				if !a.NoError(other.ReadObject(region, 8, &data)) {
+					return
+				}
+				var sum int64
+				for _, value := range data.Values {
+					sum += value
+				}
+				if !a.Equal(data.Sum, sum) {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -23,6 +23,8 @@ const (
 	eventProgPath  = "./internal/test/event/"
 	semaProgPath   = "./internal/test/sema/"
 	testMemObj     = "go-ipc.sync-test.region"
+	// testHelperEnv is set, when the test binary is run as a helper process by a test.
+	testHelperEnv = "GO_IPC_SYNC_TEST_HELPER"
 )
 
 var (
@@ -65,6 +67,10 @@ func detectMutexType() {
 }
 
 func init() {
+	// helper processes run concurrently, so they must not touch shared test objects.
+	if len(os.Getenv(testHelperEnv)) > 0 {
+		return
+	}
 	detectMutexType()
 	lockerProgArgs = locate(lockerProgPath)
 	condProgArgs = locate(condProgPath)
@@ -0,0 +1,13 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build darwin freebsd
+
+package sync
+
+// semctl commands from sys/sem.h.
+const (
+	cGETNCNT = 3
+	cGETPID  = 4
+	cGETVAL  = 5
+	cGETZCNT = 7
+)
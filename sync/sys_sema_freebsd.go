@@ -2,6 +2,9 @@
 
 package sync
 
+// freebsd7___semctl takes a pointer to union semun.
+const semunByPointer = true
+
 func init() {
 	// values from http://fxr.watson.org/fxr/source/kern/syscalls.master
 	sysSemGet = 221
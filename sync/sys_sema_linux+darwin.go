@@ -6,6 +6,9 @@ package sync
 
 import "golang.org/x/sys/unix"
 
+// semctl takes union semun by value.
+const semunByPointer = false
+
 func init() {
 	sysSemGet = unix.SYS_SEMGET
 	sysSemCtl = unix.SYS_SEMCTL
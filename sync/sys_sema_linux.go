@@ -0,0 +1,11 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package sync
+
+// semctl commands from linux/sem.h.
+const (
+	cGETPID  = 11
+	cGETVAL  = 12
+	cGETNCNT = 14
+	cGETZCNT = 15
+)
@@ -18,6 +18,8 @@ const (
 	cSEMGET     = 2
 	cSEMCTL     = 3
 	cSEMTIMEDOP = 4
+
+	cIPC_64 = 0x100
 )
 
 // semun is a union used in semctl syscall. is not not actually used, so its size
@@ -41,8 +43,22 @@ func semget(k common.Key, nsems, semflg int) (int, error) {
 	return int(id), nil
 }
 
-func semctl(id, num, cmd int) error {
-	_, _, err := unix.Syscall6(unix.SYS_IPC, cSEMCTL, uintptr(id), uintptr(num), uintptr(cmd), uintptr(semun_inst), 0)
+func semctl(id, num, cmd int) (int, error) {
+	result, _, err := unix.Syscall6(unix.SYS_IPC, cSEMCTL, uintptr(id), uintptr(num), uintptr(cmd), uintptr(semun_inst), 0)
+	if err != syscall.Errno(0) {
+		return 0, os.NewSyscallError("SEMCTL", err)
+	}
+	return int(result), nil
+}
+
+// semctlDs calls semctl with a pointer to semid_ds.
+// ipc syscall takes a pointer to union semun, and IPC_64 flag is required for 64-bit ipc_perm.
+func semctlDs(id, cmd int, ds unsafe.Pointer) error {
+	semun := ds
+	pSemun := unsafe.Pointer(&semun)
+	_, _, err := unix.Syscall6(unix.SYS_IPC, cSEMCTL, uintptr(id), 0, uintptr(cmd|cIPC_64), uintptr(pSemun), 0)
+	allocator.Use(pSemun)
+	allocator.Use(ds)
 	if err != syscall.Errno(0) {
 		return os.NewSyscallError("SEMCTL", err)
 	}
@@ -0,0 +1,83 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package sync
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"bitbucket.org/avd/go-ipc/ipcperm"
+)
+
+// WaitGroup waits for a collection of processes or goroutines to finish.
+// It is an interprocess analogue of sync.WaitGroup:
+// the counter is incremented with Add, decremented with Done,
+// and Wait blocks, until it drops to zero.
+type WaitGroup waitGroup
+
+// NewWaitGroup creates a new interprocess wait group with zero counter.
+// It uses the default implementation on the current platform.
+//	name - object name.
+//	flag - flag is a combination of open flags from 'os' package.
+//	perm - object's permission bits.
+func NewWaitGroup(name string, flag int, perm os.FileMode) (*WaitGroup, error) {
+	wg, err := newWaitGroup(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return (*WaitGroup)(wg), nil
+}
+
+// Add adds delta, which may be negative, to the counter.
+// If the counter becomes zero, all the waiters are released.
+// It panics, if the counter becomes negative.
+func (wg *WaitGroup) Add(delta int) {
+	(*waitGroup)(wg).lwwg.add(delta)
+}
+
+// Done decrements the counter by one.
+func (wg *WaitGroup) Done() {
+	wg.Add(-1)
+}
+
+// Wait blocks, until the counter is zero.
+func (wg *WaitGroup) Wait() {
+	(*waitGroup)(wg).lwwg.waitTimeout(-1)
+}
+
+// WaitTimeout waits, until the counter is zero, but for not longer than timeout.
+// It returns true, if the counter became zero.
+func (wg *WaitGroup) WaitTimeout(timeout time.Duration) bool {
+	return (*waitGroup)(wg).lwwg.waitTimeout(timeout)
+}
+
+// WaitContext waits, until the counter is zero, or the context is done.
+// It returns ctx.Err(), if the context was done first.
+func (wg *WaitGroup) WaitContext(ctx context.Context) error {
+	return waitContext(ctx, wg.WaitTimeout)
+}
+
+// Close closes the wait group.
+func (wg *WaitGroup) Close() error {
+	return (*waitGroup)(wg).close()
+}
+
+// Destroy permanently destroys the wait group.
+func (wg *WaitGroup) Destroy() error {
+	return (*waitGroup)(wg).destroy()
+}
+
+// DestroyWaitGroup permanently destroys a wait group with the given name.
+func DestroyWaitGroup(name string) error {
+	return destroyWaitGroup(name)
+}
+
+// SetWaitGroupPermissions changes the mode and the ownership of the wait group with the given name.
+func SetWaitGroupPermissions(name string, perm ipcperm.Permissions) error {
+	return setWaitGroupPermissions(name, perm)
+}
+
+func waitGroupName(baseName string) string {
+	return baseName + ".wg"
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build freebsd linux
+
+package sync
+
+import (
+	"os"
+	"unsafe"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
+	"bitbucket.org/avd/go-ipc/mmf"
+	"bitbucket.org/avd/go-ipc/shm"
+	"github.com/pkg/errors"
+)
+
+type waitGroup struct {
+	name   string
+	region *mmf.MemoryRegion
+	lwwg   *lwWaitGroup
+}
+
+func newWaitGroup(name string, flag int, perm os.FileMode) (*waitGroup, error) {
+	if err := ensureOpenFlags(flag); err != nil {
+		return nil, err
+	}
+
+	region, created, err := helper.CreateWritableRegion(waitGroupName(name), flag, perm, lwwgStateSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create shared state")
+	}
+	state := (*lwwgState)(allocator.ByteSliceData(region.Data()))
+	result := &waitGroup{
+		lwwg:   newLightweightWaitGroup(unsafe.Pointer(state), &futex{ptr: unsafe.Pointer(&state.seq)}, false),
+		name:   name,
+		region: region,
+	}
+	if created {
+		result.lwwg.init()
+	}
+	return result, nil
+}
+
+func (wg *waitGroup) close() error {
+	return wg.region.Close()
+}
+
+func (wg *waitGroup) destroy() error {
+	if err := wg.close(); err != nil {
+		return errors.Wrap(err, "failed to close shm region")
+	}
+	return destroyWaitGroup(wg.name)
+}
+
+func destroyWaitGroup(name string) error {
+	if err := shm.DestroyMemoryObject(waitGroupName(name)); err != nil {
+		return errors.Wrap(err, "failed to destroy memory object")
+	}
+	return nil
+}
+
+func setWaitGroupPermissions(name string, perm ipcperm.Permissions) error {
+	return shm.SetPermissions(waitGroupName(name), perm)
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+// +build windows darwin
+
+package sync
+
+import (
+	"os"
+
+	"bitbucket.org/avd/go-ipc/internal/allocator"
+	"bitbucket.org/avd/go-ipc/internal/helper"
+	"bitbucket.org/avd/go-ipc/ipcperm"
+	"bitbucket.org/avd/go-ipc/mmf"
+	"bitbucket.org/avd/go-ipc/shm"
+	"github.com/pkg/errors"
+)
+
+type waitGroup struct {
+	s      *Semaphore
+	region *mmf.MemoryRegion
+	name   string
+	lwwg   *lwWaitGroup
+}
+
+func newWaitGroup(name string, flag int, perm os.FileMode) (*waitGroup, error) {
+	if err := ensureOpenFlags(flag); err != nil {
+		return nil, err
+	}
+
+	region, created, err := helper.CreateWritableRegion(waitGroupName(name), flag, perm, lwwgStateSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create shared state")
+	}
+	s, err := NewSemaphore(waitGroupName(name), flag, perm, 0)
+	if err != nil {
+		region.Close()
+		if created {
+			shm.DestroyMemoryObject(waitGroupName(name))
+		}
+		return nil, errors.Wrap(err, "failed to create a semaphore")
+	}
+	result := &waitGroup{
+		lwwg:   newLightweightWaitGroup(allocator.ByteSliceData(region.Data()), newSemaWaiter(s), true),
+		name:   name,
+		region: region,
+		s:      s,
+	}
+	if created {
+		result.lwwg.init()
+	}
+	return result, nil
+}
+
+func (wg *waitGroup) close() error {
+	e1, e2 := wg.s.Close(), wg.region.Close()
+	if e1 != nil {
+		return errors.Wrap(e1, "failed to close sema")
+	}
+	if e2 != nil {
+		return errors.Wrap(e2, "failed to close shared state")
+	}
+	return nil
+}
+
+func (wg *waitGroup) destroy() error {
+	if err := wg.close(); err != nil {
+		return errors.Wrap(err, "failed to close the wait group")
+	}
+	return destroyWaitGroup(wg.name)
+}
+
+func destroyWaitGroup(name string) error {
+	e1, e2 := shm.DestroyMemoryObject(waitGroupName(name)), destroySemaphore(waitGroupName(name))
+	if e1 != nil {
+		return errors.Wrap(e1, "failed to destroy memory object")
+	}
+	if e2 != nil {
+		return errors.Wrap(e2, "failed to destroy semaphore")
+	}
+	return nil
+}
+
+func setWaitGroupPermissions(name string, perm ipcperm.Permissions) error {
+	if err := shm.SetPermissions(waitGroupName(name), perm); err != nil {
+		return errors.Wrap(err, "failed to set shared state permissions")
+	}
+	return setSemaphorePermissions(waitGroupName(name), perm)
+}
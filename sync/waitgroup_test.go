@@ -0,0 +1,207 @@
+// Copyright 2016 Aleksandr Demakin. All rights reserved.
+
+package sync
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testWaitGroupName = "testwg"
+)
+
+// TestWaitGroupHelper is not a real test. It is run in a child process by TestWaitGroupAnotherProcess.
+func TestWaitGroupHelper(t *testing.T) {
+	if os.Getenv(testHelperEnv) != "waitgroup" {
+		return
+	}
+	wg, err := NewWaitGroup(testWaitGroupName, 0, 0666)
+	if err != nil {
+		os.Exit(1)
+	}
+	wg.Done()
+	os.Exit(0)
+}
+
+func TestWaitGroupOpenMode(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyWaitGroup(testWaitGroupName)) {
+		return
+	}
+	_, err := NewWaitGroup(testWaitGroupName, os.O_RDWR, 0666)
+	a.Error(err)
+	_, err = NewWaitGroup(testWaitGroupName, 0, 0666)
+	a.Error(err)
+	wg, err := NewWaitGroup(testWaitGroupName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(wg.Destroy())
+	}()
+	_, err = NewWaitGroup(testWaitGroupName, os.O_CREATE|os.O_EXCL, 0666)
+	a.Error(err)
+	wg2, err := NewWaitGroup(testWaitGroupName, 0, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(wg2.Close())
+}
+
+func TestWaitGroupWait(t *testing.T) {
+	const workers = 8
+	a := assert.New(t)
+	if !a.NoError(DestroyWaitGroup(testWaitGroupName)) {
+		return
+	}
+	wg, err := NewWaitGroup(testWaitGroupName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(wg.Destroy())
+	}()
+	// the counter is zero, so Wait must not block.
+	wg.Wait()
+	for round := 0; round < 10; round++ {
+		var finished int32
+		wg.Add(workers)
+		var waiters sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			waiters.Add(1)
+			go func() {
+				defer waiters.Done()
+				a.True(wg.WaitTimeout(time.Second * 5))
+			}()
+		}
+		for i := 0; i < workers; i++ {
+			go func() {
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&finished, 1)
+				wg.Done()
+			}()
+		}
+		wg.Wait()
+		a.Equal(int32(workers), atomic.LoadInt32(&finished))
+		waiters.Wait()
+	}
+}
+
+func TestWaitGroupWaitTimeout(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyWaitGroup(testWaitGroupName)) {
+		return
+	}
+	wg, err := NewWaitGroup(testWaitGroupName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(wg.Destroy())
+	}()
+	wg.Add(1)
+	a.False(wg.WaitTimeout(0))
+	a.False(wg.WaitTimeout(time.Millisecond * 50))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	a.Equal(context.DeadlineExceeded, wg.WaitContext(ctx))
+	// the timed out waiters must not consume the release of the next waiter.
+	result := make(chan bool)
+	go func() {
+		result <- wg.WaitTimeout(time.Second * 5)
+	}()
+	time.Sleep(time.Millisecond * 50)
+	wg.Done()
+	a.True(<-result)
+	a.True(wg.WaitTimeout(0))
+	a.NoError(wg.WaitContext(context.Background()))
+}
+
+func TestWaitGroupNegativeCounter(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroyWaitGroup(testWaitGroupName)) {
+		return
+	}
+	wg, err := NewWaitGroup(testWaitGroupName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(wg.Destroy())
+	}()
+	a.Panics(func() {
+		wg.Done()
+	})
+	wg.Add(1)
+	a.Panics(func() {
+		wg.Add(-2)
+	})
+	// the counter must not be changed by a failed call.
+	a.False(wg.WaitTimeout(0))
+	wg.Done()
+	a.True(wg.WaitTimeout(0))
+}
+
+func TestWaitGroupSemaPermits(t *testing.T) {
+	a := assert.New(t)
+	if !a.NoError(DestroySemaphore(testSemaName)) {
+		return
+	}
+	s, err := NewSemaphore(testSemaName, os.O_CREATE|os.O_EXCL, 0666, 0)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(s.Close())
+		a.NoError(DestroySemaphore(testSemaName))
+	}()
+	var state lwwgState
+	wg := newLightweightWaitGroup(unsafe.Pointer(&state), newSemaWaiter(s), true)
+	wg.add(1)
+	// register a waiter of the first generation, which has not consumed its permit yet.
+	state.word += lwwgWaiterInc
+	wg.add(-1)
+	// a waiter of the next generation takes the permit, but must give it back.
+	wg.add(1)
+	a.False(wg.waitTimeout(time.Millisecond * 100))
+	a.True(s.WaitTimeout(0))
+	a.False(s.WaitTimeout(0))
+}
+
+func TestWaitGroupAnotherProcess(t *testing.T) {
+	const children = 3
+	a := assert.New(t)
+	if !a.NoError(DestroyWaitGroup(testWaitGroupName)) {
+		return
+	}
+	wg, err := NewWaitGroup(testWaitGroupName, os.O_CREATE|os.O_EXCL, 0666)
+	if !a.NoError(err) {
+		return
+	}
+	defer func() {
+		a.NoError(wg.Destroy())
+	}()
+	wg.Add(children)
+	var cmds []*exec.Cmd
+	for i := 0; i < children; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestWaitGroupHelper$")
+		cmd.Env = append(os.Environ(), testHelperEnv+"=waitgroup")
+		if !a.NoError(cmd.Start()) {
+			return
+		}
+		cmds = append(cmds, cmd)
+	}
+	a.True(wg.WaitTimeout(time.Second * 10))
+	for _, cmd := range cmds {
+		a.NoError(cmd.Wait())
+	}
+}